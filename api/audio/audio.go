@@ -13,4 +13,6 @@ import (
 type IAudioV1 interface {
 	Speech(ctx context.Context, req *v1.SpeechReq) (res *v1.SpeechRes, err error)
 	Transcriptions(ctx context.Context, req *v1.TranscriptionsReq) (res *v1.TranscriptionsRes, err error)
+	SpeechEstimate(ctx context.Context, req *v1.SpeechEstimateReq) (res *v1.SpeechEstimateRes, err error)
+	TranscriptionsEstimate(ctx context.Context, req *v1.TranscriptionsEstimateReq) (res *v1.TranscriptionsEstimateRes, err error)
 }
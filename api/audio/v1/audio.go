@@ -29,3 +29,26 @@ type TranscriptionsReq struct {
 type TranscriptionsRes struct {
 	g.Meta `mime:"application/json" example:"json"`
 }
+
+// Speech预估接口请求参数
+type SpeechEstimateReq struct {
+	g.Meta `path:"/speech/estimate" tags:"audio" method:"post" summary:"audio预估接口"`
+	sdkm.SpeechRequest
+}
+
+// Speech预估接口响应参数
+type SpeechEstimateRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
+
+// Transcriptions预估接口请求参数
+type TranscriptionsEstimateReq struct {
+	g.Meta   `path:"/transcriptions/estimate" tags:"audio" method:"post" summary:"transcriptions预估接口"`
+	Model    string  `json:"model"`
+	Duration float64 `json:"duration" v:"required|min:0"` // 音频时长, 单位秒
+}
+
+// Transcriptions预估接口响应参数
+type TranscriptionsEstimateRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
@@ -12,4 +12,5 @@ import (
 
 type IChatV1 interface {
 	Completions(ctx context.Context, req *v1.CompletionsReq) (res *v1.CompletionsRes, err error)
+	CompletionsEstimate(ctx context.Context, req *v1.CompletionsEstimateReq) (res *v1.CompletionsEstimateRes, err error)
 }
@@ -15,3 +15,14 @@ type CompletionsReq struct {
 type CompletionsRes struct {
 	g.Meta `mime:"application/json" example:"json"`
 }
+
+// Completions预估接口请求参数
+type CompletionsEstimateReq struct {
+	g.Meta `path:"/completions/estimate" tags:"chat" method:"post" summary:"Completions预估接口"`
+	sdkm.ChatCompletionRequest
+}
+
+// Completions预估接口响应参数
+type CompletionsEstimateRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
@@ -19,6 +19,7 @@ type SubscriptionRes struct {
 // Usage接口请求参数
 type UsageReq struct {
 	g.Meta `path:"/billing/usage" tags:"dashboard" method:"get,post" summary:"Usage接口"`
+	model.DashboardUsageReq
 }
 
 // Usage接口响应参数
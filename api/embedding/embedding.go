@@ -12,4 +12,5 @@ import (
 
 type IEmbeddingV1 interface {
 	Embeddings(ctx context.Context, req *v1.EmbeddingsReq) (res *v1.EmbeddingsRes, err error)
+	EmbeddingsEstimate(ctx context.Context, req *v1.EmbeddingsEstimateReq) (res *v1.EmbeddingsEstimateRes, err error)
 }
@@ -15,3 +15,14 @@ type EmbeddingsReq struct {
 type EmbeddingsRes struct {
 	g.Meta `mime:"application/json" example:"json"`
 }
+
+// Embeddings预估接口请求参数
+type EmbeddingsEstimateReq struct {
+	g.Meta `path:"/embeddings/estimate" tags:"embedding" method:"post" summary:"embeddings预估接口"`
+	sdkm.EmbeddingRequest
+}
+
+// Embeddings预估接口响应参数
+type EmbeddingsEstimateRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
@@ -12,4 +12,6 @@ import (
 
 type IFileV1 interface {
 	Files(ctx context.Context, req *v1.FilesReq) (res *v1.FilesRes, err error)
+	Retrieve(ctx context.Context, req *v1.RetrieveReq) (res *v1.RetrieveRes, err error)
+	Content(ctx context.Context, req *v1.ContentReq) (res *v1.ContentRes, err error)
 }
@@ -15,3 +15,25 @@ type FilesReq struct {
 type FilesRes struct {
 	g.Meta `mime:"application/json" example:"json"`
 }
+
+// Retrieve接口请求参数
+type RetrieveReq struct {
+	g.Meta `path:"/files/{file_id}" tags:"file" method:"get" summary:"Retrieve接口"`
+	FileId string `json:"file_id"`
+}
+
+// Retrieve接口响应参数
+type RetrieveRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
+
+// Content接口请求参数
+type ContentReq struct {
+	g.Meta `path:"/files/{file_id}/content" tags:"file" method:"get" summary:"Content接口"`
+	FileId string `json:"file_id"`
+}
+
+// Content接口响应参数
+type ContentRes struct {
+	g.Meta `mime:"application/jsonl" example:"string"`
+}
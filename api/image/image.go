@@ -12,4 +12,5 @@ import (
 
 type IImageV1 interface {
 	Generations(ctx context.Context, req *v1.GenerationsReq) (res *v1.GenerationsRes, err error)
+	GenerationsEstimate(ctx context.Context, req *v1.GenerationsEstimateReq) (res *v1.GenerationsEstimateRes, err error)
 }
@@ -15,3 +15,14 @@ type GenerationsReq struct {
 type GenerationsRes struct {
 	g.Meta `mime:"application/json" example:"json"`
 }
+
+// Generations预估接口请求参数
+type GenerationsEstimateReq struct {
+	g.Meta `path:"/generations/estimate" tags:"image" method:"post" summary:"Generations预估接口"`
+	sdkm.ImageRequest
+}
+
+// Generations预估接口响应参数
+type GenerationsEstimateRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
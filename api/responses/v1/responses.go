@@ -0,0 +1,39 @@
+package v1
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/iimeta/fastapi/internal/model"
+)
+
+// Create接口请求参数
+type CreateReq struct {
+	g.Meta `path:"/" tags:"responses" method:"post" summary:"Create接口"`
+	model.ResponsesReq
+}
+
+// Create接口响应参数
+type CreateRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
+
+// Retrieve接口请求参数
+type RetrieveReq struct {
+	g.Meta     `path:"/{response_id}" tags:"responses" method:"get" summary:"Retrieve接口"`
+	ResponseId string `json:"response_id"`
+}
+
+// Retrieve接口响应参数
+type RetrieveRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
+
+// Delete接口请求参数
+type DeleteReq struct {
+	g.Meta     `path:"/{response_id}" tags:"responses" method:"delete" summary:"Delete接口"`
+	ResponseId string `json:"response_id"`
+}
+
+// Delete接口响应参数
+type DeleteRes struct {
+	g.Meta `mime:"application/json" example:"json"`
+}
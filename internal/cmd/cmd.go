@@ -11,7 +11,9 @@ import (
 	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/controller/anthropic"
 	"github.com/iimeta/fastapi/internal/controller/audio"
+	"github.com/iimeta/fastapi/internal/controller/batch"
 	"github.com/iimeta/fastapi/internal/controller/chat"
+	"github.com/iimeta/fastapi/internal/controller/completion"
 	"github.com/iimeta/fastapi/internal/controller/dashboard"
 	"github.com/iimeta/fastapi/internal/controller/embedding"
 	"github.com/iimeta/fastapi/internal/controller/file"
@@ -20,6 +22,7 @@ import (
 	"github.com/iimeta/fastapi/internal/controller/image"
 	"github.com/iimeta/fastapi/internal/controller/midjourney"
 	"github.com/iimeta/fastapi/internal/controller/moderation"
+	"github.com/iimeta/fastapi/internal/controller/responses"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/model"
 	"github.com/iimeta/fastapi/internal/service"
@@ -81,6 +84,7 @@ var (
 						moderation.NewV1(),
 						file.NewV1(),
 						anthropic.NewV1(),
+						completion.NewV1(),
 					)
 				})
 
@@ -107,6 +111,18 @@ var (
 						audio.NewV1(),
 					)
 				})
+
+				v1.Group("/responses", func(g *ghttp.RouterGroup) {
+					g.Bind(
+						responses.NewV1(),
+					)
+				})
+
+				v1.Group("/batches", func(g *ghttp.RouterGroup) {
+					g.Bind(
+						batch.NewV1(),
+					)
+				})
 			})
 
 			s.Group("/mj**", func(v1 *ghttp.RouterGroup) {
@@ -197,6 +213,18 @@ func middleware(r *ghttp.Request) {
 		return
 	}
 
+	// 速率限制, 仅限制请求上游的接口, 超限时释放已占用的并发数
+	if !isRateLimitExempt(r) {
+		if err := service.RateLimit().Limit(r.GetCtx()); err != nil {
+			service.Concurrency().Release(r.GetCtx())
+			err := errors.Error(r.GetCtx(), err)
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteStatus(err.Status(), gjson.MustEncodeString(err))
+			r.Exit()
+			return
+		}
+	}
+
 	if config.Cfg.Debug.Open {
 		if gstr.HasPrefix(r.GetHeader("Content-Type"), "application/json") {
 			logger.Debugf(r.GetCtx(), "url: %s, request body: %s", r.GetUrl(), r.GetBodyString())
@@ -206,6 +234,30 @@ func middleware(r *ghttp.Request) {
 	}
 
 	r.Middleware.Next()
+
+	// 释放请求占用的并发数
+	service.Concurrency().Release(r.GetCtx())
+
+	// 释放未进入记录使用额度(出错或无花费)的请求的预占额度
+	service.Common().ReleaseQuota(r.GetCtx())
+}
+
+// 是否为不请求上游的看板、文件、批处理管理、响应管理和预估接口, 不计入速率限制
+func isRateLimitExempt(r *ghttp.Request) bool {
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	if gstr.HasSuffix(path, "/estimate") {
+		return true
+	}
+
+	for _, prefix := range []string{"/v1/dashboard", "/v1/models", "/v1/billing", "/v1/files", "/v1/batches"} {
+		if path == prefix || gstr.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+
+	return gstr.HasPrefix(path, "/v1/responses/") && r.Method != http.MethodPost
 }
 
 type defaultHandlerResponse struct {
@@ -9,6 +9,9 @@ const (
 	CHANGE_CHANNEL_MODEL   = "admin:change:channel:model"
 	CHANGE_CHANNEL_KEY     = "admin:change:channel:key"
 	CHANGE_CHANNEL_AGENT   = "admin:change:channel:agent"
+
+	CHANGE_CHANNEL_BREAKER  = "api:change:channel:breaker"
+	CHANGE_CHANNEL_COOLDOWN = "api:change:channel:cooldown"
 )
 
 const (
@@ -17,4 +20,5 @@ const (
 	ACTION_DELETE = "delete"
 	ACTION_STATUS = "status"
 	ACTION_MODELS = "models"
+	ACTION_QUOTA  = "quota"
 )
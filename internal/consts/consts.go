@@ -1,11 +1,20 @@
 package consts
 
 const (
-	SESSION_USER               = "session_user"
-	SESSION_APP                = "session_app"
-	SESSION_KEY                = "session_key"
-	SESSION_ERROR_MODEL_AGENTS = "session_error_model_agents"
-	SESSION_ERROR_KEYS         = "session_error_keys"
+	SESSION_USER                  = "session_user"
+	SESSION_APP                   = "session_app"
+	SESSION_KEY                   = "session_key"
+	SESSION_ERROR_MODEL_AGENTS    = "session_error_model_agents"
+	SESSION_ERROR_KEYS            = "session_error_keys"
+	SESSION_FALLBACKS             = "session_fallbacks"
+	SESSION_CONCURRENCY_LEASES    = "session_concurrency_leases"
+	SESSION_QUOTA_RESERVATION     = "session_quota_reservation"
+	SESSION_IS_RATE_LIMIT_CHECKED = "session_is_rate_limit_checked"
+	SESSION_BILLING_SEQ           = "session_billing_seq"
+	SESSION_SOFT_LIMIT            = "session_soft_limit"
+	SESSION_MODEL_QUOTA_FIELDS    = "session_model_quota_fields"
+	SESSION_SSE_CONVERTER         = "session_sse_converter"
+	SESSION_RESUME_TOKENS         = "session_resume_tokens"
 
 	HOST_KEY               = "host"
 	USER_ID_KEY            = "user_id"
@@ -13,6 +22,8 @@ const (
 	SECRET_KEY             = "sk"
 	APP_IS_LIMIT_QUOTA_KEY = "app_is_limit_quota"
 	KEY_IS_LIMIT_QUOTA_KEY = "key_is_limit_quota"
+	BATCH_ID_KEY           = "batch_id"
+	UPSTREAM_HEADER_KEY    = "upstream_header"
 
 	CORP_OPENAI     = "OpenAI"
 	CORP_AZURE      = "Azure"
@@ -43,6 +54,52 @@ const (
 	COMPLETION_STREAM_OBJECT = "chat.completion.chunk"
 )
 
+const (
+	TEXT_COMPLETION_ID_PREFIX = "cmpl-"
+	TEXT_COMPLETION_OBJECT    = "text_completion"
+)
+
+const (
+	RESPONSE_ID_PREFIX     = "resp_"
+	RESPONSE_OBJECT        = "response"
+	RESPONSE_DELETE_OBJECT = "response.deleted"
+	RESPONSE_MESSAGE_ID    = "msg_"
+	RESPONSE_FUNCTION_ID   = "fc_"
+)
+
+const (
+	FILE_ID_PREFIX            = "file-"
+	FILE_OBJECT               = "file"
+	FILE_PURPOSE_BATCH        = "batch"
+	FILE_PURPOSE_BATCH_OUTPUT = "batch_output"
+	FILE_STATUS_PROCESSED     = "processed"
+)
+
+const (
+	BATCH_ID_PREFIX         = "batch_"
+	BATCH_OBJECT            = "batch"
+	BATCH_REQUEST_ID_PREFIX = "batch_req_"
+
+	BATCH_STATUS_VALIDATING  = "validating"
+	BATCH_STATUS_FAILED      = "failed"
+	BATCH_STATUS_IN_PROGRESS = "in_progress"
+	BATCH_STATUS_FINALIZING  = "finalizing"
+	BATCH_STATUS_COMPLETED   = "completed"
+	BATCH_STATUS_EXPIRED     = "expired"
+	BATCH_STATUS_CANCELLING  = "cancelling"
+	BATCH_STATUS_CANCELLED   = "cancelled"
+
+	BATCH_ENDPOINT_CHAT_COMPLETIONS = "/v1/chat/completions"
+	BATCH_ENDPOINT_EMBEDDINGS       = "/v1/embeddings"
+)
+
+const (
+	FALLBACK_CONDITION_TIMEOUT        = "timeout"
+	FALLBACK_CONDITION_5XX            = "5xx"
+	FALLBACK_CONDITION_CONTENT_FILTER = "content_filter"
+	FALLBACK_CONDITION_RATE_LIMIT     = "rate_limit"
+)
+
 const (
 	DELTA_TYPE_TEXT       = "text_delta"
 	DELTA_TYPE_INPUT_JSON = "input_json_delta"
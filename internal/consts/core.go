@@ -1,12 +1,19 @@
 package consts
 
 const (
-	API_USAGE_KEY = "api:user:%d:usage"
+	API_USAGE_KEY    = "api:user:%d:usage"
+	API_RESERVED_KEY = "api:user:%d:reserved"
+	API_LEDGER_KEY   = "api:usage_ledger:%s"
 
 	USER_QUOTA_FIELD = "user.quota"
 	APP_QUOTA_FIELD  = "app.%d.quota"
 	KEY_QUOTA_FIELD  = "key.%d.%s.quota"
 
+	APP_MODEL_USED_FIELD      = "app.%d.model.%s.used"
+	APP_MODEL_TYPE_USED_FIELD = "app.%d.type.%d.used"
+	KEY_MODEL_USED_FIELD      = "key.%d.%s.model.%s.used"
+	KEY_MODEL_TYPE_USED_FIELD = "key.%d.%s.type.%d.used"
+
 	API_USER_KEY    = "api:user:%d"
 	API_APP_KEY     = "api:app:%d"
 	API_APP_KEY_KEY = "api:app:key:%s"
@@ -21,6 +28,23 @@ const (
 	ERROR_MODEL_AGENT     = "api:error:model:agent:%s"
 	ERROR_MODEL_AGENT_KEY = "api:error:model:agent:key:%s"
 
+	AFFINITY_MODEL_KEY       = "api:affinity:model:key:%s:%s"
+	AFFINITY_MODEL_AGENT     = "api:affinity:model:agent:%s:%s"
+	AFFINITY_MODEL_AGENT_KEY = "api:affinity:model:agent:key:%s:%s"
+
+	BREAKER_KEY = "api:breaker:%s"
+
+	RATE_LIMIT_COOLDOWN_KEY = "api:rate_limit:cooldown"
+	RATE_LIMIT_KEY          = "api:rate_limit:%s:%s"
+
+	CONCURRENCY_KEY       = "api:concurrency:%s:%s"
+	CONCURRENCY_QUEUE_KEY = "api:concurrency:queue:%s"
+
+	HEALTH_PROBE_ATTEMPTS_KEY = "api:health_probe:attempts"
+
+	QUOTA_NOTICE_KEY         = "api:quota_notice:%s:%s:%s"
+	QUOTA_NOTICE_GRANTED_KEY = "api:quota_notice:granted:%s"
+
 	ACCESS_TOKEN_KEY = "api:baidu:access_token:%s"
 	GCP_TOKEN_KEY    = "api:gcp:token:%s"
 )
@@ -29,4 +53,68 @@ const (
 	LOCK_USER_KEY = "api:lock:user:%d"
 	LOCK_APP_KEY  = "api:lock:app:%d"
 	LOCK_SK_KEY   = "api:lock:sk:%s"
+
+	LOCK_HEALTH_PROBE_KEY = "api:lock:health_probe"
+	LOCK_QUOTA_BUDGET_KEY = "api:lock:quota_budget"
+	LOCK_QUOTA_NOTICE_KEY = "api:lock:quota_notice"
+	LOCK_MODEL_QUOTA_KEY  = "api:lock:model_quota"
+
+	LOCK_USAGE_RECONCILE_KEY = "api:lock:usage_reconcile"
+	LOCK_USAGE_LEDGER_KEY    = "api:lock:usage_ledger:%s"
+	LOCK_BATCH_KEY           = "api:lock:batch:%s"
+)
+
+const (
+	BREAKER_TYPE_MODEL_KEY       = "model_key"
+	BREAKER_TYPE_MODEL_AGENT     = "model_agent"
+	BREAKER_TYPE_MODEL_AGENT_KEY = "model_agent_key"
+
+	BREAKER_STATE_CLOSED    = "closed"
+	BREAKER_STATE_OPEN      = "open"
+	BREAKER_STATE_HALF_OPEN = "half_open"
+)
+
+const (
+	QUOTA_BUDGET_TYPE_APP     = "app"
+	QUOTA_BUDGET_TYPE_APP_KEY = "app_key"
+)
+
+const (
+	USAGE_LEDGER_STEP_USER_REDIS    = "user.redis"
+	USAGE_LEDGER_STEP_USER_MONGO    = "user.mongo"
+	USAGE_LEDGER_STEP_APP_REDIS     = "app.redis"
+	USAGE_LEDGER_STEP_APP_MONGO     = "app.mongo"
+	USAGE_LEDGER_STEP_APP_KEY_REDIS = "app_key.redis"
+	USAGE_LEDGER_STEP_APP_KEY_MONGO = "app_key.mongo"
+	USAGE_LEDGER_STEP_KEY_MONGO     = "key.mongo"
+
+	USAGE_LEDGER_STEP_MODEL_QUOTA_REDIS = "model_quota.redis.%s"
+
+	USAGE_DRIFT_TYPE_USER    = "user"
+	USAGE_DRIFT_TYPE_APP     = "app"
+	USAGE_DRIFT_TYPE_APP_KEY = "app_key"
+)
+
+const (
+	NOTICE_TYPE_USER    = "user"
+	NOTICE_TYPE_APP     = "app"
+	NOTICE_TYPE_APP_KEY = "app_key"
+
+	NOTICE_EVENT_QUOTA_LOW       = "quota_low"
+	NOTICE_EVENT_QUOTA_EXHAUSTED = "quota_exhausted"
+	NOTICE_EVENT_QUOTA_EXPIRING  = "quota_expiring"
+	NOTICE_EVENT_SOFT_LIMIT      = "soft_limit"
+)
+
+const (
+	CONCURRENCY_TYPE_KEY         = "key"
+	CONCURRENCY_TYPE_MODEL_AGENT = "model_agent"
+	CONCURRENCY_TYPE_RATE_LIMIT  = "rate_limit"
+
+	CONCURRENCY_ACQUIRE_MAX_RETRY = 3 // 占用并发数被抢先占满时重新挑选的最大次数
+)
+
+const (
+	RATE_LIMIT_TYPE_REQUESTS = "requests"
+	RATE_LIMIT_TYPE_TOKENS   = "tokens"
 )
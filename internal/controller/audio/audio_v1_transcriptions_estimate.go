@@ -0,0 +1,28 @@
+package audio
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+
+	"github.com/iimeta/fastapi/api/audio/v1"
+)
+
+func (c *ControllerV1) TranscriptionsEstimate(ctx context.Context, req *v1.TranscriptionsEstimateReq) (res *v1.TranscriptionsEstimateRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "Controller TranscriptionsEstimate time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	response, err := service.Estimate().AudioTranscriptions(ctx, req.Model, req.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	g.RequestFromCtx(ctx).Response.WriteJson(response)
+
+	return
+}
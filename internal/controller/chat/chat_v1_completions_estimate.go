@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+
+	"github.com/iimeta/fastapi/api/chat/v1"
+)
+
+func (c *ControllerV1) CompletionsEstimate(ctx context.Context, req *v1.CompletionsEstimateReq) (res *v1.CompletionsEstimateRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "Controller CompletionsEstimate time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	response, err := service.Estimate().ChatCompletions(ctx, req.ChatCompletionRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	g.RequestFromCtx(ctx).Response.WriteJson(response)
+
+	return
+}
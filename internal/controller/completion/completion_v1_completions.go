@@ -0,0 +1,34 @@
+package completion
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+
+	"github.com/iimeta/fastapi/api/completion/v1"
+)
+
+func (c *ControllerV1) Completions(ctx context.Context, req *v1.CompletionsReq) (res *v1.CompletionsRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "Controller Completion Completions time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if req.Stream {
+		if err = service.Completion().CompletionsStream(ctx, req.CompletionRequest, nil, nil); err != nil {
+			return nil, err
+		}
+		g.RequestFromCtx(ctx).SetCtxVar("stream", req.Stream)
+	} else {
+		response, err := service.Completion().Completions(ctx, req.CompletionRequest, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		g.RequestFromCtx(ctx).Response.WriteJson(response)
+	}
+
+	return
+}
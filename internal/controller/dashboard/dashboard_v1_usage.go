@@ -10,7 +10,7 @@ import (
 
 func (c *ControllerV1) Usage(ctx context.Context, req *v1.UsageReq) (res *v1.UsageRes, err error) {
 
-	usage, err := service.Dashboard().Usage(ctx)
+	usage, err := service.Dashboard().Usage(ctx, req.DashboardUsageReq)
 	if err != nil {
 		return nil, err
 	}
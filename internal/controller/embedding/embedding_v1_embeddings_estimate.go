@@ -0,0 +1,28 @@
+package embedding
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+
+	"github.com/iimeta/fastapi/api/embedding/v1"
+)
+
+func (c *ControllerV1) EmbeddingsEstimate(ctx context.Context, req *v1.EmbeddingsEstimateReq) (res *v1.EmbeddingsEstimateRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "Controller EmbeddingsEstimate time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	response, err := service.Estimate().Embeddings(ctx, req.EmbeddingRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	g.RequestFromCtx(ctx).Response.WriteJson(response)
+
+	return
+}
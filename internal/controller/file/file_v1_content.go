@@ -0,0 +1,29 @@
+package file
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+
+	"github.com/iimeta/fastapi/api/file/v1"
+)
+
+func (c *ControllerV1) Content(ctx context.Context, req *v1.ContentReq) (res *v1.ContentRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "Controller File Content time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	content, err := service.File().Content(ctx, req.FileId)
+	if err != nil {
+		return nil, err
+	}
+
+	g.RequestFromCtx(ctx).Response.Header().Set("Content-Type", "application/jsonl")
+	g.RequestFromCtx(ctx).Response.Write(content)
+
+	return
+}
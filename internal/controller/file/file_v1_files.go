@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
 
@@ -17,6 +18,19 @@ func (c *ControllerV1) Files(ctx context.Context, req *v1.FilesReq) (res *v1.Fil
 		logger.Debugf(ctx, "Controller Transcriptions time: %d", gtime.TimestampMilli()-now)
 	}()
 
+	// 批处理文件存储到本地
+	if req.Purpose == consts.FILE_PURPOSE_BATCH {
+
+		response, err := service.File().Upload(ctx, req.FileFilesReq)
+		if err != nil {
+			return nil, err
+		}
+
+		g.RequestFromCtx(ctx).Response.WriteJson(response)
+
+		return nil, nil
+	}
+
 	fileName, err := req.File.Save("./resource/file/", true)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,28 @@
+package image
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+
+	"github.com/iimeta/fastapi/api/image/v1"
+)
+
+func (c *ControllerV1) GenerationsEstimate(ctx context.Context, req *v1.GenerationsEstimateReq) (res *v1.GenerationsEstimateRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "Controller GenerationsEstimate time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	response, err := service.Estimate().ImageGenerations(ctx, req.ImageRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	g.RequestFromCtx(ctx).Response.WriteJson(response)
+
+	return
+}
@@ -0,0 +1,24 @@
+package dao
+
+import (
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/db"
+)
+
+var BreakerLog = NewBreakerLogDao()
+
+type BreakerLogDao struct {
+	*MongoDB[entity.BreakerLog]
+}
+
+func NewBreakerLogDao(database ...string) *BreakerLogDao {
+
+	if len(database) == 0 {
+		database = append(database, db.DefaultDatabase)
+	}
+
+	return &BreakerLogDao{
+		MongoDB: NewMongoDB[entity.BreakerLog](database[0], do.BREAKER_LOG_COLLECTION),
+	}
+}
@@ -477,6 +477,20 @@ func EstimatedDocumentCount(ctx context.Context, database, collection string) (i
 	return m.EstimatedDocumentCount(ctx)
 }
 
+func (m *MongoDB[T]) CreateIndex(ctx context.Context, keys bson.D, opts ...*options.IndexOptions) (string, error) {
+	return CreateIndex(ctx, m.Database, m.Collection, keys, opts...)
+}
+
+func CreateIndex(ctx context.Context, database, collection string, keys bson.D, opts ...*options.IndexOptions) (string, error) {
+
+	m := &db.MongoDB{
+		Database:   database,
+		Collection: collection,
+	}
+
+	return m.CreateIndex(ctx, keys, opts...)
+}
+
 func (m *MongoDB[T]) Aggregate(ctx context.Context, pipeline []bson.M, result interface{}) error {
 	return Aggregate(ctx, m.Database, m.Collection, pipeline, result)
 }
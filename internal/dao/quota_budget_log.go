@@ -0,0 +1,24 @@
+package dao
+
+import (
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/db"
+)
+
+var QuotaBudgetLog = NewQuotaBudgetLogDao()
+
+type QuotaBudgetLogDao struct {
+	*MongoDB[entity.QuotaBudgetLog]
+}
+
+func NewQuotaBudgetLogDao(database ...string) *QuotaBudgetLogDao {
+
+	if len(database) == 0 {
+		database = append(database, db.DefaultDatabase)
+	}
+
+	return &QuotaBudgetLogDao{
+		MongoDB: NewMongoDB[entity.QuotaBudgetLog](database[0], do.QUOTA_BUDGET_LOG_COLLECTION),
+	}
+}
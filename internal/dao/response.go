@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/db"
+	"github.com/iimeta/fastapi/utility/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var Response = NewResponseDao()
+
+type ResponseDao struct {
+	*MongoDB[entity.Response]
+}
+
+func NewResponseDao(database ...string) *ResponseDao {
+
+	if len(database) == 0 {
+		database = append(database, db.DefaultDatabase)
+	}
+
+	responseDao := &ResponseDao{
+		MongoDB: NewMongoDB[entity.Response](database[0], do.RESPONSE_COLLECTION),
+	}
+
+	// 响应ID唯一, previous_response_id续接时按响应ID逐个查找
+	ctx := gctx.New()
+	if _, err := responseDao.CreateIndex(ctx, bson.D{{Key: "response_id", Value: 1}}, options.Index().SetUnique(true)); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	return responseDao
+}
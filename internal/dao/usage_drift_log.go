@@ -0,0 +1,24 @@
+package dao
+
+import (
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/db"
+)
+
+var UsageDriftLog = NewUsageDriftLogDao()
+
+type UsageDriftLogDao struct {
+	*MongoDB[entity.UsageDriftLog]
+}
+
+func NewUsageDriftLogDao(database ...string) *UsageDriftLogDao {
+
+	if len(database) == 0 {
+		database = append(database, db.DefaultDatabase)
+	}
+
+	return &UsageDriftLogDao{
+		MongoDB: NewMongoDB[entity.UsageDriftLog](database[0], do.USAGE_DRIFT_LOG_COLLECTION),
+	}
+}
@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/db"
+	"github.com/iimeta/fastapi/utility/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var UsageLedger = NewUsageLedgerDao()
+
+type UsageLedgerDao struct {
+	*MongoDB[entity.UsageLedger]
+}
+
+func NewUsageLedgerDao(database ...string) *UsageLedgerDao {
+
+	if len(database) == 0 {
+		database = append(database, db.DefaultDatabase)
+	}
+
+	usageLedgerDao := &UsageLedgerDao{
+		MongoDB: NewMongoDB[entity.UsageLedger](database[0], do.USAGE_LEDGER_COLLECTION),
+	}
+
+	// 日志ID唯一, 写入重试时不会重复记账
+	ctx := gctx.New()
+	if _, err := usageLedgerDao.CreateIndex(ctx, bson.D{{Key: "trace_id", Value: 1}}, options.Index().SetUnique(true)); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	return usageLedgerDao
+}
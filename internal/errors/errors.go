@@ -38,6 +38,7 @@ var (
 	ERR_MODEL_HAS_BEEN_DISABLED       = NewError(500, "fastapi_error", "Model has been disabled.", "fastapi_error")
 	ERR_INVALID_PARAMETER             = NewError(400, "invalid_parameter", "Invalid Parameter.", "fastapi_request_error")
 	ERR_UNSUPPORTED_FILE_FORMAT       = NewError(400, "unsupported_file_format", "Unsupported file format.", "fastapi_request_error")
+	ERR_UNSUPPORTED_COMPLETIONS       = NewError(400, "unsupported_completions", "The model does not support the completions API.", "fastapi_request_error")
 	ERR_NOT_API_KEY                   = NewError(401, "invalid_request_error", "You didn't provide an API key.", "fastapi_request_error")
 	ERR_INVALID_API_KEY               = NewError(401, "invalid_api_key", "Incorrect API key provided or has been disabled.", "fastapi_request_error")
 	ERR_API_KEY_DISABLED              = NewError(401, "api_key_disabled", "Key has been disabled.", "fastapi_request_error")
@@ -48,13 +49,25 @@ var (
 	ERR_MODEL_DISABLED                = NewError(401, "model_disabled", "Model has been disabled.", "fastapi_request_error")
 	ERR_FORBIDDEN                     = NewError(403, "forbidden", "Forbidden.", "fastapi_request_error")
 	ERR_NOT_AUTHORIZED                = NewError(403, "not_authorized", "Not Authorized.", "fastapi_request_error")
+	ERR_BATCH_NOT_ENABLED             = NewError(403, "batch_not_enabled", "Batch API is not enabled.", "fastapi_request_error")
 	ERR_NOT_FOUND                     = NewError(404, "unknown_url", "Unknown request URL.", "fastapi_request_error")
 	ERR_MODEL_NOT_FOUND               = NewError(404, "model_not_found", "The model does not exist or you do not have access to it.", "fastapi_request_error")
 	ERR_PATH_NOT_FOUND                = NewError(404, "path_not_found", "The path does not exist or you do not have access to it.", "fastapi_request_error")
+	ERR_RESPONSE_NOT_FOUND            = NewError(404, "response_not_found", "The response does not exist or you do not have access to it.", "fastapi_request_error")
+	ERR_FILE_NOT_FOUND                = NewError(404, "file_not_found", "The file does not exist or you do not have access to it.", "fastapi_request_error")
+	ERR_BATCH_NOT_FOUND               = NewError(404, "batch_not_found", "The batch does not exist or you do not have access to it.", "fastapi_request_error")
+	ERR_BATCH_CANNOT_CANCEL           = NewError(409, "batch_cannot_cancel", "Cannot cancel a batch that has already finished.", "fastapi_request_error")
 	ERR_INSUFFICIENT_QUOTA            = NewError(429, "insufficient_quota", "You exceeded your current quota.", "fastapi_request_error")
 	ERR_ACCOUNT_QUOTA_EXPIRED         = NewError(429, "account_quota_expired", "You account quota has expired.", "fastapi_request_error")
 	ERR_APP_QUOTA_EXPIRED             = NewError(429, "app_quota_expired", "You app quota has expired.", "fastapi_request_error")
 	ERR_KEY_QUOTA_EXPIRED             = NewError(429, "key_quota_expired", "You key quota has expired.", "fastapi_request_error")
+	ERR_MODEL_QUOTA_EXCEEDED          = NewError(429, "model_quota_exceeded", "You exceeded your current quota for this model.", "fastapi_request_error")
+	ERR_CONCURRENCY_QUEUE_FULL        = NewError(429, "concurrency_queue_full", "Too many concurrent requests, please try again later.", "fastapi_request_error")
+	ERR_CONCURRENCY_QUEUE_TIMEOUT     = NewError(429, "concurrency_queue_timeout", "Too many concurrent requests, waiting in queue timed out.", "fastapi_request_error")
+	ERR_RATE_LIMIT_REQUESTS           = NewError(429, "rate_limit_exceeded", "Rate limit reached for requests per min.", "requests")
+	ERR_RATE_LIMIT_TOKENS             = NewError(429, "rate_limit_exceeded", "Rate limit reached for tokens per min.", "tokens")
+	ERR_RATE_LIMIT_CONCURRENCY        = NewError(429, "rate_limit_exceeded", "Rate limit reached for concurrent requests.", "requests")
+	ERR_MODEL_AGENT_KEY_UNAVAILABLE   = NewError(503, "service_unavailable", "The service is temporarily unavailable, please try again later.", "fastapi_error")
 )
 
 func New(text string) error {
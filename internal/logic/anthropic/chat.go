@@ -23,7 +23,6 @@ import (
 	"github.com/iimeta/go-openai"
 	"github.com/iimeta/tiktoken-go"
 	"io"
-	"math"
 )
 
 type sAnthropic struct{}
@@ -49,6 +48,8 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 		mak    = &common.MAK{
 			Model:              params.Model,
 			Messages:           params.Messages,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
 		}
@@ -98,18 +99,6 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 					}
 
 					response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-				} else {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-				}
-
-				if response.Usage.CacheCreationInputTokens != 0 {
-					totalTokens += int(math.Ceil(float64(response.Usage.CacheCreationInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio * 1.25))
-				}
-
-				if response.Usage.CacheReadInputTokens != 0 {
-					totalTokens += int(math.Ceil(float64(response.Usage.CacheReadInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio * 0.1))
 				}
 
 			} else if mak.ReqModel.Type == 102 { // 多模态语音
@@ -129,7 +118,6 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 				}
 
 				response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-				totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
 
 			} else if response.Usage == nil || response.Usage.TotalTokens == 0 {
 
@@ -148,34 +136,22 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 		}
 
 		if mak.ReqModel != nil && response.Usage != nil {
-			if mak.ReqModel.Type == 102 {
 
-				if response.Usage.PromptTokensDetails != nil {
-					textTokens = int(math.Ceil(float64(response.Usage.PromptTokensDetails.TextTokens) * mak.ReqModel.MultimodalAudioQuota.TextQuota.PromptRatio))
-					audioTokens = int(math.Ceil(float64(response.Usage.PromptTokensDetails.AudioTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio))
-				} else {
-					audioTokens = int(math.Ceil(float64(response.Usage.PromptTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio))
-				}
+			pricingUsage := common.GetPricingUsage(response.Usage)
 
-				if response.Usage.CompletionTokensDetails != nil {
-					textTokens += int(math.Ceil(float64(response.Usage.CompletionTokensDetails.TextTokens) * mak.ReqModel.MultimodalAudioQuota.TextQuota.CompletionRatio))
-					audioTokens += int(math.Ceil(float64(response.Usage.CompletionTokensDetails.AudioTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					audioTokens += int(math.Ceil(float64(response.Usage.CompletionTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				}
-
-				totalTokens = textTokens + audioTokens
-
-			} else if mak.ReqModel.Type != 100 {
-				if mak.ReqModel.TextQuota.BillingMethod == 1 {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(response.Usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-				} else {
-					totalTokens = mak.ReqModel.TextQuota.FixedQuota
-				}
+			// 本地计算的多模态用量, 图像按图像额度单独计费
+			if imageTokens != 0 {
+				pricingUsage.PromptTokens = textTokens
+				pricingUsage.ImageQuota = imageTokens
 			}
+
+			totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -276,7 +252,7 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -296,29 +272,14 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Completions(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Completions(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Completions(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -338,6 +299,10 @@ func (s *sAnthropic) Completions(ctx context.Context, request *ghttp.Request, fa
 
 	response = convToChatCompletionResponse(g.RequestFromCtx(ctx).GetCtx(), res, false)
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -354,6 +319,8 @@ func (s *sAnthropic) CompletionsStream(ctx context.Context, request *ghttp.Reque
 		mak    = &common.MAK{
 			Model:              params.Model,
 			Messages:           params.Messages,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
 		}
@@ -407,62 +374,31 @@ func (s *sAnthropic) CompletionsStream(ctx context.Context, request *ghttp.Reque
 						usage.CompletionTokens += 388
 					}
 				}
+			}
 
-				if mak.ReqModel.Type == 100 { // 多模态
-
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-					if usage.CacheCreationInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheCreationInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio * 1.25))
-					}
-
-					if usage.CacheReadInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheReadInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio * 0.1))
-					}
+			if retryInfo == nil && usage != nil && mak.ReqModel != nil {
 
-				} else if mak.ReqModel.Type == 102 { // 多模态语音
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
+				if mak.ReqModel.Type != 100 && mak.ReqModel.Type != 102 && mak.ReqModel.TextQuota.BillingMethod == 2 {
+					usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
 				} else {
-					if mak.ReqModel.TextQuota.BillingMethod == 1 {
-						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-						totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-					} else {
-						usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
-						totalTokens = mak.ReqModel.TextQuota.FixedQuota
-					}
-				}
-
-			} else if retryInfo == nil && usage != nil && mak.ReqModel != nil {
-
-				if mak.ReqModel.Type == 100 { // 多模态
-
 					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-					if usage.CacheCreationInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheCreationInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio * 1.25))
-					}
+				}
 
-					if usage.CacheReadInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheReadInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio * 0.1))
-					}
+				pricingUsage := common.GetPricingUsage(usage)
 
-				} else if mak.ReqModel.Type == 102 { // 多模态语音
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					if mak.ReqModel.TextQuota.BillingMethod == 1 {
-						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-						totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-					} else {
-						usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
-						totalTokens = mak.ReqModel.TextQuota.FixedQuota
-					}
+				// 本地计算的多模态用量, 图像按图像额度单独计费
+				if imageTokens != 0 {
+					pricingUsage.PromptTokens = textTokens
+					pricingUsage.ImageQuota = imageTokens
 				}
+
+				totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
 			}
 
 			if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+				// 预占额度由记录使用额度随实际花费一并释放
+				service.Common().SettleQuota(ctx)
+
 				if err := grpool.Add(ctx, func(ctx context.Context) {
 					if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 						logger.Error(ctx, err)
@@ -555,7 +491,7 @@ func (s *sAnthropic) CompletionsStream(ctx context.Context, request *ghttp.Reque
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -575,29 +511,14 @@ func (s *sAnthropic) CompletionsStream(ctx context.Context, request *ghttp.Reque
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 				}
 
 				return err
@@ -660,13 +581,17 @@ func (s *sAnthropic) CompletionsStream(ctx context.Context, request *ghttp.Reque
 					return err
 				}
 
+				// 记录成功和延迟
+				service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+				service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, totalTime)
+
 				return nil
 			}
 
 			err = response.Error
 
 			// 记录错误次数和禁用
-			service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+			service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 			isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -682,33 +607,23 @@ func (s *sAnthropic) CompletionsStream(ctx context.Context, request *ghttp.Reque
 				}
 			}
 
+			// 已向客户端输出内容时不再重试, 避免重复输出
+			if isRetry && util.IsSSEFlushed(ctx) {
+				return err
+			}
+
 			if isRetry {
 
 				if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-					if mak.RealModel.IsEnableFallback {
-
-						if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-							if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-								retryInfo = &mcommon.Retry{
-									IsRetry:    true,
-									RetryCount: len(retry),
-									ErrMsg:     err.Error(),
-								}
-								return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-							}
-						}
-
-						if mak.RealModel.FallbackConfig.Model != "" {
-							if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-								retryInfo = &mcommon.Retry{
-									IsRetry:    true,
-									RetryCount: len(retry),
-									ErrMsg:     err.Error(),
-								}
-								return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-							}
+					// 按后备链切换模型代理或模型
+					if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+						retryInfo = &mcommon.Retry{
+							IsRetry:    true,
+							RetryCount: len(retry),
+							ErrMsg:     err.Error(),
 						}
+						return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 					}
 
 					return err
@@ -814,6 +729,11 @@ func convToChatCompletionRequest(request *ghttp.Request) sdkm.ChatCompletionRequ
 		}
 	}
 
+	user := ""
+	if anthropicChatCompletionReq.Metadata != nil {
+		user = anthropicChatCompletionReq.Metadata.UserId
+	}
+
 	if anthropicChatCompletionReq.System != nil {
 		messages = append([]sdkm.ChatCompletionMessage{{
 			Role:    consts.ROLE_SYSTEM,
@@ -831,6 +751,7 @@ func convToChatCompletionRequest(request *ghttp.Request) sdkm.ChatCompletionRequ
 		Tools:       anthropicChatCompletionReq.Tools,
 		TopK:        anthropicChatCompletionReq.TopK,
 		TopP:        anthropicChatCompletionReq.TopP,
+		User:        user,
 	}
 }
 
@@ -61,6 +61,10 @@ func (s *sApp) GetApp(ctx context.Context, appId int) (*model.App, error) {
 		Quota:          app.Quota,
 		UsedQuota:      app.UsedQuota,
 		QuotaExpiresAt: app.QuotaExpiresAt,
+		QuotaBudget:    app.QuotaBudget,
+		SoftLimit:      app.SoftLimit,
+		ModelQuota:     app.ModelQuota,
+		RateLimit:      app.RateLimit,
 		IpWhitelist:    app.IpWhitelist,
 		IpBlacklist:    app.IpBlacklist,
 		Remark:         app.Remark,
@@ -96,6 +100,10 @@ func (s *sApp) List(ctx context.Context) ([]*model.App, error) {
 			Quota:          result.Quota,
 			UsedQuota:      result.UsedQuota,
 			QuotaExpiresAt: result.QuotaExpiresAt,
+			QuotaBudget:    result.QuotaBudget,
+			SoftLimit:      result.SoftLimit,
+			ModelQuota:     result.ModelQuota,
+			RateLimit:      result.RateLimit,
 			IpWhitelist:    result.IpWhitelist,
 			IpBlacklist:    result.IpBlacklist,
 			Remark:         result.Remark,
@@ -245,6 +253,10 @@ func (s *sApp) UpdateCacheApp(ctx context.Context, app *entity.App) {
 		Quota:          app.Quota,
 		UsedQuota:      app.UsedQuota,
 		QuotaExpiresAt: app.QuotaExpiresAt,
+		QuotaBudget:    app.QuotaBudget,
+		SoftLimit:      app.SoftLimit,
+		ModelQuota:     app.ModelQuota,
+		RateLimit:      app.RateLimit,
 		IpWhitelist:    app.IpWhitelist,
 		IpBlacklist:    app.IpBlacklist,
 		Status:         app.Status,
@@ -405,6 +417,10 @@ func (s *sApp) UpdateCacheAppKey(ctx context.Context, key *entity.Key) {
 		QuotaExpiresRule:    key.QuotaExpiresRule,
 		QuotaExpiresAt:      key.QuotaExpiresAt,
 		QuotaExpiresMinutes: key.QuotaExpiresMinutes,
+		QuotaBudget:         key.QuotaBudget,
+		SoftLimit:           key.SoftLimit,
+		ModelQuota:          key.ModelQuota,
+		RateLimit:           key.RateLimit,
 		IpWhitelist:         key.IpWhitelist,
 		IpBlacklist:         key.IpBlacklist,
 		Status:              key.Status,
@@ -576,6 +592,20 @@ func (s *sApp) Subscribe(ctx context.Context, msg string) error {
 
 		s.UpdateCacheApp(ctx, app)
 
+	case consts.ACTION_QUOTA:
+
+		if err := gjson.Unmarshal(gjson.MustEncode(message.NewData), &app); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		s.UpdateCacheApp(ctx, app)
+
+		if err := s.SaveCacheAppQuota(ctx, app.AppId, app.Quota); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
 	case consts.ACTION_DELETE:
 
 		if err := gjson.Unmarshal(gjson.MustEncode(message.OldData), &app); err != nil {
@@ -615,6 +645,20 @@ func (s *sApp) SubscribeKey(ctx context.Context, msg string) error {
 
 		s.UpdateCacheAppKey(ctx, key)
 
+	case consts.ACTION_QUOTA:
+
+		if err := gjson.Unmarshal(gjson.MustEncode(message.NewData), &key); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		s.UpdateCacheAppKey(ctx, key)
+
+		if err := s.SaveCacheAppKeyQuota(ctx, key.Key, key.Quota); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
 	case consts.ACTION_DELETE:
 
 		if err := gjson.Unmarshal(gjson.MustEncode(message.OldData), &key); err != nil {
@@ -59,11 +59,10 @@ func (s *sAudio) Speech(ctx context.Context, params sdkm.SpeechRequest, fallback
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
 
-			if mak.ReqModel.AudioQuota.BillingMethod == 1 {
-				totalTokens = int(math.Ceil(float64(len(params.Input)) * mak.ReqModel.AudioQuota.PromptRatio))
-			} else {
-				totalTokens = mak.ReqModel.AudioQuota.FixedQuota
-			}
+			totalTokens = service.Pricing().Audio(ctx, mak.ReqModel.AudioQuota, &model.PricingUsage{PromptTokens: len(params.Input)})
+
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
 
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
@@ -121,7 +120,7 @@ func (s *sAudio) Speech(ctx context.Context, params sdkm.SpeechRequest, fallback
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -141,29 +140,14 @@ func (s *sAudio) Speech(ctx context.Context, params sdkm.SpeechRequest, fallback
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Speech(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Speech(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Speech(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -181,6 +165,10 @@ func (s *sAudio) Speech(ctx context.Context, params sdkm.SpeechRequest, fallback
 		return response, err
 	}
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -218,11 +206,10 @@ func (s *sAudio) Transcriptions(ctx context.Context, params *v1.TranscriptionsRe
 				response.Duration = params.Duration
 			}
 
-			if mak.ReqModel.AudioQuota.BillingMethod == 1 {
-				totalTokens = int(math.Ceil(minute * 1000 * mak.ReqModel.AudioQuota.CompletionRatio))
-			} else {
-				totalTokens = mak.ReqModel.AudioQuota.FixedQuota
-			}
+			totalTokens = service.Pricing().Audio(ctx, mak.ReqModel.AudioQuota, &model.PricingUsage{CompletionTokens: int(math.Ceil(minute * 1000))})
+
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
 
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
@@ -281,7 +268,7 @@ func (s *sAudio) Transcriptions(ctx context.Context, params *v1.TranscriptionsRe
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -301,29 +288,14 @@ func (s *sAudio) Transcriptions(ctx context.Context, params *v1.TranscriptionsRe
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Transcriptions(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Transcriptions(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Transcriptions(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -341,6 +313,10 @@ func (s *sAudio) Transcriptions(ctx context.Context, params *v1.TranscriptionsRe
 		return response, err
 	}
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -378,6 +354,8 @@ func (s *sAudio) SaveLog(ctx context.Context, reqModel, realModel *model.Model,
 		Host:         g.RequestFromCtx(ctx).GetHost(),
 	}
 
+	audio.QuotaCurrency = common.GetQuotaCurrency()
+
 	if reqModel != nil {
 		audio.Corp = reqModel.Corp
 		audio.ModelId = reqModel.Id
@@ -406,6 +384,7 @@ func (s *sAudio) SaveLog(ctx context.Context, reqModel, realModel *model.Model,
 				BaseUrl: realModel.ModelAgent.BaseUrl,
 				Path:    realModel.ModelAgent.Path,
 				Weight:  realModel.ModelAgent.Weight,
+				Cost:    realModel.ModelAgent.Cost,
 				Remark:  realModel.ModelAgent.Remark,
 				Status:  realModel.ModelAgent.Status,
 			}
@@ -430,6 +409,14 @@ func (s *sAudio) SaveLog(ctx context.Context, reqModel, realModel *model.Model,
 		audio.FallbackConfig.ModelName = fallbackModel.Name
 	}
 
+	if fallbacks := service.Session().GetFallbacks(ctx); len(fallbacks) > 0 {
+		audio.IsEnableFallback = true
+		if audio.FallbackConfig == nil {
+			audio.FallbackConfig = new(mcommon.FallbackConfig)
+		}
+		audio.FallbackConfig.Path = fallbacks
+	}
+
 	if key != nil {
 		audio.Key = key.Key
 	}
@@ -2,12 +2,20 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/grpool"
 	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"slices"
 )
 
 type sAuth struct{}
@@ -177,6 +185,8 @@ func (s *sAuth) VerifySecretKey(ctx context.Context, secretKey string) error {
 	service.Session().SaveUser(ctx, user)
 	service.Session().SaveIsLimitQuota(ctx, app.IsLimitQuota, key.IsLimitQuota)
 
+	s.checkSoftLimit(ctx, user, app, key)
+
 	if key.QuotaExpiresRule == 2 {
 		if err = service.App().UpdateAppKeyQuotaExpiresAt(ctx, key); err != nil {
 			logger.Error(ctx, err)
@@ -186,3 +196,144 @@ func (s *sAuth) VerifySecretKey(ctx context.Context, secretKey string) error {
 
 	return nil
 }
+
+// 核验模型额度上限, 模型确定后检查应用和应用密钥在该模型上的已用额度
+func (s *sAuth) VerifyModelQuota(ctx context.Context, m *model.Model) error {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sAuth VerifyModelQuota time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	usageKey := fmt.Sprintf(consts.API_USAGE_KEY, service.Session().GetUserId(ctx))
+	fields := make([]string, 0)
+
+	if app := service.Session().GetApp(ctx); app != nil && app.ModelQuota != nil && len(app.ModelQuota.Limits) > 0 {
+
+		modelField := func(modelId string) string {
+			return fmt.Sprintf(consts.APP_MODEL_USED_FIELD, app.AppId, modelId)
+		}
+		typeField := fmt.Sprintf(consts.APP_MODEL_TYPE_USED_FIELD, app.AppId, m.Type)
+
+		if err := checkModelQuota(ctx, usageKey, app.ModelQuota.Limits, m, modelField, typeField); err != nil {
+			return err
+		}
+
+		fields = append(fields, modelField(m.Id), typeField)
+	}
+
+	if key := service.Session().GetKey(ctx); key != nil && key.ModelQuota != nil && len(key.ModelQuota.Limits) > 0 {
+
+		modelField := func(modelId string) string {
+			return fmt.Sprintf(consts.KEY_MODEL_USED_FIELD, key.AppId, key.Key, modelId)
+		}
+		typeField := fmt.Sprintf(consts.KEY_MODEL_TYPE_USED_FIELD, key.AppId, key.Key, m.Type)
+
+		if err := checkModelQuota(ctx, usageKey, key.ModelQuota.Limits, m, modelField, typeField); err != nil {
+			return err
+		}
+
+		fields = append(fields, modelField(m.Id), typeField)
+	}
+
+	// 计费时按会话中的字段累加已用额度
+	service.Session().SaveModelQuotaFields(ctx, fields)
+
+	return nil
+}
+
+// 软限制检查, 超过软限制时继续放行, 返回警告响应头并发送通知, 优先级: 密钥 > 应用 > 用户
+func (s *sAuth) checkSoftLimit(ctx context.Context, user *model.User, app *model.App, key *model.Key) {
+
+	var (
+		typ       string
+		appId     int
+		appKey    string
+		quota     int
+		softLimit *mcommon.SoftLimit
+	)
+
+	if key.IsLimitQuota && key.SoftLimit != nil && key.SoftLimit.Quota > 0 {
+		if quota = service.App().GetCacheAppKeyQuota(ctx, key.Key); quota <= key.SoftLimit.Quota {
+			typ, appId, appKey, softLimit = consts.NOTICE_TYPE_APP_KEY, app.AppId, key.Key, key.SoftLimit
+		}
+	}
+
+	if softLimit == nil && app.IsLimitQuota && app.SoftLimit != nil && app.SoftLimit.Quota > 0 {
+		if quota = service.App().GetCacheAppQuota(ctx, app.AppId); quota <= app.SoftLimit.Quota {
+			typ, appId, softLimit = consts.NOTICE_TYPE_APP, app.AppId, app.SoftLimit
+		}
+	}
+
+	if softLimit == nil && user.SoftLimit != nil && user.SoftLimit.Quota > 0 {
+		if quota = service.User().GetCacheUserQuota(ctx, user.UserId); quota <= user.SoftLimit.Quota {
+			typ, softLimit = consts.NOTICE_TYPE_USER, user.SoftLimit
+		}
+	}
+
+	if softLimit == nil {
+		return
+	}
+
+	logger.Infof(ctx, "sAuth checkSoftLimit type: %s, userId: %d, appId: %d, quota: %d, softLimit: %d, targetModel: %s", typ, user.UserId, appId, quota, softLimit.Quota, softLimit.TargetModel)
+
+	service.Session().SaveSoftLimit(ctx, softLimit)
+
+	// 批处理请求没有响应对象
+	if r := g.RequestFromCtx(ctx); r != nil && r.Response != nil {
+		r.Response.Header().Set("x-quota-warning", "soft_limit_exceeded")
+	}
+
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+		service.Notice().SoftLimit(ctx, typ, user.UserId, appId, appKey, quota, softLimit)
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 检查模型额度上限, 配置了模型时按这些模型的已用额度之和计算, 否则按模型类型的已用额度计算
+func checkModelQuota(ctx context.Context, usageKey string, limits []*mcommon.ModelQuotaLimit, m *model.Model, modelField func(modelId string) string, typeField string) error {
+
+	for _, limit := range limits {
+
+		if limit.Quota <= 0 {
+			continue
+		}
+
+		fields := make([]string, 0)
+
+		if len(limit.Models) > 0 {
+
+			if !slices.Contains(limit.Models, m.Id) {
+				continue
+			}
+
+			for _, modelId := range limit.Models {
+				fields = append(fields, modelField(modelId))
+			}
+
+		} else if limit.Type == m.Type {
+			fields = append(fields, typeField)
+		} else {
+			continue
+		}
+
+		values, err := redis.HMGet(ctx, usageKey, fields...)
+		if err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		usedQuota := 0
+		for _, value := range values {
+			usedQuota += value.Int()
+		}
+
+		if usedQuota >= limit.Quota {
+			logger.Errorf(ctx, "sAuth checkModelQuota model: %s, usedQuota: %d, quota: %d", m.Model, usedQuota, limit.Quota)
+			return errors.ERR_MODEL_QUOTA_EXCEEDED
+		}
+	}
+
+	return nil
+}
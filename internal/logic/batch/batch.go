@@ -0,0 +1,258 @@
+package batch
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/container/gtype"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/db"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+type sBatch struct {
+	running *gtype.Int // 当前实例正在执行的批处理任务数
+}
+
+func init() {
+	service.RegisterBatch(New())
+}
+
+func New() service.IBatch {
+	return &sBatch{
+		running: gtype.NewInt(),
+	}
+}
+
+// 创建批处理
+func (s *sBatch) Create(ctx context.Context, params model.BatchCreateReq) (*model.BatchRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBatch Create time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if !common.GetBatchConfig().Open {
+		return nil, errors.ERR_BATCH_NOT_ENABLED
+	}
+
+	if params.Endpoint != consts.BATCH_ENDPOINT_CHAT_COMPLETIONS && params.Endpoint != consts.BATCH_ENDPOINT_EMBEDDINGS {
+		return nil, errors.NewErrorf(400, "invalid_endpoint", "Unsupported endpoint: %s, only %s and %s are supported.", "fastapi_request_error", params.Endpoint, consts.BATCH_ENDPOINT_CHAT_COMPLETIONS, consts.BATCH_ENDPOINT_EMBEDDINGS)
+	}
+
+	if params.CompletionWindow == "" {
+		params.CompletionWindow = "24h"
+	}
+
+	completionWindow, err := time.ParseDuration(params.CompletionWindow)
+	if err != nil || completionWindow <= 0 {
+		return nil, errors.NewErrorf(400, "invalid_completion_window", "Invalid completion_window: %s.", "fastapi_request_error", params.CompletionWindow)
+	}
+
+	if _, err = dao.File.FindOne(ctx, bson.M{"file_id": params.InputFileId, "user_id": service.Session().GetUserId(ctx), "purpose": consts.FILE_PURPOSE_BATCH}); err != nil {
+		logger.Error(ctx, err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.ERR_FILE_NOT_FOUND
+		}
+		return nil, err
+	}
+
+	createdAt := gtime.TimestampMilli()
+
+	batch := &do.Batch{
+		BatchId:          consts.BATCH_ID_PREFIX + util.GenerateId(),
+		TraceId:          gctx.CtxId(ctx),
+		UserId:           service.Session().GetUserId(ctx),
+		AppId:            service.Session().GetAppId(ctx),
+		SecretKey:        service.Session().GetSecretKey(ctx),
+		ClientIp:         g.RequestFromCtx(ctx).GetClientIp(),
+		Endpoint:         params.Endpoint,
+		InputFileId:      params.InputFileId,
+		CompletionWindow: params.CompletionWindow,
+		Status:           consts.BATCH_STATUS_VALIDATING,
+		RequestCounts:    &mcommon.BatchRequestCounts{},
+		Metadata:         params.Metadata,
+		ExpiresAt:        createdAt + completionWindow.Milliseconds(),
+		CreatedAt:        createdAt,
+	}
+
+	if _, err = dao.Batch.Insert(ctx, batch); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return s.Retrieve(ctx, batch.BatchId)
+}
+
+// 获取批处理
+func (s *sBatch) Retrieve(ctx context.Context, batchId string) (*model.BatchRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBatch Retrieve time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	batch, err := s.getBatch(ctx, batchId)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return convToBatchRes(batch), nil
+}
+
+// 取消批处理, 由执行任务的实例在当前一轮请求结束后完成取消
+func (s *sBatch) Cancel(ctx context.Context, batchId string) (*model.BatchRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBatch Cancel time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	batch, err := s.getBatch(ctx, batchId)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	switch batch.Status {
+	case consts.BATCH_STATUS_VALIDATING, consts.BATCH_STATUS_IN_PROGRESS:
+
+		// 按原状态更新, 避免覆盖并发完成的任务状态
+		if err = dao.Batch.UpdateOne(ctx, bson.M{"_id": batch.Id, "status": batch.Status}, bson.M{
+			"status":        consts.BATCH_STATUS_CANCELLING,
+			"cancelling_at": gtime.TimestampMilli(),
+		}); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+
+	case consts.BATCH_STATUS_CANCELLING:
+		return convToBatchRes(batch), nil
+
+	default:
+		return nil, errors.ERR_BATCH_CANNOT_CANCEL
+	}
+
+	return s.Retrieve(ctx, batchId)
+}
+
+// 批处理列表
+func (s *sBatch) List(ctx context.Context, params model.BatchListReq) (*model.BatchListRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBatch List time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	filter := bson.M{"user_id": service.Session().GetUserId(ctx)}
+
+	if params.After != "" {
+
+		after, err := s.getBatch(ctx, params.After)
+		if err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+
+		filter["created_at"] = bson.M{"$lt": after.CreatedAt}
+	}
+
+	if params.Limit <= 0 {
+		params.Limit = 20
+	}
+
+	paging := &db.Paging{
+		Page:     1,
+		PageSize: int64(params.Limit),
+	}
+
+	batches, err := dao.Batch.FindByPage(ctx, paging, filter, "-created_at")
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	res := &model.BatchListRes{
+		Object:  "list",
+		Data:    make([]*model.BatchRes, 0),
+		HasMore: paging.Total > int64(len(batches)),
+	}
+
+	for _, batch := range batches {
+		res.Data = append(res.Data, convToBatchRes(batch))
+	}
+
+	if len(res.Data) > 0 {
+		res.FirstId = res.Data[0].Id
+		res.LastId = res.Data[len(res.Data)-1].Id
+	}
+
+	return res, nil
+}
+
+// 获取当前用户的批处理记录
+func (s *sBatch) getBatch(ctx context.Context, batchId string) (*entity.Batch, error) {
+
+	batch, err := dao.Batch.FindOne(ctx, bson.M{"batch_id": batchId, "user_id": service.Session().GetUserId(ctx)})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.ERR_BATCH_NOT_FOUND
+		}
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// 转换成批处理对象, 时间为秒级时间戳
+func convToBatchRes(batch *entity.Batch) *model.BatchRes {
+
+	res := &model.BatchRes{
+		Id:               batch.BatchId,
+		Object:           consts.BATCH_OBJECT,
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     batch.OutputFileId,
+		ErrorFileId:      batch.ErrorFileId,
+		CreatedAt:        batch.CreatedAt / 1000,
+		InProgressAt:     batch.InProgressAt / 1000,
+		ExpiresAt:        batch.ExpiresAt / 1000,
+		FinalizingAt:     batch.FinalizingAt / 1000,
+		CompletedAt:      batch.CompletedAt / 1000,
+		FailedAt:         batch.FailedAt / 1000,
+		ExpiredAt:        batch.ExpiredAt / 1000,
+		CancellingAt:     batch.CancellingAt / 1000,
+		CancelledAt:      batch.CancelledAt / 1000,
+		RequestCounts:    batch.RequestCounts,
+		Metadata:         batch.Metadata,
+	}
+
+	if res.RequestCounts == nil {
+		res.RequestCounts = &mcommon.BatchRequestCounts{}
+	}
+
+	if len(batch.Errors) > 0 {
+		res.Errors = &model.BatchErrors{
+			Object: "list",
+			Data:   batch.Errors,
+		}
+	}
+
+	return res
+}
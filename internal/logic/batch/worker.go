@@ -0,0 +1,612 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gredis"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/gfile"
+	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/util/gconv"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"github.com/iimeta/fastapi/utility/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// 任务锁时长(秒), 每轮请求结束后续期, 实例异常退出时由其它实例接续执行
+const lockTTL int64 = 600
+
+// 调度待执行的批处理任务, 每个任务通过锁保证同一时间只由一个实例执行
+func (s *sBatch) Dispatch(ctx context.Context) error {
+
+	batchConfig := common.GetBatchConfig()
+
+	if !batchConfig.Open || s.running.Val() >= batchConfig.Workers {
+		return nil
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBatch Dispatch time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	batches, err := dao.Batch.Find(ctx, bson.M{"status": bson.M{"$in": []string{
+		consts.BATCH_STATUS_VALIDATING,
+		consts.BATCH_STATUS_IN_PROGRESS,
+		consts.BATCH_STATUS_FINALIZING,
+		consts.BATCH_STATUS_CANCELLING,
+	}}}, "created_at")
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, batch := range batches {
+
+		if s.running.Val() >= batchConfig.Workers {
+			break
+		}
+
+		ttl := lockTTL
+		lockKey := fmt.Sprintf(consts.LOCK_BATCH_KEY, batch.BatchId)
+
+		reply, err := redis.Set(ctx, lockKey, gtime.TimestampMilli(), gredis.SetOption{
+			TTLOption: gredis.TTLOption{EX: &ttl},
+			NX:        true,
+		})
+		if err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		if reply.IsEmpty() {
+			continue
+		}
+
+		s.running.Add(1)
+
+		if err = grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+
+			defer func() {
+				s.running.Add(-1)
+				if _, err := redis.Del(ctx, lockKey); err != nil {
+					logger.Error(ctx, err)
+				}
+			}()
+
+			s.process(ctx, batch, lockKey)
+
+		}, nil); err != nil {
+			logger.Error(ctx, err)
+			s.running.Add(-1)
+			if _, err = redis.Del(ctx, lockKey); err != nil {
+				logger.Error(ctx, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// 执行批处理任务, 按轮并发执行输入文件中的请求, 每轮结束后记录进度
+func (s *sBatch) process(ctx context.Context, batch *entity.Batch, lockKey string) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBatch process batchId: %s, time: %d", batch.BatchId, gtime.TimestampMilli()-now)
+	}()
+
+	logger.Infof(ctx, "sBatch process batchId: %s, status: %s, offset: %d", batch.BatchId, batch.Status, batch.Offset)
+
+	switch batch.Status {
+	case consts.BATCH_STATUS_CANCELLING:
+		s.finalize(ctx, batch, consts.BATCH_STATUS_CANCELLED)
+		return
+	case consts.BATCH_STATUS_FINALIZING:
+		s.finalize(ctx, batch, consts.BATCH_STATUS_COMPLETED)
+		return
+	}
+
+	if gtime.TimestampMilli() >= batch.ExpiresAt {
+		s.finalize(ctx, batch, consts.BATCH_STATUS_EXPIRED)
+		return
+	}
+
+	requests, batchErrors, err := s.readInput(ctx, batch)
+	if err != nil {
+		logger.Error(ctx, err)
+		s.fail(ctx, batch, []*mcommon.BatchError{{Code: "invalid_file", Message: "Failed to read the input file."}})
+		return
+	}
+
+	if batch.Status == consts.BATCH_STATUS_VALIDATING {
+
+		if len(batchErrors) > 0 {
+			s.fail(ctx, batch, batchErrors)
+			return
+		}
+
+		batch.Status = consts.BATCH_STATUS_IN_PROGRESS
+		batch.InProgressAt = gtime.TimestampMilli()
+		batch.RequestCounts = &mcommon.BatchRequestCounts{Total: len(requests)}
+
+		if err = dao.Batch.UpdateOne(ctx, bson.M{"_id": batch.Id, "status": consts.BATCH_STATUS_VALIDATING}, bson.M{
+			"status":         batch.Status,
+			"in_progress_at": batch.InProgressAt,
+			"request_counts": batch.RequestCounts,
+		}); err != nil {
+			logger.Error(ctx, err)
+			return
+		}
+	}
+
+	if batch.RequestCounts == nil {
+		batch.RequestCounts = &mcommon.BatchRequestCounts{Total: len(requests)}
+	}
+
+	batchConfig := common.GetBatchConfig()
+
+	for batch.Offset < len(requests) {
+
+		if status := s.checkStatus(ctx, batch); status != "" {
+			s.finalize(ctx, batch, status)
+			return
+		}
+
+		end := min(batch.Offset+batchConfig.Concurrency, len(requests))
+
+		outputs, ok := s.executeRound(ctx, batch, requests[batch.Offset:end])
+		if !ok {
+			continue
+		}
+
+		for _, output := range outputs {
+
+			path := getFilePath(batch, "output")
+			if output.Response == nil || output.Response.StatusCode != http.StatusOK {
+				path = getFilePath(batch, "error")
+				batch.RequestCounts.Failed++
+			} else {
+				batch.RequestCounts.Completed++
+			}
+
+			if err = gfile.PutContentsAppend(path, gjson.MustEncodeString(output)+"\n"); err != nil {
+				logger.Error(ctx, err)
+			}
+		}
+
+		batch.Offset = end
+
+		// 中断后从已记录的进度接续执行, 进度记录前中断的一轮请求会重新执行
+		if err = dao.Batch.UpdateById(ctx, batch.Id, bson.M{
+			"offset":         batch.Offset,
+			"request_counts": batch.RequestCounts,
+		}); err != nil {
+			logger.Error(ctx, err)
+		}
+
+		if _, err = redis.Expire(ctx, lockKey, lockTTL); err != nil {
+			logger.Error(ctx, err)
+		}
+
+		if batchConfig.Interval > 0 {
+			time.Sleep(time.Duration(batchConfig.Interval) * time.Millisecond)
+		}
+	}
+
+	s.finalize(ctx, batch, consts.BATCH_STATUS_COMPLETED)
+}
+
+// 并发执行一轮请求, 触发限流的请求退避后重试, 避免批处理挤占实时请求的速率限制
+func (s *sBatch) executeRound(ctx context.Context, batch *entity.Batch, requests []*model.BatchRequestInput) ([]*model.BatchRequestOutput, bool) {
+
+	outputs := make([]*model.BatchRequestOutput, len(requests))
+
+	pending := make([]int, 0, len(requests))
+	for i := range requests {
+		pending = append(pending, i)
+	}
+
+	for {
+
+		var wg sync.WaitGroup
+
+		for _, i := range pending {
+
+			wg.Add(1)
+
+			// 预置错误结果, 执行异常时作为该请求的结果
+			outputs[i] = newErrorOutput(requests[i], "internal_error", "Internal Error.")
+
+			if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+				defer wg.Done()
+				outputs[i] = s.execute(ctx, batch, requests[i])
+			}, func(ctx context.Context, err error) {
+				logger.Error(ctx, err)
+			}); err != nil {
+				logger.Error(ctx, err)
+				wg.Done()
+			}
+		}
+
+		wg.Wait()
+
+		retry := make([]int, 0)
+		for _, i := range pending {
+			if isRateLimited(outputs[i]) {
+				retry = append(retry, i)
+			}
+		}
+
+		if len(retry) == 0 {
+			return outputs, true
+		}
+
+		backoffTime := common.GetBatchConfig().BackoffTime
+
+		logger.Infof(ctx, "sBatch executeRound batchId: %s, rate limited: %d, backoff: %ds", batch.BatchId, len(retry), backoffTime)
+
+		time.Sleep(time.Duration(backoffTime) * time.Second)
+
+		if s.checkStatus(ctx, batch) != "" {
+			return nil, false
+		}
+
+		pending = retry
+	}
+}
+
+// 执行单个请求, 以提交密钥的身份直接调用对话或向量服务, 复用鉴权、限流、计费和日志
+func (s *sBatch) execute(ctx context.Context, batch *entity.Batch, request *model.BatchRequestInput) *model.BatchRequestOutput {
+
+	// 批处理不支持流式输出
+	delete(request.Body, "stream")
+	delete(request.Body, "stream_options")
+
+	// 每个请求使用独立的日志ID, 并标记批处理ID用于折扣计费
+	httpRequest, err := http.NewRequestWithContext(context.WithValue(gctx.New(), consts.BATCH_ID_KEY, batch.BatchId), http.MethodPost, batch.Endpoint, nil)
+	if err != nil {
+		logger.Error(ctx, err)
+		return newErrorOutput(request, "internal_error", "Internal Error.")
+	}
+
+	if batch.ClientIp != "" {
+		httpRequest.RemoteAddr = batch.ClientIp + ":0"
+	}
+
+	// 会话数据保存在请求对象中, 批处理请求不经过路由, 构造请求对象注入上下文
+	r := &ghttp.Request{
+		Request:   httpRequest,
+		EnterTime: gtime.Now(),
+	}
+
+	reqCtx := r.GetCtx()
+
+	output := &model.BatchRequestOutput{
+		Id:       consts.BATCH_REQUEST_ID_PREFIX + util.GenerateId(),
+		CustomId: request.CustomId,
+		Response: &model.BatchResponse{
+			StatusCode: http.StatusOK,
+			RequestId:  gctx.CtxId(reqCtx),
+		},
+	}
+
+	defer func() {
+		// 释放请求占用的并发数
+		service.Concurrency().Release(reqCtx)
+		// 释放未进入记录使用额度(出错或无花费)的请求的预占额度
+		service.Common().ReleaseQuota(reqCtx)
+	}()
+
+	if output.Response.Body, err = s.call(reqCtx, batch, request); err != nil {
+		err := errors.Error(reqCtx, err)
+		output.Response.StatusCode = err.Status()
+		output.Response.Body = err
+	}
+
+	// 统一为JSON对象, 便于写入结果文件及判断错误码
+	if err = gjson.Unmarshal(gjson.MustEncode(output.Response.Body), &output.Response.Body); err != nil {
+		logger.Error(reqCtx, err)
+	}
+
+	return output
+}
+
+// 鉴权并按批处理的接口调用对应服务
+func (s *sBatch) call(ctx context.Context, batch *entity.Batch, request *model.BatchRequestInput) (any, error) {
+
+	if err := service.Auth().Authenticator(ctx, batch.SecretKey); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	if err := service.RateLimit().Limit(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	switch batch.Endpoint {
+	case consts.BATCH_ENDPOINT_CHAT_COMPLETIONS:
+
+		params := sdkm.ChatCompletionRequest{}
+		if err := gjson.Unmarshal(gjson.MustEncode(request.Body), &params); err != nil {
+			logger.Error(ctx, err)
+			return nil, errors.ERR_INVALID_PARAMETER
+		}
+
+		return service.Chat().Completions(ctx, params, nil, nil)
+
+	case consts.BATCH_ENDPOINT_EMBEDDINGS:
+
+		params := sdkm.EmbeddingRequest{}
+		if err := gjson.Unmarshal(gjson.MustEncode(request.Body), &params); err != nil {
+			logger.Error(ctx, err)
+			return nil, errors.ERR_INVALID_PARAMETER
+		}
+
+		return service.Embedding().Embeddings(ctx, params, nil, nil)
+	}
+
+	return nil, errors.ERR_NOT_FOUND
+}
+
+// 读取并校验输入文件, 返回所有请求和校验错误
+func (s *sBatch) readInput(ctx context.Context, batch *entity.Batch) ([]*model.BatchRequestInput, []*mcommon.BatchError, error) {
+
+	file, err := dao.File.FindOne(ctx, bson.M{"file_id": batch.InputFileId, "user_id": batch.UserId})
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, nil, err
+	}
+
+	f, err := os.Open(file.FilePath)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, nil, err
+	}
+
+	defer func() {
+		if err := f.Close(); err != nil {
+			logger.Error(ctx, err)
+		}
+	}()
+
+	var (
+		batchConfig = common.GetBatchConfig()
+		requests    = make([]*model.BatchRequestInput, 0)
+		batchErrors = make([]*mcommon.BatchError, 0)
+		customIds   = make(map[string]bool)
+		scanner     = bufio.NewScanner(f)
+		line        = 0
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), int(batchConfig.MaxFileSize))
+
+	for scanner.Scan() {
+
+		line++
+
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		request := new(model.BatchRequestInput)
+		if err = gjson.Unmarshal(scanner.Bytes(), &request); err != nil {
+			batchErrors = append(batchErrors, &mcommon.BatchError{Code: "invalid_json_line", Message: "This line is not parseable as valid JSON.", Line: line})
+			continue
+		}
+
+		switch {
+		case request.CustomId == "":
+			batchErrors = append(batchErrors, &mcommon.BatchError{Code: "missing_custom_id", Message: "The custom_id is required.", Line: line})
+		case customIds[request.CustomId]:
+			batchErrors = append(batchErrors, &mcommon.BatchError{Code: "duplicate_custom_id", Message: fmt.Sprintf("The custom_id %s is duplicated.", request.CustomId), Line: line})
+		case request.Method != http.MethodPost:
+			batchErrors = append(batchErrors, &mcommon.BatchError{Code: "invalid_method", Message: "The method must be POST.", Line: line})
+		case request.Url != batch.Endpoint:
+			batchErrors = append(batchErrors, &mcommon.BatchError{Code: "mismatched_url", Message: fmt.Sprintf("The url must be %s to match the batch endpoint.", batch.Endpoint), Line: line})
+		case gconv.String(request.Body["model"]) == "":
+			batchErrors = append(batchErrors, &mcommon.BatchError{Code: "missing_required_parameter", Message: "The body.model is required.", Line: line})
+		}
+
+		customIds[request.CustomId] = true
+		requests = append(requests, request)
+	}
+
+	if err = scanner.Err(); err != nil {
+		logger.Error(ctx, err)
+		return nil, nil, err
+	}
+
+	if len(requests) == 0 && len(batchErrors) == 0 {
+		batchErrors = append(batchErrors, &mcommon.BatchError{Code: "empty_file", Message: "The input file contains no requests."})
+	}
+
+	if len(requests) > batchConfig.MaxRequests {
+		batchErrors = append(batchErrors, &mcommon.BatchError{Code: "too_many_requests", Message: fmt.Sprintf("The input file can contain at most %d requests.", batchConfig.MaxRequests)})
+	}
+
+	// 只保留前100个错误, 避免错误过多
+	if len(batchErrors) > 100 {
+		batchErrors = batchErrors[:100]
+	}
+
+	return requests, batchErrors, nil
+}
+
+// 检查任务是否已取消或过期, 返回需要结束的状态
+func (s *sBatch) checkStatus(ctx context.Context, batch *entity.Batch) string {
+
+	if gtime.TimestampMilli() >= batch.ExpiresAt {
+		return consts.BATCH_STATUS_EXPIRED
+	}
+
+	current, err := dao.Batch.FindById(ctx, batch.Id)
+	if err != nil {
+		logger.Error(ctx, err)
+		return ""
+	}
+
+	if current.Status == consts.BATCH_STATUS_CANCELLING {
+		return consts.BATCH_STATUS_CANCELLED
+	}
+
+	return ""
+}
+
+// 校验失败
+func (s *sBatch) fail(ctx context.Context, batch *entity.Batch, batchErrors []*mcommon.BatchError) {
+
+	logger.Infof(ctx, "sBatch fail batchId: %s, errors: %s", batch.BatchId, gjson.MustEncodeString(batchErrors))
+
+	if err := dao.Batch.UpdateById(ctx, batch.Id, bson.M{
+		"status":    consts.BATCH_STATUS_FAILED,
+		"errors":    batchErrors,
+		"failed_at": gtime.TimestampMilli(),
+	}); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 结束批处理任务, 生成输出文件和错误文件, 取消或过期时未执行的请求写入错误文件
+func (s *sBatch) finalize(ctx context.Context, batch *entity.Batch, status string) {
+
+	logger.Infof(ctx, "sBatch finalize batchId: %s, status: %s", batch.BatchId, status)
+
+	now := gtime.TimestampMilli()
+
+	update := bson.M{"status": status}
+
+	switch status {
+	case consts.BATCH_STATUS_COMPLETED:
+
+		if batch.Status != consts.BATCH_STATUS_FINALIZING {
+			if err := dao.Batch.UpdateById(ctx, batch.Id, bson.M{
+				"status":        consts.BATCH_STATUS_FINALIZING,
+				"finalizing_at": now,
+			}); err != nil {
+				logger.Error(ctx, err)
+			}
+		}
+
+		update["completed_at"] = now
+
+	case consts.BATCH_STATUS_CANCELLED:
+		update["cancelled_at"] = now
+	case consts.BATCH_STATUS_EXPIRED:
+		update["expired_at"] = now
+	}
+
+	if slices.Contains([]string{consts.BATCH_STATUS_CANCELLED, consts.BATCH_STATUS_EXPIRED}, status) && batch.InProgressAt != 0 {
+
+		code, message := "batch_cancelled", "This request could not be executed before the batch was cancelled."
+		if status == consts.BATCH_STATUS_EXPIRED {
+			code, message = "batch_expired", "This request could not be executed before the completion window expired."
+		}
+
+		if requests, _, err := s.readInput(ctx, batch); err != nil {
+			logger.Error(ctx, err)
+		} else {
+			for _, request := range requests[min(batch.Offset, len(requests)):] {
+				if err = gfile.PutContentsAppend(getFilePath(batch, "error"), gjson.MustEncodeString(newErrorOutput(request, code, message))+"\n"); err != nil {
+					logger.Error(ctx, err)
+				}
+			}
+		}
+	}
+
+	if batch.OutputFileId == "" {
+		if fileId := s.saveFile(ctx, batch, "output"); fileId != "" {
+			update["output_file_id"] = fileId
+		}
+	}
+
+	if batch.ErrorFileId == "" {
+		if fileId := s.saveFile(ctx, batch, "error"); fileId != "" {
+			update["error_file_id"] = fileId
+		}
+	}
+
+	if err := dao.Batch.UpdateById(ctx, batch.Id, update); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 保存结果文件记录, 文件不存在时返回空
+func (s *sBatch) saveFile(ctx context.Context, batch *entity.Batch, typ string) string {
+
+	path := getFilePath(batch, typ)
+	if !gfile.Exists(path) {
+		return ""
+	}
+
+	file := &do.File{
+		FileId:   consts.FILE_ID_PREFIX + util.GenerateId(),
+		TraceId:  batch.TraceId,
+		UserId:   batch.UserId,
+		AppId:    batch.AppId,
+		Purpose:  consts.FILE_PURPOSE_BATCH_OUTPUT,
+		Filename: gfile.Basename(path),
+		Bytes:    gfile.Size(path),
+		FilePath: path,
+		Status:   consts.FILE_STATUS_PROCESSED,
+		Creator:  batch.SecretKey,
+	}
+
+	if _, err := dao.File.Insert(ctx, file); err != nil {
+		logger.Error(ctx, err)
+		return ""
+	}
+
+	return file.FileId
+}
+
+// 获取结果文件路径, typ[output:输出文件, error:错误文件]
+func getFilePath(batch *entity.Batch, typ string) string {
+	return gfile.Join(common.GetBatchConfig().FileDir, fmt.Sprintf("%s_%s.jsonl", batch.BatchId, typ))
+}
+
+// 是否触发了限流, 额度不足等其它429错误不重试
+func isRateLimited(output *model.BatchRequestOutput) bool {
+
+	if output == nil || output.Response == nil || output.Response.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+
+	code := gjson.New(output.Response.Body).Get("error.code").String()
+
+	return code == "rate_limit_exceeded" || code == "concurrency_queue_full" || code == "concurrency_queue_timeout"
+}
+
+// 生成未执行请求的错误结果
+func newErrorOutput(request *model.BatchRequestInput, code, message string) *model.BatchRequestOutput {
+	return &model.BatchRequestOutput{
+		Id:       consts.BATCH_REQUEST_ID_PREFIX + util.GenerateId(),
+		CustomId: request.CustomId,
+		Error: &model.BatchResponseError{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
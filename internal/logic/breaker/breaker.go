@@ -0,0 +1,398 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/cache"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"github.com/iimeta/fastapi/utility/util"
+	"strings"
+)
+
+// 熔断器状态保存在 api:breaker:{类型} 哈希中, 字段为 {ID}.state/{ID}.failures/{ID}.successes/{ID}.probes/{ID}.opened_at
+// 状态变更均通过Lua脚本原子执行, 脚本返回 {原状态, 新状态[, 是否放行]}
+const (
+	// ARGV: ID, 当前时间, 连续失败熔断次数
+	failureScript = `
+local id = ARGV[1]
+local state = redis.call('HGET', KEYS[1], id .. '.state') or 'closed'
+if state == 'open' then
+	return {state, state}
+end
+if state == 'half_open' then
+	redis.call('HSET', KEYS[1], id .. '.state', 'open', id .. '.opened_at', ARGV[2], id .. '.failures', 0, id .. '.successes', 0, id .. '.probes', 0)
+	return {state, 'open'}
+end
+local failures = redis.call('HINCRBY', KEYS[1], id .. '.failures', 1)
+if failures >= tonumber(ARGV[3]) then
+	redis.call('HSET', KEYS[1], id .. '.state', 'open', id .. '.opened_at', ARGV[2], id .. '.failures', 0)
+	return {state, 'open'}
+end
+return {state, state}
+`
+	// ARGV: ID, 半开状态恢复所需成功次数
+	successScript = `
+local id = ARGV[1]
+local state = redis.call('HGET', KEYS[1], id .. '.state') or 'closed'
+if state == 'closed' then
+	redis.call('HDEL', KEYS[1], id .. '.failures')
+	return {state, state}
+end
+if state == 'half_open' then
+	local successes = redis.call('HINCRBY', KEYS[1], id .. '.successes', 1)
+	if successes >= tonumber(ARGV[2]) then
+		redis.call('HDEL', KEYS[1], id .. '.state', id .. '.opened_at', id .. '.failures', id .. '.successes', id .. '.probes')
+		return {state, 'closed'}
+	end
+	if tonumber(redis.call('HGET', KEYS[1], id .. '.probes') or 0) > 0 then
+		redis.call('HINCRBY', KEYS[1], id .. '.probes', -1)
+	end
+end
+return {state, state}
+`
+	// ARGV: ID, 当前时间, 熔断冷却时长(毫秒), 半开状态并发探测数
+	acquireScript = `
+local id = ARGV[1]
+local now = tonumber(ARGV[2])
+local state = redis.call('HGET', KEYS[1], id .. '.state') or 'closed'
+if state == 'closed' then
+	return {state, state, 1}
+end
+local openedAt = tonumber(redis.call('HGET', KEYS[1], id .. '.opened_at') or 0)
+if state == 'open' then
+	if now - openedAt < tonumber(ARGV[3]) then
+		return {state, state, 0}
+	end
+	redis.call('HSET', KEYS[1], id .. '.state', 'half_open', id .. '.opened_at', now, id .. '.successes', 0, id .. '.probes', 1)
+	return {state, 'half_open', 1}
+end
+if tonumber(redis.call('HGET', KEYS[1], id .. '.probes') or 0) >= tonumber(ARGV[4]) then
+	if now - openedAt < tonumber(ARGV[3]) then
+		return {state, state, 0}
+	end
+	redis.call('HSET', KEYS[1], id .. '.opened_at', now, id .. '.probes', 0)
+end
+redis.call('HINCRBY', KEYS[1], id .. '.probes', 1)
+return {state, state, 1}
+`
+	// ARGV: ID
+	releaseScript = `
+local id = ARGV[1]
+local state = redis.call('HGET', KEYS[1], id .. '.state') or 'closed'
+if state == 'half_open' and tonumber(redis.call('HGET', KEYS[1], id .. '.probes') or 0) > 0 then
+	redis.call('HINCRBY', KEYS[1], id .. '.probes', -1)
+end
+return {state, state}
+`
+)
+
+type sBreaker struct {
+	breakerCache *cache.Cache // [类型:ID]熔断器状态
+}
+
+func init() {
+
+	ctx := gctx.New()
+	sBreaker := New()
+
+	service.RegisterBreaker(sBreaker)
+	if err := sBreaker.Load(ctx); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+func New() service.IBreaker {
+	return &sBreaker{
+		breakerCache: cache.New(),
+	}
+}
+
+// 加载熔断器状态
+func (s *sBreaker) Load(ctx context.Context) error {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBreaker Load time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	breakers := make(map[string]*model.Breaker)
+	for _, typ := range []string{consts.BREAKER_TYPE_MODEL_KEY, consts.BREAKER_TYPE_MODEL_AGENT, consts.BREAKER_TYPE_MODEL_AGENT_KEY} {
+
+		reply, err := redis.HGetAll(ctx, fmt.Sprintf(consts.BREAKER_KEY, typ))
+		if err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		fields := reply.MapStrVar()
+		for field, value := range fields {
+			if id, ok := strings.CutSuffix(field, ".state"); ok {
+				breakers[typ+":"+id] = &model.Breaker{
+					Type:     typ,
+					Id:       id,
+					State:    value.String(),
+					OpenedAt: fields[id+".opened_at"].Int64(),
+				}
+			}
+		}
+	}
+
+	if err := s.breakerCache.Clear(ctx); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, breaker := range breakers {
+		s.setBreaker(ctx, breaker)
+	}
+
+	return nil
+}
+
+// 是否放行, 半开状态放行的请求为探测请求, 未实际使用时需调用Release释放
+func (s *sBreaker) Allow(ctx context.Context, typ, id string) (isAllow bool, isProbe bool) {
+
+	cfg := getConfig()
+	if !cfg.Open {
+		return true, false
+	}
+
+	breaker := s.getBreaker(ctx, typ, id)
+	if breaker == nil || breaker.State == consts.BREAKER_STATE_CLOSED {
+		return true, false
+	}
+
+	now := gtime.TimestampMilli()
+	if breaker.State == consts.BREAKER_STATE_OPEN && now-breaker.OpenedAt < cfg.CoolDown*1000 {
+		return false, false
+	}
+
+	reply, err := s.eval(ctx, acquireScript, typ, id, now, cfg.CoolDown*1000, cfg.HalfOpenRequests)
+	if err != nil {
+		logger.Error(ctx, err)
+		return false, false
+	}
+
+	s.transition(ctx, typ, id, breaker.State, reply[0], reply[1], now)
+
+	if len(reply) < 3 || gconv.Int(reply[2]) != 1 {
+		return false, false
+	}
+
+	return true, reply[1] != consts.BREAKER_STATE_CLOSED
+}
+
+// 释放探测请求
+func (s *sBreaker) Release(ctx context.Context, typ string, ids ...string) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBreaker Release time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	for _, id := range ids {
+		if _, err := s.eval(ctx, releaseScript, typ, id); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+}
+
+// 记录成功
+func (s *sBreaker) RecordSuccess(ctx context.Context, typ, id string) {
+
+	cfg := getConfig()
+	if !cfg.Open {
+		return
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBreaker RecordSuccess time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	reply, err := s.eval(ctx, successScript, typ, id, cfg.SuccessThreshold)
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	s.transition(ctx, typ, id, s.GetState(ctx, typ, id), reply[0], reply[1], now)
+}
+
+// 记录失败
+func (s *sBreaker) RecordFailure(ctx context.Context, typ, id string) {
+
+	cfg := getConfig()
+	if !cfg.Open {
+		return
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sBreaker RecordFailure time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	reply, err := s.eval(ctx, failureScript, typ, id, now, cfg.FailureThreshold)
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	s.transition(ctx, typ, id, s.GetState(ctx, typ, id), reply[0], reply[1], now)
+}
+
+// 获取熔断器状态
+func (s *sBreaker) GetState(ctx context.Context, typ, id string) string {
+
+	if breaker := s.getBreaker(ctx, typ, id); breaker != nil {
+		return breaker.State
+	}
+
+	return consts.BREAKER_STATE_CLOSED
+}
+
+// 是否开启熔断器
+func (s *sBreaker) IsOpen() bool {
+	return getConfig().Open
+}
+
+// 变更订阅
+func (s *sBreaker) Subscribe(ctx context.Context, msg string) error {
+
+	breaker := new(model.Breaker)
+	if err := gjson.Unmarshal([]byte(msg), &breaker); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	logger.Infof(ctx, "sBreaker Subscribe: %s", msg)
+
+	s.setBreaker(ctx, breaker)
+
+	return nil
+}
+
+// 状态变更, 同步本地状态, 由实际执行变更的实例负责发布和记录
+func (s *sBreaker) transition(ctx context.Context, typ, id, localState, fromState, toState string, openedAt int64) {
+
+	if localState != toState {
+		s.setBreaker(ctx, &model.Breaker{
+			Type:     typ,
+			Id:       id,
+			State:    toState,
+			OpenedAt: openedAt,
+		})
+	}
+
+	if fromState == toState {
+		return
+	}
+
+	breaker := &model.Breaker{
+		Type:      typ,
+		Id:        id,
+		FromState: fromState,
+		State:     toState,
+		OpenedAt:  openedAt,
+	}
+
+	logger.Infof(ctx, "sBreaker transition type: %s, id: %s, %s -> %s", typ, id, fromState, toState)
+
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+
+		if _, err := redis.Publish(ctx, consts.CHANGE_CHANNEL_BREAKER, gjson.MustEncodeString(breaker)); err != nil {
+			logger.Error(ctx, err)
+		}
+
+		if _, err := dao.BreakerLog.Insert(ctx, &do.BreakerLog{
+			Type:      typ,
+			TargetId:  id,
+			FromState: fromState,
+			ToState:   toState,
+			Host:      util.GetLocalIp(),
+		}); err != nil {
+			logger.Error(ctx, err)
+		}
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+func (s *sBreaker) getBreaker(ctx context.Context, typ, id string) *model.Breaker {
+
+	if breakerValue := s.breakerCache.GetVal(ctx, typ+":"+id); breakerValue != nil {
+		return breakerValue.(*model.Breaker)
+	}
+
+	return nil
+}
+
+func (s *sBreaker) setBreaker(ctx context.Context, breaker *model.Breaker) {
+
+	if breaker.State == consts.BREAKER_STATE_CLOSED {
+		if _, err := s.breakerCache.Remove(ctx, breaker.Type+":"+breaker.Id); err != nil {
+			logger.Error(ctx, err)
+		}
+		return
+	}
+
+	if err := s.breakerCache.Set(ctx, breaker.Type+":"+breaker.Id, breaker, 0); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+func (s *sBreaker) eval(ctx context.Context, script, typ, id string, args ...interface{}) ([]string, error) {
+
+	reply, err := redis.Eval(ctx, script, 1, []string{fmt.Sprintf(consts.BREAKER_KEY, typ)}, append([]interface{}{id}, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	result := reply.Strings()
+	if len(result) < 2 {
+		return nil, fmt.Errorf("breaker script invalid reply: %s", reply.String())
+	}
+
+	return result, nil
+}
+
+// 获取熔断器配置, 未配置的参数使用默认值
+func getConfig() common.CircuitBreaker {
+
+	if config.Cfg.CircuitBreaker == nil {
+		return common.CircuitBreaker{}
+	}
+
+	cfg := *config.Cfg.CircuitBreaker
+
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 60
+	}
+
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = 1
+	}
+
+	return cfg
+}
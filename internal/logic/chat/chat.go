@@ -21,18 +21,20 @@ import (
 	mcommon "github.com/iimeta/fastapi/internal/model/common"
 	"github.com/iimeta/fastapi/internal/model/do"
 	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/cache"
+	"github.com/iimeta/fastapi/utility/lb"
 	"github.com/iimeta/fastapi/utility/logger"
 	"github.com/iimeta/fastapi/utility/util"
 	"github.com/iimeta/tiktoken-go"
 	"io"
-	"math"
 	"slices"
 	"sync"
 	"time"
 )
 
 type sChat struct {
-	mutex sync.Mutex
+	mutex              sync.Mutex
+	latencyWindowCache *cache.Cache // [模型ID]最近延迟窗口
 }
 
 func init() {
@@ -40,7 +42,9 @@ func init() {
 }
 
 func New() service.IChat {
-	return &sChat{}
+	return &sChat{
+		latencyWindowCache: cache.New(),
+	}
 }
 
 // Completions
@@ -62,6 +66,9 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 		mak = &common.MAK{
 			Model:              params.Model,
 			Messages:           params.Messages,
+			Tools:              params.Tools,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
 		}
@@ -71,6 +78,8 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 		imageTokens int
 		audioTokens int
 		totalTokens int
+		isSearch    bool
+		isHedge     bool
 	)
 
 	defer func() {
@@ -110,27 +119,15 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 					}
 
 					response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-				} else {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
 				}
 
 				if params.Tools != nil {
 					if tools := gconv.String(params.Tools); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
-						totalTokens += mak.ReqModel.MultimodalQuota.SearchQuota
+						isSearch = true
 						response.Usage.SearchTokens = mak.ReqModel.MultimodalQuota.SearchQuota
 					}
 				}
 
-				if response.Usage.CacheCreationInputTokens != 0 {
-					totalTokens += int(math.Ceil(float64(response.Usage.CacheCreationInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio * 1.25))
-				}
-
-				if response.Usage.CacheReadInputTokens != 0 {
-					totalTokens += int(math.Ceil(float64(response.Usage.CacheReadInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio * 0.1))
-				}
-
 			} else if mak.ReqModel.Type == 102 { // 多模态语音
 
 				if response.Usage == nil {
@@ -148,7 +145,6 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 				}
 
 				response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-				totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
 
 			} else if response.Usage == nil || response.Usage.TotalTokens == 0 {
 
@@ -167,34 +163,24 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 		}
 
 		if mak.ReqModel != nil && response.Usage != nil {
-			if mak.ReqModel.Type == 102 {
 
-				if response.Usage.PromptTokensDetails != nil {
-					textTokens = int(math.Ceil(float64(response.Usage.PromptTokensDetails.TextTokens) * mak.ReqModel.MultimodalAudioQuota.TextQuota.PromptRatio))
-					audioTokens = int(math.Ceil(float64(response.Usage.PromptTokensDetails.AudioTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio))
-				} else {
-					audioTokens = int(math.Ceil(float64(response.Usage.PromptTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio))
-				}
+			pricingUsage := common.GetPricingUsage(response.Usage)
 
-				if response.Usage.CompletionTokensDetails != nil {
-					textTokens += int(math.Ceil(float64(response.Usage.CompletionTokensDetails.TextTokens) * mak.ReqModel.MultimodalAudioQuota.TextQuota.CompletionRatio))
-					audioTokens += int(math.Ceil(float64(response.Usage.CompletionTokensDetails.AudioTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					audioTokens += int(math.Ceil(float64(response.Usage.CompletionTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				}
+			// 本地计算的多模态用量, 图像按图像额度单独计费
+			if imageTokens != 0 {
+				pricingUsage.PromptTokens = textTokens
+				pricingUsage.ImageQuota = imageTokens
+			}
 
-				totalTokens = textTokens + audioTokens
+			pricingUsage.IsSearch = isSearch
 
-			} else if mak.ReqModel.Type != 100 {
-				if mak.ReqModel.TextQuota.BillingMethod == 1 {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(response.Usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-				} else {
-					totalTokens = mak.ReqModel.TextQuota.FixedQuota
-				}
-			}
+			totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -217,6 +203,7 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 					TotalTime:    response.TotalTime,
 					InternalTime: internalTime,
 					EnterTime:    enterTime,
+					IsHedge:      isHedge,
 				}
 
 				if retryInfo == nil && response.Usage != nil {
@@ -290,12 +277,17 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 		return response, err
 	}
 
-	response, err = client.ChatCompletion(ctx, request)
+	if mak.RealModel.IsEnableHedge && len(retry) == 0 {
+		// 对冲请求
+		response, isHedge, err = s.hedgeCompletions(ctx, params, request, mak, client, fallbackModelAgent, fallbackModel)
+	} else {
+		response, err = client.ChatCompletion(ctx, request)
+	}
 	if err != nil {
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -315,29 +307,14 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Completions(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Completions(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Completions(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -355,6 +332,14 @@ func (s *sChat) Completions(ctx context.Context, params sdkm.ChatCompletionReque
 		return response, err
 	}
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
+	if mak.RealModel.IsEnableHedge {
+		s.getLatencyWindow(ctx, mak.RealModel.Id).Record(response.TotalTime)
+	}
+
 	return response, nil
 }
 
@@ -377,6 +362,9 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 		mak = &common.MAK{
 			Model:              params.Model,
 			Messages:           params.Messages,
+			Tools:              params.Tools,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
 		}
@@ -391,6 +379,8 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 		totalTokens int
 		usage       *sdkm.Usage
 		retryInfo   *mcommon.Retry
+		isSearch    bool
+		isToolCalls bool
 	)
 
 	defer func() {
@@ -430,76 +420,43 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 						usage.CompletionTokens += 388
 					}
 				}
+			}
 
-				if mak.ReqModel.Type == 100 { // 多模态
-
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-					if params.Tools != nil {
-						if tools := gconv.String(params.Tools); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
-							totalTokens += mak.ReqModel.MultimodalQuota.SearchQuota
-							usage.SearchTokens = mak.ReqModel.MultimodalQuota.SearchQuota
-						}
-					}
-
-					if usage.CacheCreationInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheCreationInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio * 1.25))
-					}
+			if retryInfo == nil && usage != nil && mak.ReqModel != nil {
 
-					if usage.CacheReadInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheReadInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio * 0.1))
-					}
+				// 流式续写前失败请求已输出的补全令牌数
+				usage.CompletionTokens += service.Session().GetResumeTokens(ctx)
 
-				} else if mak.ReqModel.Type == 102 { // 多模态语音
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					if mak.ReqModel.TextQuota.BillingMethod == 1 {
-						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-						totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-					} else {
-						usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
-						totalTokens = mak.ReqModel.TextQuota.FixedQuota
+				if mak.ReqModel.Type == 100 && params.Tools != nil { // 多模态
+					if tools := gconv.String(params.Tools); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
+						isSearch = true
+						usage.SearchTokens = mak.ReqModel.MultimodalQuota.SearchQuota
 					}
 				}
 
-			} else if retryInfo == nil && usage != nil && mak.ReqModel != nil {
-
-				if mak.ReqModel.Type == 100 { // 多模态
-
+				if mak.ReqModel.Type != 100 && mak.ReqModel.Type != 102 && mak.ReqModel.TextQuota.BillingMethod == 2 {
+					usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
+				} else {
 					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
+				}
 
-					if params.Tools != nil {
-						if tools := gconv.String(params.Tools); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
-							totalTokens += mak.ReqModel.MultimodalQuota.SearchQuota
-							usage.SearchTokens = mak.ReqModel.MultimodalQuota.SearchQuota
-						}
-					}
+				pricingUsage := common.GetPricingUsage(usage)
 
-					if usage.CacheCreationInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheCreationInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio * 1.25))
-					}
+				// 本地计算的多模态用量, 图像按图像额度单独计费
+				if imageTokens != 0 {
+					pricingUsage.PromptTokens = textTokens
+					pricingUsage.ImageQuota = imageTokens
+				}
 
-					if usage.CacheReadInputTokens != 0 {
-						totalTokens += int(math.Ceil(float64(usage.CacheReadInputTokens) * mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio * 0.1))
-					}
+				pricingUsage.IsSearch = isSearch
 
-				} else if mak.ReqModel.Type == 102 { // 多模态语音
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					if mak.ReqModel.TextQuota.BillingMethod == 1 {
-						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-						totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-					} else {
-						usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
-						totalTokens = mak.ReqModel.TextQuota.FixedQuota
-					}
-				}
+				totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
 			}
 
 			if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+				// 预占额度由记录使用额度随实际花费一并释放
+				service.Common().SettleQuota(ctx)
+
 				if err := grpool.Add(ctx, func(ctx context.Context) {
 					if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 						logger.Error(ctx, err)
@@ -592,7 +549,7 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -612,29 +569,14 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 				}
 
 				return err
@@ -695,13 +637,17 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 					return err
 				}
 
+				// 记录成功和延迟
+				service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+				service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, totalTime)
+
 				return nil
 			}
 
 			err = response.Error
 
 			// 记录错误次数和禁用
-			service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+			service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 			isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -717,33 +663,33 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 				}
 			}
 
-			if isRetry {
+			// 已向客户端输出内容时, 仅在启用流式续写且可续写时重试, 并将已输出的部分回复追加到消息中续写, 否则直接返回错误, 避免重复输出
+			if isRetry && util.IsSSEFlushed(ctx) {
+				if !mak.ReqModel.IsEnableStreamResume || isToolCalls || params.N > 1 || mak.RealModel.Type == 102 {
+					return err
+				}
+				params.Messages = common.ResumeMessages(params.Messages, completion)
 
-				if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
+				// 已输出的部分回复作为续写请求的提示词计费, 其补全令牌数累加到最终用量中
+				model := mak.ReqModel.Model
+				if !tiktoken.IsEncodingForModel(model) {
+					model = consts.DEFAULT_MODEL
+				}
+				service.Session().AddResumeTokens(ctx, common.GetCompletionTokens(ctx, model, completion))
+			}
 
-					if mak.RealModel.IsEnableFallback {
+			if isRetry {
 
-						if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-							if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-								retryInfo = &mcommon.Retry{
-									IsRetry:    true,
-									RetryCount: len(retry),
-									ErrMsg:     err.Error(),
-								}
-								return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-							}
-						}
+				if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-						if mak.RealModel.FallbackConfig.Model != "" {
-							if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-								retryInfo = &mcommon.Retry{
-									IsRetry:    true,
-									RetryCount: len(retry),
-									ErrMsg:     err.Error(),
-								}
-								return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-							}
+					// 按后备链切换模型代理或模型
+					if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+						retryInfo = &mcommon.Retry{
+							IsRetry:    true,
+							RetryCount: len(retry),
+							ErrMsg:     err.Error(),
 						}
+						return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 					}
 
 					return err
@@ -776,6 +722,7 @@ func (s *sChat) CompletionsStream(ctx context.Context, params sdkm.ChatCompletio
 		}
 
 		if len(response.Choices) > 0 && response.Choices[0].Delta != nil && len(response.Choices[0].Delta.ToolCalls) > 0 {
+			isToolCalls = true
 			completion += response.Choices[0].Delta.ToolCalls[0].Function.Arguments
 		}
 
@@ -857,6 +804,7 @@ func (s *sChat) SaveLog(ctx context.Context, reqModel, realModel *model.Model, f
 		UserId:       service.Session().GetUserId(ctx),
 		AppId:        service.Session().GetAppId(ctx),
 		IsSmartMatch: isSmartMatch,
+		IsHedge:      completionsRes.IsHedge,
 		Stream:       completionsReq.Stream,
 		ConnTime:     completionsRes.ConnTime,
 		Duration:     completionsRes.Duration,
@@ -966,6 +914,7 @@ func (s *sChat) SaveLog(ctx context.Context, reqModel, realModel *model.Model, f
 				BaseUrl: realModel.ModelAgent.BaseUrl,
 				Path:    realModel.ModelAgent.Path,
 				Weight:  realModel.ModelAgent.Weight,
+				Cost:    realModel.ModelAgent.Cost,
 				Remark:  realModel.ModelAgent.Remark,
 				Status:  realModel.ModelAgent.Status,
 			}
@@ -975,9 +924,10 @@ func (s *sChat) SaveLog(ctx context.Context, reqModel, realModel *model.Model, f
 	chat.PromptTokens = completionsRes.Usage.PromptTokens
 	chat.CompletionTokens = completionsRes.Usage.CompletionTokens
 	chat.TotalTokens = completionsRes.Usage.TotalTokens
+	chat.QuotaCurrency = common.GetQuotaCurrency()
 	chat.SearchTokens = completionsRes.Usage.SearchTokens
 	chat.CacheWriteTokens = completionsRes.Usage.CacheCreationInputTokens
-	chat.CacheHitTokens = completionsRes.Usage.CacheReadInputTokens
+	chat.CacheHitTokens = common.GetCacheReadTokens(&completionsRes.Usage)
 
 	if fallbackModelAgent != nil {
 		chat.IsEnableFallback = true
@@ -996,6 +946,14 @@ func (s *sChat) SaveLog(ctx context.Context, reqModel, realModel *model.Model, f
 		chat.FallbackConfig.ModelName = fallbackModel.Name
 	}
 
+	if fallbacks := service.Session().GetFallbacks(ctx); len(fallbacks) > 0 {
+		chat.IsEnableFallback = true
+		if chat.FallbackConfig == nil {
+			chat.FallbackConfig = new(mcommon.FallbackConfig)
+		}
+		chat.FallbackConfig.Path = fallbacks
+	}
+
 	if key != nil {
 		chat.Key = key.Key
 	}
@@ -1081,3 +1039,167 @@ func (s *sChat) SaveLog(ctx context.Context, reqModel, realModel *model.Model, f
 		s.SaveLog(ctx, reqModel, realModel, fallbackModelAgent, fallbackModel, key, completionsReq, completionsRes, retryInfo, isSmartMatch, retry...)
 	}
 }
+
+const (
+	hedgeWindowSize = 100 // 对冲延迟统计窗口大小
+	hedgeMinSamples = 20  // 使用P95作为对冲延迟时所需的最少样本数
+)
+
+type hedgeResult struct {
+	mak      *common.MAK
+	response sdkm.ChatCompletionResponse
+	err      error
+}
+
+// 对冲请求, 原请求超过对冲延迟未返回时向不同的模型代理或密钥再发起一次请求, 采用先成功返回的结果并取消另一个
+func (s *sChat) hedgeCompletions(ctx context.Context, params, request sdkm.ChatCompletionRequest, mak *common.MAK, client sdk.Client, fallbackModelAgent *model.ModelAgent, fallbackModel *model.Model) (response sdkm.ChatCompletionResponse, isHedge bool, err error) {
+
+	delay := s.hedgeDelay(ctx, mak.RealModel)
+	if delay <= 0 || (mak.AgentTotal <= 1 && mak.KeyTotal <= 1) {
+		response, err = client.ChatCompletion(ctx, request)
+		return response, false, err
+	}
+
+	results := make(chan *hedgeResult, 2)
+
+	primaryMak := *mak
+	primaryCtx, primaryCancel := context.WithCancel(ctx)
+	defer primaryCancel()
+
+	go func() {
+		response, err := client.ChatCompletion(primaryCtx, request)
+		results <- &hedgeResult{mak: &primaryMak, response: response, err: err}
+	}()
+
+	timer := time.NewTimer(time.Duration(delay) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		return result.response, false, result.err
+	case <-timer.C:
+	}
+
+	hedgeMak, hedgeClient, hedgeRequest, err := s.newHedgeClient(ctx, request, mak)
+	if err != nil {
+		logger.Error(ctx, err)
+		result := <-results
+		return result.response, false, result.err
+	}
+
+	logger.Infof(ctx, "sChat hedgeCompletions model: %s, delay: %d, key: %s -> %s", mak.RealModel.Model, delay, mak.Key.Id, hedgeMak.Key.Id)
+
+	hedgeCtx, hedgeCancel := context.WithCancel(ctx)
+	defer hedgeCancel()
+
+	go func() {
+		response, err := hedgeClient.ChatCompletion(hedgeCtx, hedgeRequest)
+		results <- &hedgeResult{mak: hedgeMak, response: response, err: err}
+	}()
+
+	winner := <-results
+
+	if winner.err != nil {
+
+		// 先返回的请求失败, 等待另一个请求
+		loser := winner
+		winner = <-results
+
+		// 均失败时以原请求为准, 继续走重试和后备逻辑
+		if winner.err != nil && winner.mak != &primaryMak {
+			winner, loser = loser, winner
+		}
+
+		s.saveHedgeLog(ctx, params, loser, fallbackModelAgent, fallbackModel)
+
+	} else {
+		// 取消未采用的请求并等待其返回, 会话只在请求协程中修改
+		primaryCancel()
+		hedgeCancel()
+		s.saveHedgeLog(ctx, params, <-results, fallbackModelAgent, fallbackModel)
+	}
+
+	// 以采用的请求进行计费和记录日志
+	*mak = *winner.mak
+
+	return winner.response, true, winner.err
+}
+
+// 创建对冲请求客户端, 从已解析的模型中挑选与原请求不同的模型代理或密钥
+func (s *sChat) newHedgeClient(ctx context.Context, request sdkm.ChatCompletionRequest, mak *common.MAK) (*common.MAK, sdk.Client, sdkm.ChatCompletionRequest, error) {
+
+	hedgeMak, err := mak.Hedge(ctx)
+	if err != nil {
+		return nil, nil, request, err
+	}
+
+	client, err := common.NewClient(ctx, hedgeMak.Corp, hedgeMak.RealModel, hedgeMak.RealKey, hedgeMak.BaseUrl, hedgeMak.Path)
+	if err != nil {
+		return nil, nil, request, err
+	}
+
+	return hedgeMak, client, request, nil
+}
+
+// 保存对冲请求中未采用的请求日志, 不计费, 需在请求协程中调用
+func (s *sChat) saveHedgeLog(ctx context.Context, params sdkm.ChatCompletionRequest, result *hedgeResult, fallbackModelAgent *model.ModelAgent, fallbackModel *model.Model) {
+
+	err := result.err
+	if err == nil {
+		err = errors.New("hedged request discarded")
+	} else if !common.IsAborted(err) {
+		// 记录错误次数和禁用
+		service.Common().RecordError(ctx, result.mak.RealModel, result.mak.Key, result.mak.ModelAgent, err)
+	}
+
+	enterTime := g.RequestFromCtx(ctx).EnterTime.TimestampMilli()
+
+	if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
+
+		result.mak.RealModel.ModelAgent = result.mak.ModelAgent
+
+		completionsRes := &model.CompletionsRes{
+			Error:     err,
+			ConnTime:  result.response.ConnTime,
+			Duration:  result.response.Duration,
+			TotalTime: result.response.TotalTime,
+			EnterTime: enterTime,
+			IsHedge:   true,
+		}
+
+		s.SaveLog(ctx, result.mak.ReqModel, result.mak.RealModel, fallbackModelAgent, fallbackModel, result.mak.Key, &params, completionsRes, nil, false)
+
+	}); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 对冲延迟, 未配置时取最近延迟的P95
+func (s *sChat) hedgeDelay(ctx context.Context, m *model.Model) int64 {
+
+	if m.HedgeConfig != nil && m.HedgeConfig.Delay > 0 {
+		return m.HedgeConfig.Delay
+	}
+
+	window := s.getLatencyWindow(ctx, m.Id)
+	if window.Len() < hedgeMinSamples {
+		return 0
+	}
+
+	return window.Percentile(0.95)
+}
+
+// 获取最近延迟窗口
+func (s *sChat) getLatencyWindow(ctx context.Context, id string) *lb.Window {
+
+	reply, err := s.latencyWindowCache.GetOrSetFuncLock(ctx, id, func(ctx context.Context) (interface{}, error) {
+		return lb.NewWindow(hedgeWindowSize), nil
+	}, 0)
+
+	if err != nil || reply == nil {
+		logger.Error(ctx, err)
+		return lb.NewWindow(hedgeWindowSize)
+	}
+
+	return reply.Val().(*lb.Window)
+}
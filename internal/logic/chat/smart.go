@@ -16,7 +16,6 @@ import (
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
 	"github.com/iimeta/tiktoken-go"
-	"math"
 )
 
 // SmartCompletions
@@ -31,6 +30,8 @@ func (s *sChat) SmartCompletions(ctx context.Context, params sdkm.ChatCompletion
 		mak = &common.MAK{
 			Model:              reqModel.Model,
 			Messages:           params.Messages,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			ReqModel:           reqModel,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
@@ -73,10 +74,6 @@ func (s *sChat) SmartCompletions(ctx context.Context, params sdkm.ChatCompletion
 					}
 
 					response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.RealModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.RealModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-				} else {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.RealModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.RealModel.MultimodalQuota.TextQuota.CompletionRatio))
 				}
 
 			} else if response.Usage == nil || response.Usage.TotalTokens == 0 {
@@ -94,13 +91,16 @@ func (s *sChat) SmartCompletions(ctx context.Context, params sdkm.ChatCompletion
 		}
 
 		if mak.RealModel != nil && response.Usage != nil {
-			if mak.RealModel.Type != 100 {
-				if mak.RealModel.TextQuota.BillingMethod == 1 {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.RealModel.TextQuota.PromptRatio + float64(response.Usage.CompletionTokens)*mak.RealModel.TextQuota.CompletionRatio))
-				} else {
-					totalTokens = mak.RealModel.TextQuota.FixedQuota
-				}
+
+			pricingUsage := common.GetPricingUsage(response.Usage)
+
+			// 本地计算的多模态用量, 图像按图像额度单独计费
+			if imageTokens != 0 {
+				pricingUsage.PromptTokens = textTokens
+				pricingUsage.ImageQuota = imageTokens
 			}
+
+			totalTokens = service.Pricing().Chat(ctx, mak.RealModel, pricingUsage)
 		}
 
 		if mak.RealModel != nil {
@@ -195,29 +195,14 @@ func (s *sChat) SmartCompletions(ctx context.Context, params sdkm.ChatCompletion
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.SmartCompletions(g.RequestFromCtx(ctx).GetCtx(), params, reqModel, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.SmartCompletions(g.RequestFromCtx(ctx).GetCtx(), params, reqModel, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.SmartCompletions(g.RequestFromCtx(ctx).GetCtx(), params, reqModel, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"github.com/iimeta/fastapi/internal/config"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+)
+
+// 批处理配置, 未配置的项使用默认值
+func GetBatchConfig() *mcommon.Batch {
+
+	batch := mcommon.Batch{}
+	if config.Cfg.Batch != nil {
+		batch = *config.Cfg.Batch
+	}
+
+	if batch.Workers <= 0 {
+		batch.Workers = 1
+	}
+
+	if batch.Concurrency <= 0 {
+		batch.Concurrency = 5
+	}
+
+	if batch.BackoffTime <= 0 {
+		batch.BackoffTime = 30
+	}
+
+	if batch.MaxRequests <= 0 {
+		batch.MaxRequests = 50000
+	}
+
+	if batch.MaxFileSize <= 0 {
+		batch.MaxFileSize = 100 * 1024 * 1024
+	}
+
+	if batch.FileDir == "" {
+		batch.FileDir = "./resource/batch/"
+	}
+
+	return &batch
+}
@@ -2,13 +2,20 @@ package common
 
 import (
 	"context"
+	"github.com/gogf/gf/v2/text/gstr"
 	"github.com/iimeta/fastapi-sdk"
 	"github.com/iimeta/fastapi-sdk/anthropic"
 	"github.com/iimeta/fastapi-sdk/google"
 	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/model"
 	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/cache"
 	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/go-openai"
+	"net/http"
+	"time"
 )
 
 func NewClient(ctx context.Context, corp string, model *model.Model, key, baseURL, path string) (sdk.Client, error) {
@@ -44,6 +51,56 @@ func NewRealtimeClient(ctx context.Context, model *model.Model, key, baseURL, pa
 	return sdk.NewRealtimeClient(ctx, model.Model, key, baseURL, path, config.Cfg.Http.ProxyUrl), nil
 }
 
+// 文本补全HTTP客户端, [上游地址:代理地址]HTTP客户端, 相同上游地址和代理复用连接池
+var completionHttpClients = cache.New()
+
+// 原生文本补全客户端, 仅支持OpenAI和Azure格式的上游
+func NewCompletionClient(ctx context.Context, corp string, model *model.Model, key, baseURL, path string) (*openai.Client, error) {
+
+	logger.Infof(ctx, "NewCompletionClient model: %s, baseURL: %s, key: %s", model.Model, baseURL, key)
+
+	cfg := openai.DefaultConfig(key)
+
+	switch GetCorpCode(ctx, corp) {
+	case consts.CORP_OPENAI:
+		if baseURL != "" {
+			cfg.BaseURL = baseURL
+		}
+	case consts.CORP_AZURE:
+
+		cfg = openai.DefaultAzureConfig(key, baseURL)
+
+		if split := gstr.Split(path, "?api-version="); len(split) > 1 && split[1] != "" {
+			cfg.APIVersion = split[1]
+		}
+
+	default:
+		return nil, errors.ERR_UNSUPPORTED_COMPLETIONS
+	}
+
+	clientKey := cfg.BaseURL + ":" + config.Cfg.Http.ProxyUrl
+
+	if httpClientValue := completionHttpClients.GetVal(ctx, clientKey); httpClientValue != nil {
+		cfg.HTTPClient = httpClientValue.(*http.Client)
+		return openai.NewClientWithConfig(cfg), nil
+	}
+
+	transport, err := newUpstreamTransport(config.Cfg.Http.ProxyUrl, config.Cfg.Http.Timeout*time.Second)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	httpClient := &http.Client{Transport: transport}
+	if err = completionHttpClients.Set(ctx, clientKey, httpClient, 0); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	cfg.HTTPClient = httpClient
+
+	return openai.NewClientWithConfig(cfg), nil
+}
+
 func GetCorpCode(ctx context.Context, corpId string) string {
 
 	corp, err := service.Corp().GetCacheCorp(ctx, corpId)
@@ -11,7 +11,9 @@ import (
 	"github.com/gogf/gf/v2/text/gstr"
 	"github.com/gogf/gf/v2/util/gconv"
 	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi-sdk/sdkerr"
 	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/model"
 	"github.com/iimeta/fastapi/internal/service"
@@ -55,7 +57,29 @@ func (s *sCommon) ParseSecretKey(ctx context.Context, secretKey string) (int, in
 }
 
 // 记录错误次数和禁用
-func (s *sCommon) RecordError(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent) {
+func (s *sCommon) RecordError(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent, err error) {
+
+	// 出错后请求会切换到其他密钥或模型代理, 立即释放占用的并发数
+	if key != nil {
+		service.Concurrency().ReleaseLease(ctx, consts.CONCURRENCY_TYPE_KEY, key.Id)
+	}
+
+	if modelAgent != nil {
+		service.Concurrency().ReleaseLease(ctx, consts.CONCURRENCY_TYPE_MODEL_AGENT, modelAgent.Id)
+	}
+
+	// 限流错误只让密钥进入冷却, 不计入错误次数
+	if key != nil && service.Cooldown().IsOpen() && IsRateLimit(err) {
+		service.Session().RecordErrorKey(ctx, key.Id)
+		// 上游响应头需在异步前获取
+		header := GetUpstreamHeader(ctx)
+		if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+			service.Cooldown().Cooldown(ctx, key.Id, header, err)
+		}, nil); err != nil {
+			logger.Error(ctx, err)
+		}
+		return
+	}
 
 	if modelAgent != nil {
 		service.Session().RecordErrorModelAgent(ctx, modelAgent.Id)
@@ -77,18 +101,77 @@ func (s *sCommon) RecordError(ctx context.Context, model *model.Model, key *mode
 	}
 }
 
+// 记录成功, 请求成功时显式调用, 熔断器据此关闭半开状态和重置失败计数
+func (s *sCommon) RecordSuccess(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent) {
+
+	if model == nil || key == nil {
+		return
+	}
+
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+		if model.IsEnableModelAgent && modelAgent != nil {
+			service.Breaker().RecordSuccess(ctx, consts.BREAKER_TYPE_MODEL_AGENT_KEY, key.Id)
+			service.Breaker().RecordSuccess(ctx, consts.BREAKER_TYPE_MODEL_AGENT, modelAgent.Id)
+		} else {
+			service.Breaker().RecordSuccess(ctx, consts.BREAKER_TYPE_MODEL_KEY, key.Id)
+		}
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 记录延迟, 流式和非流式请求均记录总耗时, 同一延迟统计的口径一致
+func (s *sCommon) RecordLatency(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent, latency int64) {
+
+	if model == nil || key == nil {
+		return
+	}
+
+	header := GetUpstreamHeader(ctx)
+
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+
+		// 限额已耗尽时提前冷却, 避免下一个请求触发上游限流
+		service.Cooldown().CheckRemaining(ctx, key.Id, header)
+
+		if model.IsEnableModelAgent && modelAgent != nil {
+			service.ModelAgent().RecordLatencyModelAgentKey(ctx, modelAgent, key, latency)
+			service.ModelAgent().RecordLatencyModelAgent(ctx, model, modelAgent, latency)
+		} else {
+			service.Key().RecordLatencyModelKey(ctx, model, key, latency)
+		}
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
 func IsAborted(err error) bool {
 	return errors.Is(err, context.Canceled) ||
 		gstr.Contains(err.Error(), "broken pipe") ||
 		gstr.Contains(err.Error(), "aborted")
 }
 
+// 是否为上游限流错误, 额度不足不属于限流
+func IsRateLimit(err error) bool {
+
+	if err == nil || errors.Is(err, sdkerr.ERR_INSUFFICIENT_QUOTA) || gstr.Contains(err.Error(), "insufficient_quota") {
+		return false
+	}
+
+	return errors.Is(err, sdkerr.ERR_RATE_LIMIT_EXCEEDED) || gstr.Contains(err.Error(), "status code: 429")
+}
+
 func IsNeedRetry(err error) (isRetry bool, isDisabled bool) {
 
 	if IsAborted(err) {
 		return false, false
 	}
 
+	// 限流错误, 重试其它密钥, 不自动禁用
+	if service.Cooldown().IsOpen() && IsRateLimit(err) {
+		return true, false
+	}
+
 	// 自动禁用错误
 	if config.Cfg.AutoDisabledError.Open && len(config.Cfg.AutoDisabledError.Errors) > 0 {
 		for _, autoDisabledError := range config.Cfg.AutoDisabledError.Errors {
@@ -144,6 +227,29 @@ func HandleMessages(messages []sdkm.ChatCompletionMessage) []sdkm.ChatCompletion
 	return newMessages
 }
 
+// 续写消息, 将已输出的部分回复作为助手消息追加到末尾, 末尾已是助手消息时(如上次续写)拼接到其内容后
+func ResumeMessages(messages []sdkm.ChatCompletionMessage, partial string) []sdkm.ChatCompletionMessage {
+
+	if partial == "" {
+		return messages
+	}
+
+	newMessages := make([]sdkm.ChatCompletionMessage, len(messages))
+	copy(newMessages, messages)
+
+	if last := len(newMessages) - 1; last >= 0 && newMessages[last].Role == consts.ROLE_ASSISTANT {
+		if content, ok := newMessages[last].Content.(string); ok {
+			newMessages[last].Content = content + partial
+			return newMessages
+		}
+	}
+
+	return append(newMessages, sdkm.ChatCompletionMessage{
+		Role:    consts.ROLE_ASSISTANT,
+		Content: partial,
+	})
+}
+
 func CheckIp(ctx context.Context, ipWhitelist, ipBlacklist []string) error {
 
 	clientIp := g.RequestFromCtx(ctx).GetClientIp()
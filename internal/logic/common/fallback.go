@@ -0,0 +1,172 @@
+package common
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/text/gregex"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/iimeta/fastapi-sdk/sdkerr"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"slices"
+)
+
+// 获取下一个后备目标, 按后备链顺序跳过已尝试、不满足触发条件和不可用的步骤, 命中的步骤记录到会话的后备路径中
+func NextFallback(ctx context.Context, mak *MAK, err error) (fallbackModelAgent *model.ModelAgent, fallbackModel *model.Model, isFallback bool) {
+
+	// 后备路径保存在请求会话中, 无请求时不后备, 避免重复尝试
+	if g.RequestFromCtx(ctx) == nil || mak.RealModel == nil {
+		return nil, nil, false
+	}
+
+	// 后备链以请求模型为准, 请求模型未启用后备时使用实际模型(如转发后的目标模型)
+	m := mak.ReqModel
+	if m == nil || !m.IsEnableFallback {
+		m = mak.RealModel
+	}
+
+	path := service.Session().GetFallbacks(ctx)
+
+	for _, step := range fallbackChain(m) {
+
+		if slices.ContainsFunc(path, func(tried *mcommon.FallbackStep) bool {
+			return tried.ModelAgent == step.ModelAgent && tried.Model == step.Model
+		}) {
+			continue
+		}
+
+		// 仅切换模型代理时, 跳过当前出错的模型代理
+		if step.Model == "" && mak.ModelAgent != nil && step.ModelAgent == mak.ModelAgent.Id {
+			continue
+		}
+
+		if !isFallbackCondition(step.Conditions, err) {
+			continue
+		}
+
+		var (
+			nextModelAgent *model.ModelAgent
+			nextModel      = mak.FallbackModel
+			fallbackErr    error
+		)
+
+		if step.ModelAgent != "" {
+			if nextModelAgent, fallbackErr = service.ModelAgent().GetFallbackModelAgent(ctx, step.ModelAgent); fallbackErr != nil {
+				logger.Error(ctx, fallbackErr)
+				continue
+			}
+		}
+
+		if step.Model != "" {
+			if nextModel, fallbackErr = service.Model().GetFallbackModel(ctx, step.Model); fallbackErr != nil {
+				logger.Error(ctx, fallbackErr)
+				continue
+			}
+		}
+
+		tried := &mcommon.FallbackStep{
+			ModelAgent: step.ModelAgent,
+			Model:      step.Model,
+		}
+
+		if nextModelAgent != nil {
+			tried.ModelAgentName = nextModelAgent.Name
+		}
+
+		if step.Model != "" {
+			tried.ModelName = nextModel.Name
+		}
+
+		if err != nil {
+			tried.ErrMsg = err.Error()
+		}
+
+		service.Session().RecordFallback(ctx, tried)
+
+		logger.Infof(ctx, "NextFallback model_agent: %s, model: %s, error: %v", step.ModelAgent, step.Model, err)
+
+		return nextModelAgent, nextModel, true
+	}
+
+	return nil, nil, false
+}
+
+// 后备链, 未配置后备链时由后备模型代理和后备模型依次组成
+func fallbackChain(m *model.Model) []*mcommon.FallbackStep {
+
+	if !m.IsEnableFallback || m.FallbackConfig == nil {
+		return nil
+	}
+
+	if len(m.FallbackConfig.Chain) > 0 {
+		return m.FallbackConfig.Chain
+	}
+
+	chain := make([]*mcommon.FallbackStep, 0)
+
+	if m.FallbackConfig.ModelAgent != "" {
+		chain = append(chain, &mcommon.FallbackStep{
+			ModelAgent:     m.FallbackConfig.ModelAgent,
+			ModelAgentName: m.FallbackConfig.ModelAgentName,
+		})
+	}
+
+	if m.FallbackConfig.Model != "" {
+		chain = append(chain, &mcommon.FallbackStep{
+			Model:     m.FallbackConfig.Model,
+			ModelName: m.FallbackConfig.ModelName,
+		})
+	}
+
+	return chain
+}
+
+// 是否满足后备触发条件, 未配置条件时任意错误均触发
+func isFallbackCondition(conditions []string, err error) bool {
+
+	if len(conditions) == 0 || err == nil {
+		return true
+	}
+
+	for _, condition := range conditions {
+		switch condition {
+		case consts.FALLBACK_CONDITION_TIMEOUT:
+			if errors.Is(err, context.DeadlineExceeded) || gstr.ContainsI(err.Error(), "timeout") || gstr.Contains(err.Error(), "deadline exceeded") {
+				return true
+			}
+		case consts.FALLBACK_CONDITION_5XX:
+			if isServerError(err) {
+				return true
+			}
+		case consts.FALLBACK_CONDITION_CONTENT_FILTER:
+			if gstr.Contains(err.Error(), "content_filter") || gstr.Contains(err.Error(), "content_policy") || gstr.ContainsI(err.Error(), "content management policy") {
+				return true
+			}
+		case consts.FALLBACK_CONDITION_RATE_LIMIT:
+			if IsRateLimit(err) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// 是否为服务端错误
+func isServerError(err error) bool {
+
+	apiError := &sdkerr.ApiError{}
+	if errors.As(err, &apiError) && apiError.HttpStatusCode >= 500 {
+		return true
+	}
+
+	if fastApiError, ok := err.(errors.IFastApiError); ok && fastApiError.Status() >= 500 {
+		return true
+	}
+
+	return gregex.IsMatchString(`status code: 5\d\d`, err.Error())
+}
@@ -0,0 +1,418 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gredis"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+	"time"
+)
+
+// 账本步骤增减Redis额度, 同一账本步骤只执行一次, 并同时释放该额度字段的预占额度, 避免释放与扣减之间的额度被其他请求占用
+// KEYS: 额度哈希, 预占哈希, 账本步骤哈希; ARGV: 额度字段, 增减额度, 预占额度, 账本步骤, 账本步骤过期时间(秒)
+// 返回执行后的额度, 步骤已执行时返回当前额度
+const ledgerStepScript = `
+if redis.call('HSETNX', KEYS[3], ARGV[4], 1) == 0 then
+	return tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or 0)
+end
+redis.call('EXPIRE', KEYS[3], ARGV[5])
+local quota = redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+local reserved = tonumber(ARGV[3])
+if reserved > 0 and redis.call('HINCRBY', KEYS[2], ARGV[1], -reserved) < 0 then
+	redis.call('HSET', KEYS[2], ARGV[1], 0)
+end
+return quota
+`
+
+// 账本步骤哈希过期时间(秒), 需大于账本等待对账重放的时间
+const ledgerStepExpire = 7 * 24 * 3600
+
+// 账本加锁, 同一账本同时只由一个流程入账, 已被锁定时返回false
+func (s *sCommon) lockUsageLedger(ctx context.Context, traceId string) (bool, error) {
+
+	ttl := int64(3600)
+	reply, err := redis.Set(ctx, fmt.Sprintf(consts.LOCK_USAGE_LEDGER_KEY, traceId), gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &ttl},
+		NX:        true,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return !reply.IsEmpty(), nil
+}
+
+// 账本解锁
+func (s *sCommon) unlockUsageLedger(ctx context.Context, traceId string) {
+	if _, err := redis.Del(ctx, fmt.Sprintf(consts.LOCK_USAGE_LEDGER_KEY, traceId)); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 账本入账, 按步骤扣减Redis和Mongo中的额度, 已执行的步骤会跳过, 重放时不会重复扣减
+func (s *sCommon) applyUsageLedger(ctx context.Context, ledger *entity.UsageLedger) error {
+
+	usageKey := fmt.Sprintf(consts.API_USAGE_KEY, ledger.UserId)
+
+	currentQuota, err := s.ledgerRedisSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_USER_REDIS, usageKey, consts.USER_QUOTA_FIELD)
+	if err != nil {
+		return err
+	}
+
+	if err = s.ledgerMongoSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_USER_MONGO, func() error {
+		return service.User().SpendQuota(ctx, ledger.UserId, ledger.SpendQuota, currentQuota)
+	}); err != nil {
+		return err
+	}
+
+	service.Notice().CheckQuota(ctx, consts.NOTICE_TYPE_USER, ledger.UserId, 0, "", currentQuota)
+
+	if ledger.AppIsLimitQuota {
+
+		if currentQuota, err = s.ledgerRedisSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_APP_REDIS, usageKey, fmt.Sprintf(consts.APP_QUOTA_FIELD, ledger.AppId)); err != nil {
+			return err
+		}
+
+		if err = s.ledgerMongoSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_APP_MONGO, func() error {
+			return service.App().SpendQuota(ctx, ledger.AppId, ledger.SpendQuota, currentQuota)
+		}); err != nil {
+			return err
+		}
+
+		service.Notice().CheckQuota(ctx, consts.NOTICE_TYPE_APP, ledger.UserId, ledger.AppId, "", currentQuota)
+
+	} else {
+		if err = s.ledgerMongoSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_APP_MONGO, func() error {
+			return service.App().UsedQuota(ctx, ledger.AppId, ledger.SpendQuota)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if ledger.KeyIsLimitQuota {
+
+		if currentQuota, err = s.ledgerRedisSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_APP_KEY_REDIS, usageKey, fmt.Sprintf(consts.KEY_QUOTA_FIELD, ledger.AppId, ledger.AppKey)); err != nil {
+			return err
+		}
+
+		if err = s.ledgerMongoSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_APP_KEY_MONGO, func() error {
+			return service.App().AppKeySpendQuota(ctx, ledger.AppKey, ledger.SpendQuota, currentQuota)
+		}); err != nil {
+			return err
+		}
+
+		service.Notice().CheckQuota(ctx, consts.NOTICE_TYPE_APP_KEY, ledger.UserId, ledger.AppId, ledger.AppKey, currentQuota)
+
+	} else {
+		if err = s.ledgerMongoSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_APP_KEY_MONGO, func() error {
+			return service.App().AppKeyUsedQuota(ctx, ledger.AppKey, ledger.SpendQuota)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err = s.ledgerMongoSpendQuota(ctx, ledger, consts.USAGE_LEDGER_STEP_KEY_MONGO, func() error {
+		return service.Key().UsedQuota(ctx, ledger.Key, ledger.SpendQuota)
+	}); err != nil {
+		return err
+	}
+
+	// 累加模型额度上限的已用额度
+	for _, field := range ledger.ModelFields {
+
+		if _, err = s.ledgerRedisIncrQuota(ctx, ledger, fmt.Sprintf(consts.USAGE_LEDGER_STEP_MODEL_QUOTA_REDIS, field), usageKey, field, ledger.SpendQuota, 0); err != nil {
+			return err
+		}
+	}
+
+	return mongoSpendQuota(ctx, func() error {
+		return dao.UsageLedger.UpdateById(ctx, ledger.Id, bson.M{"status": 1})
+	})
+}
+
+// 账本步骤扣减Redis额度, 同时释放预占额度, 已执行时返回当前剩余额度
+func (s *sCommon) ledgerRedisSpendQuota(ctx context.Context, ledger *entity.UsageLedger, step, usageKey, field string) (int, error) {
+	return s.ledgerRedisIncrQuota(ctx, ledger, step, usageKey, field, -ledger.SpendQuota, ledger.ReservedQuota)
+}
+
+// 账本步骤增减Redis额度, 由脚本保证同一账本步骤只执行一次
+func (s *sCommon) ledgerRedisIncrQuota(ctx context.Context, ledger *entity.UsageLedger, step, usageKey, field string, increment, reservedQuota int, retry ...int) (int, error) {
+
+	if slices.Contains(ledger.Steps, step) {
+		return redis.HGetInt(ctx, usageKey, field)
+	}
+
+	keys := []string{usageKey, fmt.Sprintf(consts.API_RESERVED_KEY, ledger.UserId), fmt.Sprintf(consts.API_LEDGER_KEY, ledger.TraceId)}
+
+	reply, err := redis.Eval(ctx, ledgerStepScript, 3, keys, []interface{}{field, increment, reservedQuota, step, ledgerStepExpire})
+	if err != nil {
+		logger.Errorf(ctx, "ledgerRedisIncrQuota usageKey: %s, field: %s, increment: %d, error: %v", usageKey, field, increment, err)
+
+		if len(retry) == 10 {
+			return -1, err
+		}
+
+		retry = append(retry, 1)
+
+		time.Sleep(time.Duration(len(retry)*5) * time.Second)
+
+		logger.Errorf(ctx, "ledgerRedisIncrQuota usageKey: %s, field: %s, increment: %d, retry: %d", usageKey, field, increment, len(retry))
+
+		return s.ledgerRedisIncrQuota(ctx, ledger, step, usageKey, field, increment, reservedQuota, retry...)
+	}
+
+	return reply.Int(), s.saveUsageLedgerStep(ctx, ledger, step)
+}
+
+// 账本步骤扣减Mongo额度
+func (s *sCommon) ledgerMongoSpendQuota(ctx context.Context, ledger *entity.UsageLedger, step string, f func() error) error {
+
+	if slices.Contains(ledger.Steps, step) {
+		return nil
+	}
+
+	if err := mongoSpendQuota(ctx, f); err != nil {
+		return err
+	}
+
+	return s.saveUsageLedgerStep(ctx, ledger, step)
+}
+
+// 记录账本已执行的步骤
+func (s *sCommon) saveUsageLedgerStep(ctx context.Context, ledger *entity.UsageLedger, step string) error {
+
+	if err := mongoSpendQuota(ctx, func() error {
+		return dao.UsageLedger.UpdateById(ctx, ledger.Id, bson.M{"$addToSet": bson.M{"steps": step}})
+	}); err != nil {
+		return err
+	}
+
+	ledger.Steps = append(ledger.Steps, step)
+
+	return nil
+}
+
+// 额度对账, 重放未完成入账的账本, 并记录Redis与Mongo之间的额度差异
+func (s *sCommon) ReconcileUsage(ctx context.Context) error {
+
+	// 多实例下同一周期内只由一个实例执行
+	ttl := int64(240)
+	reply, err := redis.Set(ctx, consts.LOCK_USAGE_RECONCILE_KEY, gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &ttl},
+		NX:        true,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if reply.IsEmpty() {
+		return nil
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCommon ReconcileUsage time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	// 入账失败时会重试数分钟, 只重放创建超过30分钟仍未完成的账本
+	ledgers, err := dao.UsageLedger.Find(ctx, bson.M{"status": 2, "created_at": bson.M{"$lt": now - 30*60*1000}}, "created_at")
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, ledger := range ledgers {
+		s.replayUsageLedger(ctx, ledger)
+	}
+
+	// 仍有未完成入账的用户存在正常差异, 不参与对账
+	pendingLedgers, err := dao.UsageLedger.Find(ctx, bson.M{"status": 2})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	pendingUsers := make(map[int]bool)
+	for _, ledger := range pendingLedgers {
+		pendingUsers[ledger.UserId] = true
+	}
+
+	return s.checkUsageDrift(ctx, pendingUsers, now)
+}
+
+// 重放账本, 加锁后重新读取账本, 避免与正在入账的流程重复执行步骤
+func (s *sCommon) replayUsageLedger(ctx context.Context, ledger *entity.UsageLedger) {
+
+	isLocked, err := s.lockUsageLedger(ctx, ledger.TraceId)
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	if !isLocked {
+		return
+	}
+
+	defer s.unlockUsageLedger(ctx, ledger.TraceId)
+
+	if ledger, err = dao.UsageLedger.FindById(ctx, ledger.Id); err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	if ledger.Status != 2 {
+		return
+	}
+
+	if err = s.applyUsageLedger(ctx, ledger); err != nil {
+		logger.Errorf(ctx, "sCommon ReconcileUsage traceId: %s, steps: %v, error: %v", ledger.TraceId, ledger.Steps, err)
+	} else {
+		logger.Infof(ctx, "sCommon ReconcileUsage replay traceId: %s, userId: %d, spendQuota: %d", ledger.TraceId, ledger.UserId, ledger.SpendQuota)
+	}
+}
+
+// 检查Redis额度字段与Mongo剩余额度是否一致
+func (s *sCommon) checkUsageDrift(ctx context.Context, pendingUsers map[int]bool, since int64) error {
+
+	usages := make(map[int]map[string]interface{})
+	getUsage := func(userId int) (map[string]interface{}, error) {
+
+		if usage, ok := usages[userId]; ok {
+			return usage, nil
+		}
+
+		reply, err := redis.HGetAll(ctx, fmt.Sprintf(consts.API_USAGE_KEY, userId))
+		if err != nil {
+			return nil, err
+		}
+
+		usages[userId] = reply.Map()
+
+		return usages[userId], nil
+	}
+
+	users, err := dao.User.Find(ctx, bson.M{"status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, user := range users {
+
+		if pendingUsers[user.UserId] {
+			continue
+		}
+
+		usage, err := getUsage(user.UserId)
+		if err != nil {
+			logger.Error(ctx, err)
+			continue
+		}
+
+		s.saveUsageDriftLog(ctx, since, usage, consts.USER_QUOTA_FIELD, &do.UsageDriftLog{
+			Type:           consts.USAGE_DRIFT_TYPE_USER,
+			UserId:         user.UserId,
+			MongoQuota:     user.Quota,
+			MongoUsedQuota: user.UsedQuota,
+		})
+	}
+
+	apps, err := dao.App.Find(ctx, bson.M{"is_limit_quota": true, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, app := range apps {
+
+		if pendingUsers[app.UserId] {
+			continue
+		}
+
+		usage, err := getUsage(app.UserId)
+		if err != nil {
+			logger.Error(ctx, err)
+			continue
+		}
+
+		s.saveUsageDriftLog(ctx, since, usage, fmt.Sprintf(consts.APP_QUOTA_FIELD, app.AppId), &do.UsageDriftLog{
+			Type:           consts.USAGE_DRIFT_TYPE_APP,
+			UserId:         app.UserId,
+			AppId:          app.AppId,
+			MongoQuota:     app.Quota,
+			MongoUsedQuota: app.UsedQuota,
+		})
+	}
+
+	keys, err := dao.Key.Find(ctx, bson.M{"type": 1, "is_limit_quota": true, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, key := range keys {
+
+		if pendingUsers[key.UserId] {
+			continue
+		}
+
+		usage, err := getUsage(key.UserId)
+		if err != nil {
+			logger.Error(ctx, err)
+			continue
+		}
+
+		s.saveUsageDriftLog(ctx, since, usage, fmt.Sprintf(consts.KEY_QUOTA_FIELD, key.AppId, key.Key), &do.UsageDriftLog{
+			Type:           consts.USAGE_DRIFT_TYPE_APP_KEY,
+			UserId:         key.UserId,
+			AppId:          key.AppId,
+			Key:            key.Key,
+			MongoQuota:     key.Quota,
+			MongoUsedQuota: key.UsedQuota,
+		})
+	}
+
+	return nil
+}
+
+// 记录额度差异, Redis中未加载额度字段时不对账
+func (s *sCommon) saveUsageDriftLog(ctx context.Context, since int64, usage map[string]interface{}, field string, driftLog *do.UsageDriftLog) {
+
+	value, ok := usage[field]
+	if !ok {
+		return
+	}
+
+	driftLog.RedisQuota = gconv.Int(value)
+	driftLog.Drift = driftLog.RedisQuota - driftLog.MongoQuota
+
+	if driftLog.Drift == 0 {
+		return
+	}
+
+	// 对账期间产生新的计费时差异可能是正常的, 留到下次对账
+	if count, err := dao.UsageLedger.CountDocuments(ctx, bson.M{"user_id": driftLog.UserId, "created_at": bson.M{"$gte": since}}); err != nil {
+		logger.Error(ctx, err)
+		return
+	} else if count > 0 {
+		return
+	}
+
+	logger.Errorf(ctx, "sCommon ReconcileUsage drift type: %s, userId: %d, appId: %d, key: %s, redisQuota: %d, mongoQuota: %d, mongoUsedQuota: %d, drift: %d",
+		driftLog.Type, driftLog.UserId, driftLog.AppId, driftLog.Key, driftLog.RedisQuota, driftLog.MongoQuota, driftLog.MongoUsedQuota, driftLog.Drift)
+
+	if _, err := dao.UsageDriftLog.Insert(ctx, driftLog); err != nil {
+		logger.Error(ctx, err)
+	}
+}
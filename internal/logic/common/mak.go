@@ -3,13 +3,16 @@ package common
 import (
 	"context"
 	"fmt"
+	"github.com/gogf/gf/v2/crypto/gmd5"
 	"github.com/gogf/gf/v2/os/gctx"
 	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/gogf/gf/v2/util/gconv"
 	sdkm "github.com/iimeta/fastapi-sdk/model"
 	"github.com/iimeta/fastapi/internal/config"
 	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
 )
@@ -18,6 +21,11 @@ type MAK struct {
 	Corp               string
 	Model              string
 	Messages           []sdkm.ChatCompletionMessage
+	Tools              any
+	MaxTokens          int
+	User               string
+	SkipAffinity       bool
+	DryRun             bool
 	ReqModel           *model.Model
 	RealModel          *model.Model
 	ModelAgent         *model.ModelAgent
@@ -29,6 +37,7 @@ type MAK struct {
 	RealKey            string
 	BaseUrl            string
 	Path               string
+	promptTokens       *int
 }
 
 func (mak *MAK) InitMAK(ctx context.Context, retry ...int) (err error) {
@@ -42,6 +51,36 @@ func (mak *MAK) InitMAK(ctx context.Context, retry ...int) (err error) {
 			logger.Error(ctx, err)
 			return err
 		}
+
+		// 超过软限制时通过模型转发降级到目标模型, 计费、速率限制和日志均按降级后的模型
+		if softLimit := service.Session().GetSoftLimit(ctx); softLimit != nil && softLimit.TargetModel != "" && softLimit.TargetModel != mak.ReqModel.Id {
+			mak.ReqModel = getSoftLimitModel(ctx, mak.ReqModel, softLimit.TargetModel)
+		}
+
+		// 模型额度上限
+		if err = service.Auth().VerifyModelQuota(ctx, mak.ReqModel); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		if !mak.DryRun {
+
+			// 模型速率限制, 令牌数按提示词令牌数加最大输出令牌数计算
+			if err = service.RateLimit().LimitModel(ctx, mak.ReqModel, func() int {
+				return mak.getPromptTokens(ctx) + mak.MaxTokens
+			}); err != nil {
+				logger.Error(ctx, err)
+				return err
+			}
+
+			// 预占额度
+			if getReservationConfig().Open {
+				if err = service.Common().ReserveQuota(ctx, mak.estimateQuota(ctx)); err != nil {
+					logger.Error(ctx, err)
+					return err
+				}
+			}
+		}
 	}
 
 	if mak.FallbackModel != nil {
@@ -61,6 +100,8 @@ func (mak *MAK) InitMAK(ctx context.Context, retry ...int) (err error) {
 	mak.BaseUrl = mak.RealModel.BaseUrl
 	mak.Path = mak.RealModel.Path
 
+	affinity := mak.affinity()
+
 	if mak.FallbackModelAgent != nil || mak.RealModel.IsEnableModelAgent {
 
 		if mak.FallbackModelAgent != nil {
@@ -69,91 +110,98 @@ func (mak *MAK) InitMAK(ctx context.Context, retry ...int) (err error) {
 			mak.RealModel.IsEnableModelAgent = true
 		} else {
 
-			if mak.AgentTotal, mak.ModelAgent, err = service.ModelAgent().PickModelAgent(ctx, mak.RealModel); err != nil {
-				logger.Error(ctx, err)
+			// 预估时只读挑选, 不占用并发数、不排队等待、不发起熔断探测
+			if mak.DryRun {
+				mak.AgentTotal, mak.ModelAgent, err = service.ModelAgent().PeekModelAgent(ctx, mak.RealModel)
+			} else {
+				mak.AgentTotal, mak.ModelAgent, err = service.ModelAgent().PickModelAgent(ctx, mak.RealModel, affinity)
+			}
 
-				if mak.RealModel.IsEnableFallback {
+			if err != nil {
+				logger.Error(ctx, err)
 
-					if mak.RealModel.FallbackConfig.ModelAgent != "" {
-						if mak.FallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); mak.FallbackModelAgent != nil {
-							return mak.InitMAK(ctx)
-						}
-					}
+				// 排队已满或超时直接返回, 不切换后备
+				if isConcurrencyError(err) {
+					return err
+				}
 
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if mak.FallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); mak.FallbackModel != nil {
-							return mak.InitMAK(ctx)
-						}
-					}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := NextFallback(ctx, mak, err); isFallback {
+					mak.FallbackModelAgent = fallbackModelAgent
+					mak.FallbackModel = fallbackModel
+					return mak.InitMAK(ctx)
 				}
 
 				return err
 			}
 		}
 
-		if mak.ModelAgent != nil {
+		if mak.ModelAgent != nil && !mak.DryRun {
 
 			mak.Corp = mak.ModelAgent.Corp
 			mak.BaseUrl = mak.ModelAgent.BaseUrl
 			mak.Path = mak.ModelAgent.Path
 
-			if mak.KeyTotal, mak.Key, err = service.ModelAgent().PickModelAgentKey(ctx, mak.ModelAgent); err != nil {
+			if mak.KeyTotal, mak.Key, err = service.ModelAgent().PickModelAgentKey(ctx, mak.ModelAgent, affinity); err != nil {
 				logger.Error(ctx, err)
 
-				service.ModelAgent().RecordErrorModelAgent(ctx, mak.RealModel, mak.ModelAgent)
+				// 释放模型代理占用的并发数
+				service.Concurrency().ReleaseLease(ctx, consts.CONCURRENCY_TYPE_MODEL_AGENT, mak.ModelAgent.Id)
+
+				// 排队已满或超时直接返回, 不记录模型代理错误和切换后备
+				if isConcurrencyError(err) {
+					return err
+				}
 
+				// 仅在模型代理下确实没有启用的密钥时记录错误和禁用, 密钥冷却或熔断为暂时不可用, 只在会话中跳过该模型代理
 				if errors.Is(err, errors.ERR_NO_AVAILABLE_MODEL_AGENT_KEY) {
+					service.ModelAgent().RecordErrorModelAgent(ctx, mak.RealModel, mak.ModelAgent)
 					service.ModelAgent().DisabledModelAgent(ctx, mak.ModelAgent, "No available model agent key")
+				} else {
+					service.Session().RecordErrorModelAgent(ctx, mak.ModelAgent.Id)
 				}
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if mak.FallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); mak.FallbackModelAgent != nil {
-							return mak.InitMAK(ctx)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if mak.FallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); mak.FallbackModel != nil {
-							return mak.InitMAK(ctx)
-						}
-					}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := NextFallback(ctx, mak, err); isFallback {
+					mak.FallbackModelAgent = fallbackModelAgent
+					mak.FallbackModel = fallbackModel
+					return mak.InitMAK(ctx)
 				}
 
 				return err
 			}
 		}
 
-	} else {
+	} else if !mak.DryRun {
 
-		if mak.KeyTotal, mak.Key, err = service.Key().PickModelKey(ctx, mak.RealModel); err != nil {
+		if mak.KeyTotal, mak.Key, err = service.Key().PickModelKey(ctx, mak.RealModel, affinity); err != nil {
 			logger.Error(ctx, err)
 
-			if mak.RealModel.IsEnableFallback {
-
-				if mak.RealModel.FallbackConfig.ModelAgent != "" {
-					if mak.FallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); mak.FallbackModelAgent != nil {
-						return mak.InitMAK(ctx)
-					}
-				}
+			// 排队已满或超时直接返回, 不切换后备
+			if isConcurrencyError(err) {
+				return err
+			}
 
-				if mak.RealModel.FallbackConfig.Model != "" {
-					if mak.FallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); mak.FallbackModel != nil {
-						return mak.InitMAK(ctx)
-					}
-				}
+			// 按后备链切换模型代理或模型
+			if fallbackModelAgent, fallbackModel, isFallback := NextFallback(ctx, mak, err); isFallback {
+				mak.FallbackModelAgent = fallbackModelAgent
+				mak.FallbackModel = fallbackModel
+				return mak.InitMAK(ctx)
 			}
 
 			return err
 		}
 	}
 
+	if mak.DryRun {
+		return nil
+	}
+
 	if err = getRealKey(ctx, mak); err != nil {
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := IsNeedRetry(err)
 
@@ -182,6 +230,103 @@ func (mak *MAK) InitMAK(ctx context.Context, retry ...int) (err error) {
 	return nil
 }
 
+// 对冲请求挑选与原请求不同的密钥, 优先同一模型代理下的其它密钥, 其次其它模型代理, 仅对实际使用的模型代理和密钥占用并发数和发起熔断探测
+func (mak *MAK) Hedge(ctx context.Context) (*MAK, error) {
+
+	hedgeMak := *mak
+
+	// 对冲请求与原请求并发记录日志时会修改模型, 使用独立的副本
+	realModel := *mak.RealModel
+	hedgeMak.RealModel = &realModel
+
+	if mak.RealModel.IsEnableModelAgent {
+
+		keyTotal, key, err := service.ModelAgent().PeekModelAgentKey(ctx, mak.ModelAgent, mak.Key.Id)
+		if err != nil {
+
+			// 后备模型代理为指定的模型代理, 不切换
+			if mak.FallbackModelAgent != nil {
+				return nil, err
+			}
+
+			agentTotal, modelAgent, err := service.ModelAgent().PeekModelAgent(ctx, mak.RealModel, mak.ModelAgent.Id)
+			if err != nil {
+				return nil, err
+			}
+
+			if keyTotal, key, err = service.ModelAgent().PeekModelAgentKey(ctx, modelAgent, mak.Key.Id); err != nil {
+				return nil, err
+			}
+
+			if isAllow, _ := service.Breaker().Allow(ctx, consts.BREAKER_TYPE_MODEL_AGENT, modelAgent.Id); !isAllow {
+				return nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT
+			}
+
+			if !service.Concurrency().Acquire(ctx, consts.CONCURRENCY_TYPE_MODEL_AGENT, modelAgent.Id, modelAgent.MaxConcurrency) {
+				service.Breaker().Release(ctx, consts.BREAKER_TYPE_MODEL_AGENT, modelAgent.Id)
+				return nil, errors.ERR_CONCURRENCY_QUEUE_FULL
+			}
+
+			hedgeMak.AgentTotal = agentTotal
+			hedgeMak.ModelAgent = modelAgent
+			hedgeMak.Corp = modelAgent.Corp
+			hedgeMak.BaseUrl = modelAgent.BaseUrl
+			hedgeMak.Path = modelAgent.Path
+		}
+
+		hedgeMak.KeyTotal = keyTotal
+		hedgeMak.Key = key
+
+	} else {
+
+		keyTotal, key, err := service.Key().PeekModelKey(ctx, mak.RealModel, mak.Key.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		hedgeMak.KeyTotal = keyTotal
+		hedgeMak.Key = key
+	}
+
+	breakerType := consts.BREAKER_TYPE_MODEL_KEY
+	if hedgeMak.RealModel.IsEnableModelAgent {
+		breakerType = consts.BREAKER_TYPE_MODEL_AGENT_KEY
+	}
+
+	// 释放切换的模型代理占用的并发数和熔断探测
+	release := func() {
+		if hedgeMak.ModelAgent != mak.ModelAgent {
+			service.Concurrency().ReleaseLease(ctx, consts.CONCURRENCY_TYPE_MODEL_AGENT, hedgeMak.ModelAgent.Id)
+			service.Breaker().Release(ctx, consts.BREAKER_TYPE_MODEL_AGENT, hedgeMak.ModelAgent.Id)
+		}
+	}
+
+	if isAllow, _ := service.Breaker().Allow(ctx, breakerType, hedgeMak.Key.Id); !isAllow {
+		release()
+		return nil, errors.ERR_ALL_KEY
+	}
+
+	if !service.Concurrency().Acquire(ctx, consts.CONCURRENCY_TYPE_KEY, hedgeMak.Key.Id, hedgeMak.Key.MaxConcurrency) {
+		service.Breaker().Release(ctx, breakerType, hedgeMak.Key.Id)
+		release()
+		return nil, errors.ERR_CONCURRENCY_QUEUE_FULL
+	}
+
+	if err := getRealKey(ctx, &hedgeMak); err != nil {
+		service.Concurrency().ReleaseLease(ctx, consts.CONCURRENCY_TYPE_KEY, hedgeMak.Key.Id)
+		service.Breaker().Release(ctx, breakerType, hedgeMak.Key.Id)
+		release()
+		return nil, err
+	}
+
+	return &hedgeMak, nil
+}
+
+// 是否为并发排队错误
+func isConcurrencyError(err error) bool {
+	return errors.Is(err, errors.ERR_CONCURRENCY_QUEUE_FULL) || errors.Is(err, errors.ERR_CONCURRENCY_QUEUE_TIMEOUT)
+}
+
 func getRealKey(ctx context.Context, mak *MAK) error {
 
 	if GetCorpCode(ctx, mak.RealModel.Corp) == consts.CORP_GCP_CLAUDE {
@@ -203,3 +348,91 @@ func getRealKey(ctx context.Context, mak *MAK) error {
 
 	return nil
 }
+
+// 亲和路由, 优先使用用户标识, 否则取工具定义和消息的稳定前缀, 相同亲和键的请求路由到同一模型代理和密钥以提高上游提示词缓存命中率
+func (mak *MAK) affinity() *model.Affinity {
+
+	if mak.SkipAffinity || !mak.RealModel.IsEnableAffinity {
+		return nil
+	}
+
+	prefixLength := 1024
+	ttl := int64(300)
+
+	if mak.RealModel.AffinityConfig != nil {
+
+		if mak.RealModel.AffinityConfig.PrefixLength > 0 {
+			prefixLength = mak.RealModel.AffinityConfig.PrefixLength
+		}
+
+		if mak.RealModel.AffinityConfig.Ttl > 0 {
+			ttl = mak.RealModel.AffinityConfig.Ttl
+		}
+	}
+
+	if mak.User != "" {
+		return &model.Affinity{
+			Key: gmd5.MustEncryptString("user:" + mak.User),
+			Ttl: ttl,
+		}
+	}
+
+	// 只取稳定的前缀(工具定义、系统消息和之前的对话), 不含最后一条用户消息, 同一会话的后续请求得到相同的亲和键
+	messages := mak.Messages
+	if last := len(messages) - 1; last >= 0 && messages[last].Role == consts.ROLE_USER {
+		messages = messages[:last]
+	}
+
+	prefix := make([]rune, 0, prefixLength)
+	if mak.Tools != nil {
+		prefix = append(prefix, []rune("tools:"+gconv.String(mak.Tools)+"\n")...)
+	}
+
+	for _, message := range messages {
+
+		if len(prefix) >= prefixLength {
+			break
+		}
+
+		prefix = append(prefix, []rune(message.Role+":"+gconv.String(message.Content)+"\n")...)
+	}
+
+	if len(prefix) > prefixLength {
+		prefix = prefix[:prefixLength]
+	}
+
+	if len(prefix) == 0 {
+		return nil
+	}
+
+	return &model.Affinity{
+		Key: gmd5.MustEncryptString(string(prefix)),
+		Ttl: ttl,
+	}
+}
+
+// 获取软限制降级模型, 目标模型不可用或类型不一致时不降级
+func getSoftLimitModel(ctx context.Context, reqModel *model.Model, targetModelId string) *model.Model {
+
+	forwardModel := *reqModel
+	forwardModel.IsEnableForward = true
+	forwardModel.ForwardConfig = &mcommon.ForwardConfig{
+		ForwardRule: 1,
+		TargetModel: targetModelId,
+	}
+
+	targetModel, err := service.Model().GetTargetModel(ctx, &forwardModel, nil)
+	if err != nil || targetModel == nil {
+		logger.Errorf(ctx, "getSoftLimitModel model: %s, targetModel: %s, error: %v", reqModel.Model, targetModelId, err)
+		return reqModel
+	}
+
+	if targetModel.Status != 1 || targetModel.Type != reqModel.Type {
+		logger.Errorf(ctx, "getSoftLimitModel model: %s, targetModel: %s, status: %d, type: %d, unavailable", reqModel.Model, targetModel.Model, targetModel.Status, targetModel.Type)
+		return reqModel
+	}
+
+	logger.Infof(ctx, "getSoftLimitModel model: %s downgrade to targetModel: %s", reqModel.Model, targetModel.Model)
+
+	return targetModel
+}
@@ -0,0 +1,99 @@
+package common
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/cache"
+	"github.com/iimeta/fastapi/utility/lb"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+)
+
+// 获取延迟统计
+func GetLatency(ctx context.Context, latencyCache *cache.Cache, id string) *lb.Latency {
+
+	reply, err := latencyCache.GetOrSetFuncLock(ctx, id, func(ctx context.Context) (interface{}, error) {
+		return lb.NewLatency(), nil
+	}, 0)
+
+	if err != nil || reply == nil {
+		logger.Error(ctx, err)
+		return lb.NewLatency()
+	}
+
+	return reply.Val().(*lb.Latency)
+}
+
+// 释放未被选中的半开探测
+func ReleaseProbes(ctx context.Context, typ string, probeIds []string, pickedId string) {
+
+	ids := make([]string, 0)
+	for _, id := range probeIds {
+		if id != pickedId {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+		service.Breaker().Release(ctx, typ, ids...)
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 获取亲和绑定
+func GetAffinity(ctx context.Context, affinityKey string) string {
+
+	id, err := redis.GetStr(ctx, affinityKey)
+	if err != nil {
+		logger.Error(ctx, err)
+		return ""
+	}
+
+	return id
+}
+
+// 绑定亲和, 每次命中都会续期
+func BindAffinity(ctx context.Context, affinityKey, id string, ttl int64) {
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+		if err := redis.SetEX(ctx, affinityKey, id, ttl); err != nil {
+			logger.Error(ctx, err)
+		}
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 过滤并发已满的密钥
+func FilterConcurrencyKeys(ctx context.Context, keys []*model.Key) []*model.Key {
+
+	keyList := make([]*model.Key, 0)
+	for _, key := range keys {
+		if !service.Concurrency().IsSaturated(ctx, consts.CONCURRENCY_TYPE_KEY, key.Id, key.MaxConcurrency) {
+			keyList = append(keyList, key)
+		}
+	}
+
+	return keyList
+}
+
+// 过滤并发已满的模型代理
+func FilterConcurrencyModelAgents(ctx context.Context, modelAgents []*model.ModelAgent) []*model.ModelAgent {
+
+	modelAgentList := make([]*model.ModelAgent, 0)
+	for _, modelAgent := range modelAgents {
+		if !service.Concurrency().IsSaturated(ctx, consts.CONCURRENCY_TYPE_MODEL_AGENT, modelAgent.Id, modelAgent.MaxConcurrency) {
+			modelAgentList = append(modelAgentList, modelAgent)
+		}
+	}
+
+	return modelAgentList
+}
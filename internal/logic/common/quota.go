@@ -4,6 +4,9 @@ import (
 	"github.com/gogf/gf/v2/net/ghttp"
 	"github.com/gogf/gf/v2/text/gstr"
 	"github.com/gogf/gf/v2/util/gconv"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/model"
 	mcommon "github.com/iimeta/fastapi/internal/model/common"
@@ -66,3 +69,80 @@ func GetMidjourneyQuota(model *model.Model, request *ghttp.Request, path string)
 
 	return mcommon.MidjourneyQuota{}, errors.ERR_PATH_NOT_FOUND
 }
+
+// 计费用量, 将上游返回的用量转换为计费引擎统一的用量
+func GetPricingUsage(usage *sdkm.Usage) *model.PricingUsage {
+
+	pricingUsage := new(model.PricingUsage)
+
+	if usage == nil {
+		return pricingUsage
+	}
+
+	pricingUsage.PromptTokens = usage.PromptTokens
+	pricingUsage.CompletionTokens = usage.CompletionTokens
+	pricingUsage.CacheWriteTokens = usage.CacheCreationInputTokens
+	pricingUsage.CacheReadTokens = usage.CacheReadInputTokens
+
+	if usage.PromptTokensDetails != nil {
+
+		pricingUsage.AudioPromptTokens = usage.PromptTokensDetails.AudioTokens
+
+		if usage.CacheReadInputTokens == 0 {
+			pricingUsage.CachedTokens = usage.PromptTokensDetails.CachedTokens
+		}
+	}
+
+	if usage.CompletionTokensDetails != nil {
+		pricingUsage.AudioCompletionTokens = usage.CompletionTokensDetails.AudioTokens
+		pricingUsage.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+
+	return pricingUsage
+}
+
+// 缓存命中令牌数, 兼容单独返回和包含在提示令牌数中两种形式
+func GetCacheReadTokens(usage *sdkm.Usage) int {
+
+	if usage == nil {
+		return 0
+	}
+
+	if usage.CacheReadInputTokens != 0 {
+		return usage.CacheReadInputTokens
+	}
+
+	if usage.PromptTokensDetails != nil {
+		return usage.PromptTokensDetails.CachedTokens
+	}
+
+	return 0
+}
+
+// 额度货币配置, 未配置时1美元对应50万额度并以美元显示
+func GetQuotaCurrency() *mcommon.QuotaCurrency {
+
+	quotaCurrency := mcommon.QuotaCurrency{}
+	if config.Cfg.QuotaCurrency != nil {
+		quotaCurrency = *config.Cfg.QuotaCurrency
+	}
+
+	if quotaCurrency.Unit <= 0 {
+		quotaCurrency.Unit = consts.QUOTA_USD_UNIT
+	}
+
+	if quotaCurrency.Currency == "" {
+		quotaCurrency.Currency = "USD"
+	}
+
+	if quotaCurrency.ExchangeRate <= 0 {
+		quotaCurrency.ExchangeRate = 1
+	}
+
+	return &quotaCurrency
+}
+
+// 额度换算为显示货币金额
+func QuotaToAmount(quota int, quotaCurrency *mcommon.QuotaCurrency) float64 {
+	return float64(quota) / quotaCurrency.Unit * quotaCurrency.ExchangeRate
+}
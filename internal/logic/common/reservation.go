@@ -0,0 +1,197 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+)
+
+// 预占额度保存在独立的哈希中, 字段与额度字段一致, 刷新缓存时不会覆盖
+// KEYS: 额度哈希, 预占哈希; ARGV: 预占额度, 过期时间(秒), 额度字段...
+// 任一字段的剩余额度(额度-已预占)不足时返回0, 否则全部字段增加预占额度并返回1, 额度字段不存在时不校验
+const reserveScript = `
+local amount = tonumber(ARGV[1])
+for i = 3, #ARGV do
+	local quota = redis.call('HGET', KEYS[1], ARGV[i])
+	if quota and tonumber(quota) - tonumber(redis.call('HGET', KEYS[2], ARGV[i]) or 0) < amount then
+		return 0
+	end
+end
+for i = 3, #ARGV do
+	redis.call('HINCRBY', KEYS[2], ARGV[i], amount)
+end
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+return 1
+`
+
+// KEYS: 预占哈希; ARGV: 预占额度, 额度字段...
+const releaseScript = `
+local amount = tonumber(ARGV[1])
+for i = 2, #ARGV do
+	if redis.call('HINCRBY', KEYS[1], ARGV[i], -amount) < 0 then
+		redis.call('HSET', KEYS[1], ARGV[i], 0)
+	end
+end
+return 1
+`
+
+// 预占哈希过期时间(秒), 兜底进程异常退出时未释放的预占额度
+const reservedExpire = 3600
+
+// 预占额度, 额度不足时拒绝, 同一请求只预占一次
+func (s *sCommon) ReserveQuota(ctx context.Context, amount int) error {
+
+	if !getReservationConfig().Open || amount <= 0 || service.Session().GetQuotaReservation(ctx) != nil {
+		return nil
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCommon ReserveQuota time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	reservation := &model.QuotaReservation{
+		UserId: service.Session().GetUserId(ctx),
+		Amount: amount,
+		Fields: []string{consts.USER_QUOTA_FIELD},
+	}
+
+	if service.Session().GetAppIsLimitQuota(ctx) {
+		reservation.Fields = append(reservation.Fields, s.GetAppTotalTokensField(ctx))
+	}
+
+	if service.Session().GetKeyIsLimitQuota(ctx) {
+		reservation.Fields = append(reservation.Fields, s.GetKeyTotalTokensField(ctx))
+	}
+
+	args := []interface{}{amount, reservedExpire}
+	for _, field := range reservation.Fields {
+		args = append(args, field)
+	}
+
+	reply, err := redis.Eval(ctx, reserveScript, 2, []string{s.GetUserUsageKey(ctx), fmt.Sprintf(consts.API_RESERVED_KEY, reservation.UserId)}, args)
+	if err != nil {
+		// 出错时不预占, 避免影响请求
+		logger.Error(ctx, err)
+		return nil
+	}
+
+	if reply.Int() != 1 {
+		logger.Errorf(ctx, "sCommon ReserveQuota userId: %d, amount: %d, fields: %v, insufficient quota", reservation.UserId, amount, reservation.Fields)
+		return errors.ERR_INSUFFICIENT_QUOTA
+	}
+
+	service.Session().SaveQuotaReservation(ctx, reservation)
+
+	return nil
+}
+
+// 释放预占额度, 仅用于未进入记录使用额度的请求(出错或无花费), 已进入结算的预占额度由记录使用额度随实际花费一并释放
+func (s *sCommon) ReleaseQuota(ctx context.Context) {
+
+	reservation := service.Session().GetQuotaReservation(ctx)
+	if reservation == nil || !reservation.IsReleased.CompareAndSwap(false, true) {
+		return
+	}
+
+	s.releaseReservedQuota(ctx, reservation)
+}
+
+// 结算预占额度, 在异步记录使用额度前调用, 之后请求结束时不再直接释放预占额度
+func (s *sCommon) SettleQuota(ctx context.Context) {
+
+	reservation := service.Session().GetQuotaReservation(ctx)
+	if reservation == nil || !reservation.IsReleased.CompareAndSwap(false, true) {
+		return
+	}
+
+	reservation.IsSettled.Store(true)
+}
+
+// 获取待结算的预占额度, 同一请求多次计费时只由首次计费结算
+func (s *sCommon) takeSettledQuota(ctx context.Context) *model.QuotaReservation {
+
+	reservation := service.Session().GetQuotaReservation(ctx)
+	if reservation == nil || !reservation.IsSettled.CompareAndSwap(true, false) {
+		return nil
+	}
+
+	return reservation
+}
+
+// 释放预占哈希中的预占额度
+func (s *sCommon) releaseReservedQuota(ctx context.Context, reservation *model.QuotaReservation) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCommon releaseReservedQuota time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	args := []interface{}{reservation.Amount}
+	for _, field := range reservation.Fields {
+		args = append(args, field)
+	}
+
+	if _, err := redis.Eval(ctx, releaseScript, 1, []string{fmt.Sprintf(consts.API_RESERVED_KEY, reservation.UserId)}, args); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 估算请求的最大花费, 按提示词令牌数加最大输出令牌数由计费引擎计算
+func (mak *MAK) estimateQuota(ctx context.Context) int {
+
+	maxTokens := mak.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = getReservationConfig().DefaultMaxTokens
+	}
+
+	return service.Pricing().Chat(ctx, mak.ReqModel, &model.PricingUsage{
+		PromptTokens:     mak.getPromptTokens(ctx),
+		CompletionTokens: maxTokens,
+	})
+}
+
+// 提示词令牌数, 仅计算一次
+func (mak *MAK) getPromptTokens(ctx context.Context) int {
+
+	if mak.promptTokens == nil {
+
+		promptTokens := 0
+		if len(mak.Messages) > 0 {
+			promptTokens = GetPromptTokens(ctx, mak.ReqModel.Model, mak.Messages)
+		}
+
+		mak.promptTokens = &promptTokens
+	}
+
+	return *mak.promptTokens
+}
+
+// 获取未指定最大输出令牌数时的默认值
+func GetDefaultMaxTokens() int {
+	return getReservationConfig().DefaultMaxTokens
+}
+
+// 获取额度预占配置
+func getReservationConfig() mcommon.QuotaReservation {
+
+	if config.Cfg.QuotaReservation == nil {
+		return mcommon.QuotaReservation{}
+	}
+
+	cfg := *config.Cfg.QuotaReservation
+
+	if cfg.DefaultMaxTokens <= 0 {
+		cfg.DefaultMaxTokens = 4096
+	}
+
+	return cfg
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"context"
+	"github.com/iimeta/fastapi/internal/consts"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 记录上游响应头的传输层, 限流冷却根据上游返回的限流响应头计算冷却时长
+// 仅用于自建HTTP客户端的上游客户端, SDK客户端无法获取响应头, 冷却时长从错误信息中解析
+type upstreamTransport struct {
+	http.RoundTripper
+}
+
+// 上游响应头, 每次请求上游时创建, 对冲等并发请求上游时互不影响
+type upstreamHeader struct {
+	mu     sync.RWMutex
+	header http.Header
+}
+
+// 创建记录上游响应头的传输层, 超时时间为等待上游响应头的时间, 不限制流式响应的读取时长
+func newUpstreamTransport(proxyUrl string, timeout time.Duration) (http.RoundTripper, error) {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
+	if proxyUrl != "" {
+
+		proxy, err := url.Parse(proxyUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &upstreamTransport{RoundTripper: transport}, nil
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	res, err := t.RoundTripper.RoundTrip(req)
+	if res != nil {
+		if h, ok := req.Context().Value(consts.UPSTREAM_HEADER_KEY).(*upstreamHeader); ok {
+			h.mu.Lock()
+			h.header = res.Header
+			h.mu.Unlock()
+		}
+	}
+
+	return res, err
+}
+
+// 创建记录本次请求上游响应头的上下文, 每次请求上游前调用
+func WithUpstreamHeader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consts.UPSTREAM_HEADER_KEY, new(upstreamHeader))
+}
+
+// 获取本次请求上游的响应头
+func GetUpstreamHeader(ctx context.Context) http.Header {
+
+	h, ok := ctx.Value(consts.UPSTREAM_HEADER_KEY).(*upstreamHeader)
+	if !ok {
+		return nil
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.header
+}
@@ -3,11 +3,18 @@ package common
 import (
 	"context"
 	"fmt"
+	"github.com/gogf/gf/v2/os/gctx"
 	"github.com/gogf/gf/v2/os/gtime"
 	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
 	"github.com/iimeta/fastapi/utility/redis"
+	"github.com/iimeta/fastapi/utility/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"time"
 )
 
@@ -19,7 +26,12 @@ func (s *sCommon) RecordUsage(ctx context.Context, totalTokens int, key string)
 		logger.Debugf(ctx, "sCommon RecordUsage time: %d", gtime.TimestampMilli()-now)
 	}()
 
+	reservation := s.takeSettledQuota(ctx)
+
 	if totalTokens == 0 {
+		if reservation != nil {
+			s.releaseReservedQuota(ctx, reservation)
+		}
 		return nil
 	}
 
@@ -29,72 +41,75 @@ func (s *sCommon) RecordUsage(ctx context.Context, totalTokens int, key string)
 
 	logger.Infof(ctx, "sCommon RecordUsage userId: %d, appId: %d, appKey: %s, spendQuota: %d, key: %s", userId, appId, appKey, totalTokens, key)
 
-	usageKey := s.GetUserUsageKey(ctx)
-
-	currentQuota, err := redisSpendQuota(ctx, usageKey, consts.USER_QUOTA_FIELD, totalTokens)
-	if err != nil {
-		logger.Error(ctx, err)
-		panic(err)
+	traceId := gctx.CtxId(ctx)
+	if traceId == "" {
+		traceId = util.GenerateId()
 	}
 
-	if err = mongoSpendQuota(ctx, func() error {
-		return service.User().SpendQuota(ctx, userId, totalTokens, currentQuota)
-	}); err != nil {
-		logger.Error(ctx, err)
-		panic(err)
+	if seq := service.Session().NextBillingSeq(ctx); seq > 1 {
+		traceId = fmt.Sprintf("%s-%d", traceId, seq)
 	}
 
-	if service.Session().GetAppIsLimitQuota(ctx) {
-
-		currentQuota, err = redisSpendQuota(ctx, usageKey, s.GetAppTotalTokensField(ctx), totalTokens)
-		if err != nil {
-			logger.Error(ctx, err)
-			panic(err)
-		}
-
-		if err = mongoSpendQuota(ctx, func() error {
-			return service.App().SpendQuota(ctx, appId, totalTokens, currentQuota)
-		}); err != nil {
-			logger.Error(ctx, err)
-			panic(err)
-		}
-
-	} else {
-		if err = mongoUsedQuota(ctx, func() error {
-			return service.App().UsedQuota(ctx, appId, totalTokens)
-		}); err != nil {
-			logger.Error(ctx, err)
-			panic(err)
-		}
+	ledger := &entity.UsageLedger{
+		TraceId:         traceId,
+		UserId:          userId,
+		AppId:           appId,
+		AppKey:          appKey,
+		Key:             key,
+		SpendQuota:      totalTokens,
+		AppIsLimitQuota: service.Session().GetAppIsLimitQuota(ctx),
+		KeyIsLimitQuota: service.Session().GetKeyIsLimitQuota(ctx),
+		ModelFields:     service.Session().GetModelQuotaFields(ctx),
+		Status:          2,
 	}
 
-	if service.Session().GetKeyIsLimitQuota(ctx) {
+	// 预占额度随各额度字段的花费一并释放
+	if reservation != nil {
+		ledger.ReservedQuota = reservation.Amount
+	}
 
-		currentQuota, err = redisSpendQuota(ctx, usageKey, s.GetKeyTotalTokensField(ctx), totalTokens)
-		if err != nil {
-			logger.Error(ctx, err)
-			panic(err)
+	// 先写入账本再扣减额度, 中途失败时由对账任务补偿
+	if err := mongoSpendQuota(ctx, func() (err error) {
+
+		if ledger.Id, err = dao.UsageLedger.Insert(ctx, &do.UsageLedger{
+			TraceId:         ledger.TraceId,
+			UserId:          ledger.UserId,
+			AppId:           ledger.AppId,
+			AppKey:          ledger.AppKey,
+			Key:             ledger.Key,
+			SpendQuota:      ledger.SpendQuota,
+			ReservedQuota:   ledger.ReservedQuota,
+			AppIsLimitQuota: ledger.AppIsLimitQuota,
+			KeyIsLimitQuota: ledger.KeyIsLimitQuota,
+			ModelFields:     ledger.ModelFields,
+			Status:          ledger.Status,
+		}); err != nil && mongo.IsDuplicateKeyError(err) {
+			// 重试前的写入可能已成功, 日志ID重复时视为已写入
+			existLedger, err := dao.UsageLedger.FindOne(ctx, bson.M{"trace_id": ledger.TraceId})
+			if err != nil {
+				return err
+			}
+			ledger = existLedger
+			return nil
 		}
 
-		if err = mongoSpendQuota(ctx, func() error {
-			return service.App().AppKeySpendQuota(ctx, appKey, totalTokens, currentQuota)
-		}); err != nil {
-			logger.Error(ctx, err)
-			panic(err)
+		return err
+	}); err != nil {
+		logger.Error(ctx, err)
+		if reservation != nil {
+			s.releaseReservedQuota(ctx, reservation)
 		}
+		panic(err)
+	}
 
-	} else {
-		if err = mongoUsedQuota(ctx, func() error {
-			return service.App().AppKeyUsedQuota(ctx, appKey, totalTokens)
-		}); err != nil {
-			logger.Error(ctx, err)
-			panic(err)
-		}
+	// 加锁失败时仍入账, 账本步骤由脚本保证不会重复扣减Redis额度
+	if isLocked, err := s.lockUsageLedger(ctx, ledger.TraceId); err != nil {
+		logger.Error(ctx, err)
+	} else if isLocked {
+		defer s.unlockUsageLedger(ctx, ledger.TraceId)
 	}
 
-	if err = mongoUsedQuota(ctx, func() error {
-		return service.Key().UsedQuota(ctx, key, totalTokens)
-	}); err != nil {
+	if err := s.applyUsageLedger(ctx, ledger); err != nil {
 		logger.Error(ctx, err)
 		panic(err)
 	}
@@ -102,28 +117,6 @@ func (s *sCommon) RecordUsage(ctx context.Context, totalTokens int, key string)
 	return nil
 }
 
-func redisSpendQuota(ctx context.Context, usageKey, field string, totalTokens int, retry ...int) (int, error) {
-
-	currentQuota, err := redis.HIncrBy(ctx, usageKey, field, int64(-totalTokens))
-	if err != nil {
-		logger.Errorf(ctx, "redisSpendQuota usageKey: %s, field: %s, totalTokens: %d, error: %v", usageKey, field, totalTokens, err)
-
-		if len(retry) == 10 {
-			return -1, err
-		}
-
-		retry = append(retry, 1)
-
-		time.Sleep(time.Duration(len(retry)*5) * time.Second)
-
-		logger.Errorf(ctx, "redisSpendQuota usageKey: %s, field: %s, totalTokens: %d, retry: %d", usageKey, field, totalTokens, len(retry))
-
-		return redisSpendQuota(ctx, usageKey, field, totalTokens, retry...)
-	}
-
-	return int(currentQuota), nil
-}
-
 func mongoSpendQuota(ctx context.Context, f func() error, retry ...int) error {
 
 	if err := f(); err != nil {
@@ -145,27 +138,6 @@ func mongoSpendQuota(ctx context.Context, f func() error, retry ...int) error {
 	return nil
 }
 
-func mongoUsedQuota(ctx context.Context, f func() error, retry ...int) error {
-
-	if err := f(); err != nil {
-		logger.Errorf(ctx, "mongoUsedQuota error: %v", err)
-
-		if len(retry) == 10 {
-			return err
-		}
-
-		retry = append(retry, 1)
-
-		time.Sleep(time.Duration(len(retry)*5) * time.Second)
-
-		logger.Errorf(ctx, "mongoUsedQuota retry: %d", len(retry))
-
-		return mongoUsedQuota(ctx, f, retry...)
-	}
-
-	return nil
-}
-
 func (s *sCommon) GetUserTotalTokens(ctx context.Context) (int, error) {
 	return redis.HGetInt(ctx, s.GetUserUsageKey(ctx), consts.USER_QUOTA_FIELD)
 }
@@ -0,0 +1,460 @@
+package completion
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/gogf/gf/v2/util/gconv"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/go-openai"
+	"github.com/iimeta/tiktoken-go"
+)
+
+type sCompletion struct{}
+
+func init() {
+	service.RegisterCompletion(New())
+}
+
+func New() service.ICompletion {
+	return &sCompletion{}
+}
+
+// Completions
+func (s *sCompletion) Completions(ctx context.Context, params openai.CompletionRequest, fallbackModelAgent *model.ModelAgent, fallbackModel *model.Model, retry ...int) (response *model.TextCompletionRes, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCompletion Completions time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if !s.isNative(ctx, params.Model) {
+		return s.chatCompletions(ctx, params)
+	}
+
+	var (
+		mak = &common.MAK{
+			Model:              params.Model,
+			Messages:           getMessages(params.Prompt),
+			MaxTokens:          params.MaxTokens,
+			User:               params.User,
+			FallbackModelAgent: fallbackModelAgent,
+			FallbackModel:      fallbackModel,
+		}
+		client    *openai.Client
+		retryInfo *mcommon.Retry
+		totalTime int64
+	)
+
+	defer func() {
+
+		completionsRes := &model.CompletionsRes{
+			Error:     err,
+			TotalTime: totalTime,
+		}
+
+		if retryInfo == nil && response != nil {
+
+			for _, choice := range response.Choices {
+				completionsRes.Completion += choice.Text
+			}
+
+			if response.Usage != nil {
+				completionsRes.Usage = sdkm.Usage{
+					PromptTokens:     response.Usage.PromptTokens,
+					CompletionTokens: response.Usage.CompletionTokens,
+					TotalTokens:      response.Usage.TotalTokens,
+				}
+			}
+
+			if mak.ReqModel != nil {
+				response.Model = mak.ReqModel.Model
+			}
+		}
+
+		s.record(ctx, mak, params, completionsRes, retryInfo)
+	}()
+
+	if err = mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return response, err
+	}
+
+	request := s.getRequest(mak, params)
+
+	if client, err = common.NewCompletionClient(ctx, mak.Corp, mak.RealModel, mak.RealKey, mak.BaseUrl, mak.Path); err != nil {
+		logger.Error(ctx, err)
+		return response, err
+	}
+
+	// 记录本次请求上游的响应头, 限流冷却据此计算冷却时长
+	ctx = common.WithUpstreamHeader(ctx)
+
+	res, err := client.CreateCompletion(ctx, request)
+	totalTime = gtime.TimestampMilli() - now
+	if err != nil {
+		logger.Error(ctx, err)
+
+		if isRetry := s.handleError(ctx, mak, err); isRetry {
+
+			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
+
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
+					}
+					return s.Completions(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
+				}
+
+				return response, err
+			}
+
+			retryInfo = &mcommon.Retry{
+				IsRetry:    true,
+				RetryCount: len(retry),
+				ErrMsg:     err.Error(),
+			}
+
+			return s.Completions(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel, append(retry, 1)...)
+		}
+
+		return response, err
+	}
+
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, totalTime)
+
+	response = &model.TextCompletionRes{
+		Id:      res.ID,
+		Object:  res.Object,
+		Created: res.Created,
+		Model:   res.Model,
+		Usage: &model.TextCompletionUsage{
+			PromptTokens:     res.Usage.PromptTokens,
+			CompletionTokens: res.Usage.CompletionTokens,
+			TotalTokens:      res.Usage.TotalTokens,
+		},
+	}
+
+	for _, choice := range res.Choices {
+
+		textCompletionChoice := &model.TextCompletionChoice{
+			Text:         choice.Text,
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		}
+
+		if params.LogProbs > 0 {
+			textCompletionChoice.LogProbs = choice.LogProbs
+		}
+
+		response.Choices = append(response.Choices, textCompletionChoice)
+	}
+
+	return response, nil
+}
+
+// 仅支持对话接口的模型, 将提示词包装成用户消息调用对话接口, 计费和日志由对话接口处理
+func (s *sCompletion) chatCompletions(ctx context.Context, params openai.CompletionRequest) (*model.TextCompletionRes, error) {
+
+	request, prompt, err := convToChatCompletionRequest(params)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	response, err := service.Chat().Completions(ctx, request, nil, nil)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	res := &model.TextCompletionRes{
+		Id:      consts.TEXT_COMPLETION_ID_PREFIX + gstr.TrimLeftStr(response.ID, consts.COMPLETION_ID_PREFIX),
+		Object:  consts.TEXT_COMPLETION_OBJECT,
+		Created: response.Created,
+		Model:   response.Model,
+	}
+
+	for _, choice := range response.Choices {
+
+		if choice.Message == nil {
+			continue
+		}
+
+		text := gconv.String(choice.Message.Content)
+		if params.Echo {
+			text = prompt + text
+		}
+
+		textCompletionChoice := &model.TextCompletionChoice{
+			Text:         text,
+			Index:        choice.Index,
+			FinishReason: string(choice.FinishReason),
+		}
+
+		if params.LogProbs > 0 {
+			textCompletionChoice.LogProbs, _ = convToLogProbs(choice.LogProbs, len(prompt))
+		}
+
+		res.Choices = append(res.Choices, textCompletionChoice)
+	}
+
+	if response.Usage != nil {
+		res.Usage = &model.TextCompletionUsage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		}
+	}
+
+	return res, nil
+}
+
+// 请求模型是否支持原生文本补全接口, 获取模型失败时交由对话接口返回错误
+func (s *sCompletion) isNative(ctx context.Context, m string) bool {
+
+	reqModel, err := service.Model().GetModelBySecretKey(ctx, m, service.Session().GetSecretKey(ctx))
+	if err != nil {
+		return false
+	}
+
+	return reqModel.IsSupportCompletions
+}
+
+// 替换成实际模型并按预设配置调整MaxTokens取值范围
+func (s *sCompletion) getRequest(mak *common.MAK, params openai.CompletionRequest) openai.CompletionRequest {
+
+	request := params
+
+	if !gstr.Contains(mak.RealModel.Model, "*") {
+		request.Model = mak.RealModel.Model
+	}
+
+	if mak.RealModel.IsEnablePresetConfig && request.MaxTokens != 0 {
+		if mak.RealModel.PresetConfig.MinTokens != 0 && request.MaxTokens < mak.RealModel.PresetConfig.MinTokens {
+			request.MaxTokens = mak.RealModel.PresetConfig.MinTokens
+		} else if mak.RealModel.PresetConfig.MaxTokens != 0 && request.MaxTokens > mak.RealModel.PresetConfig.MaxTokens {
+			request.MaxTokens = mak.RealModel.PresetConfig.MaxTokens
+		}
+	}
+
+	return request
+}
+
+// 记录错误次数和禁用, 返回是否需要重试
+func (s *sCompletion) handleError(ctx context.Context, mak *common.MAK, err error) bool {
+
+	service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
+
+	isRetry, isDisabled := common.IsNeedRetry(err)
+
+	if isDisabled {
+		if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+			if mak.RealModel.IsEnableModelAgent {
+				service.ModelAgent().DisabledModelAgentKey(ctx, mak.Key, err.Error())
+			} else {
+				service.Key().DisabledModelKey(ctx, mak.Key, err.Error())
+			}
+		}, nil); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+
+	return isRetry
+}
+
+// 原生文本补全的计费和日志, 上游未返回用量时按令牌数计算
+func (s *sCompletion) record(ctx context.Context, mak *common.MAK, params openai.CompletionRequest, completionsRes *model.CompletionsRes, retryInfo *mcommon.Retry) {
+
+	enterTime := g.RequestFromCtx(ctx).EnterTime.TimestampMilli()
+
+	completionsRes.EnterTime = enterTime
+	completionsRes.InternalTime = gtime.TimestampMilli() - enterTime - completionsRes.TotalTime
+
+	totalTokens := 0
+
+	if retryInfo == nil && (completionsRes.Error == nil || common.IsAborted(completionsRes.Error)) && mak.ReqModel != nil {
+
+		if completionsRes.Usage.TotalTokens == 0 {
+
+			tokenModel := mak.ReqModel.Model
+			if !tiktoken.IsEncodingForModel(tokenModel) {
+				tokenModel = consts.DEFAULT_MODEL
+			}
+
+			for _, message := range mak.Messages {
+				completionsRes.Usage.PromptTokens += common.GetCompletionTokens(ctx, tokenModel, gconv.String(message.Content))
+			}
+
+			completionsRes.Usage.CompletionTokens = common.GetCompletionTokens(ctx, tokenModel, completionsRes.Completion)
+			completionsRes.Usage.TotalTokens = completionsRes.Usage.PromptTokens + completionsRes.Usage.CompletionTokens
+		}
+
+		totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, common.GetPricingUsage(&completionsRes.Usage))
+
+		// 预占额度由记录使用额度随实际花费一并释放
+		service.Common().SettleQuota(ctx)
+
+		if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
+			if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
+				logger.Error(ctx, err)
+				panic(err)
+			}
+		}); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+
+	if retryInfo != nil {
+		completionsRes.Completion = ""
+		completionsRes.Usage = sdkm.Usage{}
+	} else {
+		completionsRes.Usage.TotalTokens = totalTokens
+	}
+
+	if mak.ReqModel != nil && mak.RealModel != nil {
+		if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
+
+			mak.RealModel.ModelAgent = mak.ModelAgent
+
+			completionsReq := &sdkm.ChatCompletionRequest{
+				Model:    params.Model,
+				Messages: mak.Messages,
+				Stream:   params.Stream,
+			}
+
+			service.Chat().SaveLog(ctx, mak.ReqModel, mak.RealModel, mak.FallbackModelAgent, mak.FallbackModel, mak.Key, completionsReq, completionsRes, retryInfo, false)
+
+		}); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+}
+
+// 转换成对话请求, 对话接口无法表达的suffix、best_of和多个提示词返回不支持, 避免静默丢弃参数
+func convToChatCompletionRequest(params openai.CompletionRequest) (sdkm.ChatCompletionRequest, string, error) {
+
+	if params.Suffix != "" {
+		return sdkm.ChatCompletionRequest{}, "", errors.NewError(400, "unsupported_parameter", "The suffix parameter is not supported for this model.", "fastapi_request_error")
+	}
+
+	if params.BestOf > 1 {
+		return sdkm.ChatCompletionRequest{}, "", errors.NewError(400, "unsupported_parameter", "The best_of parameter is not supported for this model.", "fastapi_request_error")
+	}
+
+	prompt, ok := params.Prompt.(string)
+	if !ok {
+		if prompts, isSlice := params.Prompt.([]interface{}); isSlice {
+
+			if len(prompts) > 1 {
+				return sdkm.ChatCompletionRequest{}, "", errors.NewError(400, "unsupported_parameter", "Multiple prompts are not supported for this model.", "fastapi_request_error")
+			}
+
+			if len(prompts) == 1 {
+				prompt, ok = prompts[0].(string)
+			}
+		}
+	}
+
+	if !ok || prompt == "" {
+		return sdkm.ChatCompletionRequest{}, "", errors.ERR_INVALID_PARAMETER
+	}
+
+	request := sdkm.ChatCompletionRequest{
+		Model: params.Model,
+		Messages: []sdkm.ChatCompletionMessage{{
+			Role:    consts.ROLE_USER,
+			Content: prompt,
+		}},
+		MaxTokens:        params.MaxTokens,
+		Temperature:      params.Temperature,
+		TopP:             params.TopP,
+		N:                params.N,
+		Stream:           params.Stream,
+		Stop:             params.Stop,
+		PresencePenalty:  params.PresencePenalty,
+		Seed:             params.Seed,
+		FrequencyPenalty: params.FrequencyPenalty,
+		LogitBias:        params.LogitBias,
+		User:             params.User,
+		Store:            params.Store,
+		Metadata:         params.Metadata,
+	}
+
+	if params.LogProbs > 0 {
+		request.LogProbs = true
+		request.TopLogProbs = min(params.LogProbs, 5)
+	}
+
+	return request, prompt, nil
+}
+
+// 转换对话接口的logprobs为文本补全格式, 返回结果和下一个令牌的文本偏移量
+func convToLogProbs(logProbs *openai.LogProbs, offset int) (*openai.LogprobResult, int) {
+
+	if logProbs == nil {
+		return nil, offset
+	}
+
+	result := &openai.LogprobResult{
+		Tokens:        make([]string, 0),
+		TokenLogprobs: make([]float32, 0),
+		TopLogprobs:   make([]map[string]float32, 0),
+		TextOffset:    make([]int, 0),
+	}
+
+	for _, logProb := range logProbs.Content {
+
+		topLogprobs := make(map[string]float32)
+		for _, topLogProb := range logProb.TopLogProbs {
+			topLogprobs[topLogProb.Token] = float32(topLogProb.LogProb)
+		}
+
+		result.Tokens = append(result.Tokens, logProb.Token)
+		result.TokenLogprobs = append(result.TokenLogprobs, float32(logProb.LogProb))
+		result.TopLogprobs = append(result.TopLogprobs, topLogprobs)
+		result.TextOffset = append(result.TextOffset, offset)
+
+		offset += len(logProb.Token)
+	}
+
+	return result, offset
+}
+
+// 提示词转换成消息, 用于计算令牌数和记录日志
+func getMessages(prompt any) []sdkm.ChatCompletionMessage {
+
+	messages := make([]sdkm.ChatCompletionMessage, 0)
+
+	switch prompt := prompt.(type) {
+	case string:
+		messages = append(messages, sdkm.ChatCompletionMessage{
+			Role:    consts.ROLE_USER,
+			Content: prompt,
+		})
+	case []interface{}:
+		for _, value := range prompt {
+			messages = append(messages, sdkm.ChatCompletionMessage{
+				Role:    consts.ROLE_USER,
+				Content: gconv.String(value),
+			})
+		}
+	}
+
+	return messages
+}
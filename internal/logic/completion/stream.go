@@ -0,0 +1,280 @@
+package completion
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/text/gstr"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/util"
+	"github.com/iimeta/go-openai"
+	"io"
+)
+
+// CompletionsStream
+func (s *sCompletion) CompletionsStream(ctx context.Context, params openai.CompletionRequest, fallbackModelAgent *model.ModelAgent, fallbackModel *model.Model, retry ...int) (err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCompletion CompletionsStream time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if !s.isNative(ctx, params.Model) {
+		return s.chatCompletionsStream(ctx, params)
+	}
+
+	var (
+		mak = &common.MAK{
+			Model:              params.Model,
+			Messages:           getMessages(params.Prompt),
+			MaxTokens:          params.MaxTokens,
+			User:               params.User,
+			FallbackModelAgent: fallbackModelAgent,
+			FallbackModel:      fallbackModel,
+		}
+		client     *openai.Client
+		retryInfo  *mcommon.Retry
+		completion string
+		usage      *sdkm.Usage
+		connTime   int64
+		duration   int64
+		totalTime  int64
+	)
+
+	defer func() {
+
+		completionsRes := &model.CompletionsRes{
+			Completion: completion,
+			Error:      err,
+			ConnTime:   connTime,
+			Duration:   duration,
+			TotalTime:  totalTime,
+		}
+
+		if usage != nil {
+			completionsRes.Usage = *usage
+		}
+
+		s.record(ctx, mak, params, completionsRes, retryInfo)
+	}()
+
+	if err = mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	request := s.getRequest(mak, params)
+
+	if client, err = common.NewCompletionClient(ctx, mak.Corp, mak.RealModel, mak.RealKey, mak.BaseUrl, mak.Path); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	// 记录本次请求上游的响应头, 限流冷却据此计算冷却时长
+	ctx = common.WithUpstreamHeader(ctx)
+
+	stream, err := client.CreateCompletionStream(ctx, request)
+	connTime = gtime.TimestampMilli() - now
+	if err != nil {
+		logger.Error(ctx, err)
+
+		totalTime = connTime
+
+		if isRetry := s.handleError(ctx, mak, err); isRetry {
+
+			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
+
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
+					}
+					return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
+				}
+
+				return err
+			}
+
+			retryInfo = &mcommon.Retry{
+				IsRetry:    true,
+				RetryCount: len(retry),
+				ErrMsg:     err.Error(),
+			}
+
+			return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel, append(retry, 1)...)
+		}
+
+		return err
+	}
+
+	defer func() {
+		if err := stream.Close(); err != nil {
+			logger.Error(ctx, err)
+		}
+	}()
+
+	for {
+
+		responseBytes, response, recvErr := stream.Recv()
+
+		totalTime = gtime.TimestampMilli() - now
+		duration = totalTime - connTime
+
+		if recvErr != nil {
+
+			if errors.Is(recvErr, io.EOF) {
+
+				if err = util.SSEServer(ctx, "[DONE]"); err != nil {
+					logger.Error(ctx, err)
+					return err
+				}
+
+				// 记录成功和延迟
+				service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+				service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, totalTime)
+
+				return nil
+			}
+
+			err = recvErr
+			logger.Error(ctx, err)
+
+			// 记录错误次数和禁用
+			s.handleError(ctx, mak, err)
+
+			return err
+		}
+
+		for _, choice := range response.Choices {
+			completion += choice.Text
+		}
+
+		if response.Usage.TotalTokens != 0 {
+			usage = &sdkm.Usage{
+				PromptTokens:     response.Usage.PromptTokens,
+				CompletionTokens: response.Usage.CompletionTokens,
+				TotalTokens:      response.Usage.TotalTokens,
+			}
+		}
+
+		data := make(map[string]interface{})
+		if err = gjson.Unmarshal(responseBytes, &data); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+
+		// 替换成调用的模型
+		if _, ok := data["model"]; ok {
+			data["model"] = mak.ReqModel.Model
+		}
+
+		if err = util.SSEServer(ctx, gjson.MustEncodeString(data)); err != nil {
+			logger.Error(ctx, err)
+			return err
+		}
+	}
+}
+
+// 仅支持对话接口的模型, 通过SSE数据转换器将对话流式数据转换成文本补全格式输出
+func (s *sCompletion) chatCompletionsStream(ctx context.Context, params openai.CompletionRequest) error {
+
+	request, prompt, err := convToChatCompletionRequest(params)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	converter := &streamConverter{
+		prompt:   prompt,
+		echo:     params.Echo,
+		logProbs: params.LogProbs > 0,
+		offsets:  make(map[int]int),
+	}
+
+	g.RequestFromCtx(ctx).SetCtxVar(consts.SESSION_SSE_CONVERTER, util.SSEConverter(converter.convert))
+
+	if err = service.Chat().CompletionsStream(ctx, request, nil, nil); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	return nil
+}
+
+// 流式转换器, 将对话流式数据转换成文本补全格式
+type streamConverter struct {
+	prompt   string
+	echo     bool
+	logProbs bool
+	offsets  map[int]int
+}
+
+// 转换流式数据
+func (c *streamConverter) convert(data string) ([]*util.SSEEvent, error) {
+
+	if data == "[DONE]" {
+		return []*util.SSEEvent{{Data: data}}, nil
+	}
+
+	response := sdkm.ChatCompletionResponse{}
+	if err := gjson.Unmarshal([]byte(data), &response); err != nil {
+		return nil, err
+	}
+
+	res := &model.TextCompletionRes{
+		Id:      consts.TEXT_COMPLETION_ID_PREFIX + gstr.TrimLeftStr(response.ID, consts.COMPLETION_ID_PREFIX),
+		Object:  consts.TEXT_COMPLETION_OBJECT,
+		Created: response.Created,
+		Model:   response.Model,
+		Choices: make([]*model.TextCompletionChoice, 0),
+	}
+
+	for _, choice := range response.Choices {
+
+		textCompletionChoice := &model.TextCompletionChoice{
+			Index:        choice.Index,
+			FinishReason: string(choice.FinishReason),
+		}
+
+		if choice.Delta != nil {
+			textCompletionChoice.Text = choice.Delta.Content
+		}
+
+		offset, ok := c.offsets[choice.Index]
+		if !ok {
+			offset = len(c.prompt)
+			// 首个数据块回显提示词
+			if c.echo {
+				textCompletionChoice.Text = c.prompt + textCompletionChoice.Text
+			}
+		}
+
+		if c.logProbs {
+			textCompletionChoice.LogProbs, offset = convToLogProbs(choice.LogProbs, offset)
+		}
+
+		c.offsets[choice.Index] = offset
+
+		res.Choices = append(res.Choices, textCompletionChoice)
+	}
+
+	if response.Usage != nil {
+		res.Usage = &model.TextCompletionUsage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+			TotalTokens:      response.Usage.TotalTokens,
+		}
+	}
+
+	return []*util.SSEEvent{{Data: gjson.MustEncodeString(res)}}, nil
+}
@@ -0,0 +1,223 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"slices"
+	"time"
+)
+
+// 并发租约保存在有序集合中, 成员为租约ID, 分值为租约过期时间(毫秒), 过期租约在占用和统计时清理
+// ARGV: 当前时间, 最大并发数, 租约过期时间, 租约ID, 租约时长(毫秒), 同一请求已占用时续期, 返回1为占用成功
+const acquireScript = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if not redis.call('ZSCORE', KEYS[1], ARGV[4]) and redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[3], ARGV[4])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`
+
+// ARGV: 当前时间, 返回未过期的租约数
+const countScript = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+return redis.call('ZCARD', KEYS[1])
+`
+
+// ARGV: 队列长度, 过期时间(秒), 返回1为进入队列成功
+const enterQueueScript = `
+if tonumber(redis.call('GET', KEYS[1]) or 0) >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`
+
+const leaveQueueScript = `
+if tonumber(redis.call('GET', KEYS[1]) or 0) > 0 then
+	return redis.call('DECR', KEYS[1])
+end
+return 0
+`
+
+// 排队时检查并发槽位的间隔
+const waitInterval = 100 * time.Millisecond
+
+type sConcurrency struct{}
+
+func init() {
+	service.RegisterConcurrency(New())
+}
+
+func New() service.IConcurrency {
+	return &sConcurrency{}
+}
+
+// 占用并发数, 租约记录到会话中, 请求结束时释放
+func (s *sConcurrency) Acquire(ctx context.Context, typ, id string, limit int) bool {
+
+	if limit <= 0 {
+		return true
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sConcurrency Acquire time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	leaseTime := getConfig().LeaseTime * 1000
+
+	reply, err := redis.Eval(ctx, acquireScript, 1, []string{fmt.Sprintf(consts.CONCURRENCY_KEY, typ, id)}, []interface{}{now, limit, now + leaseTime, gctx.CtxId(ctx), leaseTime})
+	if err != nil {
+		logger.Error(ctx, err)
+		// 出错时不限制, 避免影响请求
+		return true
+	}
+
+	if reply.Int() != 1 {
+		return false
+	}
+
+	service.Session().RecordConcurrencyLease(ctx, &model.ConcurrencyLease{
+		Type: typ,
+		Id:   id,
+	})
+
+	return true
+}
+
+// 释放会话占用的全部并发数
+func (s *sConcurrency) Release(ctx context.Context) {
+
+	leases := service.Session().GetConcurrencyLeases(ctx)
+	if len(leases) == 0 {
+		return
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sConcurrency Release time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	for _, lease := range leases {
+		if _, err := redis.ZRem(ctx, fmt.Sprintf(consts.CONCURRENCY_KEY, lease.Type, lease.Id), gctx.CtxId(ctx)); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+}
+
+// 释放会话占用的指定并发数, 请求切换到其他密钥或模型代理时调用
+func (s *sConcurrency) ReleaseLease(ctx context.Context, typ, id string) {
+
+	if !slices.ContainsFunc(service.Session().GetConcurrencyLeases(ctx), func(lease *model.ConcurrencyLease) bool {
+		return lease.Type == typ && lease.Id == id
+	}) {
+		return
+	}
+
+	if _, err := redis.ZRem(ctx, fmt.Sprintf(consts.CONCURRENCY_KEY, typ, id), gctx.CtxId(ctx)); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	service.Session().RemoveConcurrencyLease(ctx, typ, id)
+}
+
+// 并发数是否已满
+func (s *sConcurrency) IsSaturated(ctx context.Context, typ, id string, limit int) bool {
+
+	if limit <= 0 {
+		return false
+	}
+
+	reply, err := redis.Eval(ctx, countScript, 1, []string{fmt.Sprintf(consts.CONCURRENCY_KEY, typ, id)}, []interface{}{gtime.TimestampMilli()})
+	if err != nil {
+		logger.Error(ctx, err)
+		return false
+	}
+
+	return reply.Int() >= limit
+}
+
+// 排队等待, 直到有可用的并发槽位, 队列已满或等待超时返回错误
+func (s *sConcurrency) Wait(ctx context.Context, queue string, isAvailable func() bool) error {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sConcurrency Wait queue: %s, time: %d", queue, gtime.TimestampMilli()-now)
+	}()
+
+	cfg := getConfig()
+	if cfg.QueueSize <= 0 {
+		return errors.ERR_CONCURRENCY_QUEUE_FULL
+	}
+
+	queueKey := fmt.Sprintf(consts.CONCURRENCY_QUEUE_KEY, queue)
+
+	reply, err := redis.Eval(ctx, enterQueueScript, 1, []string{queueKey}, []interface{}{cfg.QueueSize, cfg.QueueTimeout * 2})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if reply.Int() != 1 {
+		return errors.ERR_CONCURRENCY_QUEUE_FULL
+	}
+
+	defer func() {
+		if _, err := redis.Eval(ctx, leaveQueueScript, 1, []string{queueKey}, nil); err != nil {
+			logger.Error(ctx, err)
+		}
+	}()
+
+	timer := time.NewTimer(time.Duration(cfg.QueueTimeout) * time.Second)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(waitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return errors.ERR_CONCURRENCY_QUEUE_TIMEOUT
+		case <-ticker.C:
+			if isAvailable() {
+				return nil
+			}
+		}
+	}
+}
+
+// 获取并发限制配置
+func getConfig() common.ConcurrencyLimit {
+
+	cfg := common.ConcurrencyLimit{}
+	if config.Cfg.ConcurrencyLimit != nil {
+		cfg = *config.Cfg.ConcurrencyLimit
+	} else {
+		cfg.QueueSize = 100
+	}
+
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = 30
+	}
+
+	if cfg.LeaseTime <= 0 {
+		cfg.LeaseTime = 600
+	}
+
+	return cfg
+}
@@ -0,0 +1,346 @@
+package cooldown
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/text/gregex"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/cache"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"net/http"
+	"time"
+)
+
+// 冷却截止时间保存在 api:rate_limit:cooldown 哈希中, 字段为密钥ID, 值为冷却截止时间(毫秒)
+// ARGV: 密钥ID, 冷却截止时间, 只延长不缩短, 返回实际生效的冷却截止时间
+const cooldownScript = `
+local until = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or 0)
+if tonumber(ARGV[2]) > until then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+	return ARGV[2]
+end
+return tostring(until)
+`
+
+// 上游限流响应头, 剩余数为0时冷却到对应的重置时间
+// OpenAI: x-ratelimit-reset-* 为时长, 如 6m0s / 20ms / 1s
+// Anthropic: anthropic-ratelimit-*-reset 为RFC3339时间
+var rateLimitHeaders = []struct {
+	remaining string
+	reset     string
+}{
+	{"x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"},
+	{"x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"},
+	{"anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"},
+	{"anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"},
+	{"anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-reset"},
+	{"anthropic-ratelimit-output-tokens-remaining", "anthropic-ratelimit-output-tokens-reset"},
+}
+
+// 上游响应头中无重试时间时, 从错误信息中解析重试时间, 依次匹配:
+// OpenAI: Please try again in 6m0s / 20ms / 1.5s
+// Azure: Please retry after 7 seconds
+// Google: "retryDelay": "30s"
+// 通用: retry-after: 30
+var retryPatterns = []string{
+	`(?i)try again in ((?:[0-9.]+(?:ms|s|m|h))+)`,
+	`(?i)retry after ([0-9]+) seconds?`,
+	`(?i)"retryDelay"\s*:\s*"([0-9.]+s)"`,
+	`(?i)retry-after"?\s*[:=]\s*"?([0-9]+)`,
+}
+
+type sCooldown struct {
+	cooldownCache *cache.Cache // [密钥ID]冷却截止时间
+}
+
+func init() {
+
+	ctx := gctx.New()
+	sCooldown := New()
+
+	service.RegisterCooldown(sCooldown)
+	if err := sCooldown.Load(ctx); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+func New() service.ICooldown {
+	return &sCooldown{
+		cooldownCache: cache.New(),
+	}
+}
+
+// 加载冷却中的密钥
+func (s *sCooldown) Load(ctx context.Context) error {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCooldown Load time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	reply, err := redis.HGetAll(ctx, consts.RATE_LIMIT_COOLDOWN_KEY)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if err = s.cooldownCache.Clear(ctx); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	expired := make([]string, 0)
+	for id, until := range reply.MapStrVar() {
+		if until.Int64() > now {
+			s.setCooldown(ctx, &model.Cooldown{Id: id, Until: until.Int64()})
+		} else {
+			expired = append(expired, id)
+		}
+	}
+
+	if len(expired) > 0 {
+		if _, err = redis.HDel(ctx, consts.RATE_LIMIT_COOLDOWN_KEY, expired...); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// 密钥进入限流冷却, 冷却时长优先使用上游响应头中的重试时间, 其次为错误信息中的重试时间
+func (s *sCooldown) Cooldown(ctx context.Context, id string, header http.Header, err error) {
+
+	cfg := getConfig()
+	if !cfg.Open || id == "" {
+		return
+	}
+
+	duration := headerRetryAfter(header)
+	if duration <= 0 {
+		duration = retryAfter(err)
+	}
+
+	if duration <= 0 {
+		duration = time.Duration(cfg.CoolDown) * time.Second
+	}
+
+	s.cooldown(ctx, id, duration)
+}
+
+// 上游响应头中剩余请求数或令牌数为0时, 密钥进入限流冷却直到限额重置
+func (s *sCooldown) CheckRemaining(ctx context.Context, id string, header http.Header) {
+
+	if !getConfig().Open || id == "" || header == nil {
+		return
+	}
+
+	if duration := exhaustedReset(header); duration > 0 {
+		s.cooldown(ctx, id, duration)
+	}
+}
+
+func (s *sCooldown) cooldown(ctx context.Context, id string, duration time.Duration) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCooldown cooldown time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if maxDuration := time.Duration(getConfig().MaxCoolDown) * time.Second; duration > maxDuration {
+		duration = maxDuration
+	}
+
+	reply, err := redis.Eval(ctx, cooldownScript, 1, []string{consts.RATE_LIMIT_COOLDOWN_KEY}, []interface{}{id, now + duration.Milliseconds()})
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	cooldown := &model.Cooldown{
+		Id:    id,
+		Until: gconv.Int64(reply.String()),
+	}
+
+	logger.Infof(ctx, "sCooldown Cooldown id: %s, duration: %s, until: %d", id, duration, cooldown.Until)
+
+	s.setCooldown(ctx, cooldown)
+
+	if err := grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+		if _, err := redis.Publish(ctx, consts.CHANGE_CHANNEL_COOLDOWN, gjson.MustEncodeString(cooldown)); err != nil {
+			logger.Error(ctx, err)
+		}
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 密钥是否处于冷却中
+func (s *sCooldown) IsCooldown(ctx context.Context, id string) bool {
+
+	if !getConfig().Open {
+		return false
+	}
+
+	if untilValue := s.cooldownCache.GetVal(ctx, id); untilValue != nil {
+		return untilValue.(int64) > gtime.TimestampMilli()
+	}
+
+	return false
+}
+
+// 是否开启限流冷却
+func (s *sCooldown) IsOpen() bool {
+	return getConfig().Open
+}
+
+// 变更订阅
+func (s *sCooldown) Subscribe(ctx context.Context, msg string) error {
+
+	cooldown := new(model.Cooldown)
+	if err := gjson.Unmarshal([]byte(msg), &cooldown); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	logger.Infof(ctx, "sCooldown Subscribe: %s", msg)
+
+	s.setCooldown(ctx, cooldown)
+
+	return nil
+}
+
+func (s *sCooldown) setCooldown(ctx context.Context, cooldown *model.Cooldown) {
+
+	duration := time.Duration(cooldown.Until-gtime.TimestampMilli()) * time.Millisecond
+	if duration <= 0 {
+		return
+	}
+
+	if err := s.cooldownCache.Set(ctx, cooldown.Id, cooldown.Until, duration); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 解析上游响应头中的重试时间, 依次使用 retry-after-ms、retry-after 和已耗尽限额的重置时间
+func headerRetryAfter(header http.Header) time.Duration {
+
+	if header == nil {
+		return 0
+	}
+
+	if retryAfterMs := header.Get("retry-after-ms"); gstr.IsNumeric(retryAfterMs) {
+		return time.Duration(gconv.Float64(retryAfterMs) * float64(time.Millisecond))
+	}
+
+	if retryAfter := header.Get("retry-after"); retryAfter != "" {
+
+		// 秒数或HTTP日期
+		if gstr.IsNumeric(retryAfter) {
+			return time.Duration(gconv.Float64(retryAfter) * float64(time.Second))
+		}
+
+		if t, err := http.ParseTime(retryAfter); err == nil {
+			return time.Until(t)
+		}
+	}
+
+	return exhaustedReset(header)
+}
+
+// 已耗尽限额的重置时长, 多个限额耗尽时取最长的
+func exhaustedReset(header http.Header) time.Duration {
+
+	var duration time.Duration
+	for _, rateLimitHeader := range rateLimitHeaders {
+
+		remaining := header.Get(rateLimitHeader.remaining)
+		if remaining == "" || gconv.Int64(remaining) > 0 {
+			continue
+		}
+
+		if reset := resetDuration(header.Get(rateLimitHeader.reset)); reset > duration {
+			duration = reset
+		}
+	}
+
+	return duration
+}
+
+// 解析限额重置时间, 支持秒数、时长和RFC3339时间
+func resetDuration(reset string) time.Duration {
+
+	if reset == "" {
+		return 0
+	}
+
+	if gstr.IsNumeric(reset) {
+		return time.Duration(gconv.Float64(reset) * float64(time.Second))
+	}
+
+	if duration, err := time.ParseDuration(reset); err == nil {
+		return duration
+	}
+
+	if t, err := time.Parse(time.RFC3339, reset); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
+
+// 解析上游错误信息中的重试时间
+func retryAfter(err error) time.Duration {
+
+	if err == nil {
+		return 0
+	}
+
+	for _, pattern := range retryPatterns {
+
+		match, _ := gregex.MatchString(pattern, err.Error())
+		if len(match) < 2 {
+			continue
+		}
+
+		// 纯数字为秒
+		if gstr.IsNumeric(match[1]) {
+			return time.Duration(gconv.Int64(match[1])) * time.Second
+		}
+
+		if duration, err := time.ParseDuration(match[1]); err == nil {
+			return duration
+		}
+	}
+
+	return 0
+}
+
+// 获取限流冷却配置, 未配置的参数使用默认值
+func getConfig() common.RateLimitCooldown {
+
+	if config.Cfg.RateLimitCooldown == nil {
+		return common.RateLimitCooldown{}
+	}
+
+	cfg := *config.Cfg.RateLimitCooldown
+
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 60
+	}
+
+	if cfg.MaxCoolDown <= 0 {
+		cfg.MaxCoolDown = 3600
+	}
+
+	return cfg
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/iimeta/fastapi/internal/config"
 	"github.com/iimeta/fastapi/internal/consts"
 	_ "github.com/iimeta/fastapi/internal/logic/app"
+	_ "github.com/iimeta/fastapi/internal/logic/breaker"
+	_ "github.com/iimeta/fastapi/internal/logic/cooldown"
 	_ "github.com/iimeta/fastapi/internal/logic/corp"
 	_ "github.com/iimeta/fastapi/internal/logic/key"
 	_ "github.com/iimeta/fastapi/internal/logic/model"
@@ -60,6 +62,42 @@ func init() {
 		}
 	})
 
+	_, _ = gcron.AddSingleton(ctx, "0 * * * * ?", func(ctx context.Context) {
+		if err := core.HealthProbe(gctx.New()); err != nil {
+			logger.Error(ctx, err)
+		}
+	})
+
+	_, _ = gcron.AddSingleton(ctx, "0 * * * * ?", func(ctx context.Context) {
+		if err := core.ResetQuotaBudget(gctx.New()); err != nil {
+			logger.Error(ctx, err)
+		}
+	})
+
+	_, _ = gcron.AddSingleton(ctx, "0 * * * * ?", func(ctx context.Context) {
+		if err := core.ResetModelQuota(gctx.New()); err != nil {
+			logger.Error(ctx, err)
+		}
+	})
+
+	_, _ = gcron.AddSingleton(ctx, "0 * * * * ?", func(ctx context.Context) {
+		if err := service.Notice().CheckQuotaExpires(gctx.New()); err != nil {
+			logger.Error(ctx, err)
+		}
+	})
+
+	_, _ = gcron.AddSingleton(ctx, "0 0/5 * * * ?", func(ctx context.Context) {
+		if err := service.Common().ReconcileUsage(gctx.New()); err != nil {
+			logger.Error(ctx, err)
+		}
+	})
+
+	_, _ = gcron.AddSingleton(ctx, "*/10 * * * * ?", func(ctx context.Context) {
+		if err := service.Batch().Dispatch(gctx.New()); err != nil {
+			logger.Error(ctx, err)
+		}
+	})
+
 	channels := make([]string, 0)
 	channels = append(channels, consts.CHANGE_CHANNEL_USER)
 	channels = append(channels, consts.CHANGE_CHANNEL_APP)
@@ -68,6 +106,8 @@ func init() {
 	channels = append(channels, consts.CHANGE_CHANNEL_MODEL)
 	channels = append(channels, consts.CHANGE_CHANNEL_KEY)
 	channels = append(channels, consts.CHANGE_CHANNEL_AGENT)
+	channels = append(channels, consts.CHANGE_CHANNEL_BREAKER)
+	channels = append(channels, consts.CHANGE_CHANNEL_COOLDOWN)
 
 	conn, _, err := redis.Subscribe(ctx, channels[0], channels[1:]...)
 	if err != nil {
@@ -104,6 +144,10 @@ func init() {
 				err = service.Key().Subscribe(ctx, msg.Payload)
 			case config.Cfg.Core.ChannelPrefix + consts.CHANGE_CHANNEL_AGENT:
 				err = service.ModelAgent().Subscribe(ctx, msg.Payload)
+			case config.Cfg.Core.ChannelPrefix + consts.CHANGE_CHANNEL_BREAKER:
+				err = service.Breaker().Subscribe(ctx, msg.Payload)
+			case config.Cfg.Core.ChannelPrefix + consts.CHANGE_CHANNEL_COOLDOWN:
+				err = service.Cooldown().Subscribe(ctx, msg.Payload)
 			}
 
 			if err != nil {
@@ -286,5 +330,15 @@ func (s *sCore) Refresh(ctx context.Context) error {
 		}
 	}
 
+	if err = service.Breaker().Load(ctx); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if err = service.Cooldown().Load(ctx); err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,330 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gredis"
+	"github.com/gogf/gf/v2/os/gtime"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+)
+
+// 健康探测, 恢复自动禁用的模型密钥和模型代理
+func (s *sCore) HealthProbe(ctx context.Context) error {
+
+	if config.Cfg.HealthProbe == nil || !config.Cfg.HealthProbe.Open {
+		return nil
+	}
+
+	interval := config.Cfg.HealthProbe.Interval
+	if interval <= 0 {
+		interval = 300
+	}
+
+	// 多实例下同一探测间隔内只由一个实例执行
+	reply, err := redis.Set(ctx, consts.LOCK_HEALTH_PROBE_KEY, gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &interval},
+		NX:        true,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if reply.IsEmpty() {
+		return nil
+	}
+
+	logger.Info(ctx, "sCore HealthProbe ing...")
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCore HealthProbe time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	keys, err := dao.Key.Find(ctx, bson.M{"type": 2, "status": 2, "is_auto_disabled": true})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, key := range keys {
+		if s.isMaxAttempts(ctx, key.Id) {
+			continue
+		}
+		if err = s.probeKey(ctx, key); err != nil {
+			logger.Infof(ctx, "sCore HealthProbe key: %s, error: %v", key.Id, err)
+			s.recordAttempts(ctx, key.Id)
+			continue
+		}
+		s.restoreKey(ctx, key)
+	}
+
+	results, err := dao.ModelAgent.Find(ctx, bson.M{"status": 2, "is_auto_disabled": true})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if len(results) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0)
+	for _, result := range results {
+		ids = append(ids, result.Id)
+	}
+
+	modelAgents, err := service.ModelAgent().List(ctx, ids)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, modelAgent := range modelAgents {
+		if s.isMaxAttempts(ctx, modelAgent.Id) {
+			continue
+		}
+		if err = s.probeModelAgent(ctx, modelAgent); err != nil {
+			logger.Infof(ctx, "sCore HealthProbe modelAgent: %s, error: %v", modelAgent.Id, err)
+			s.recordAttempts(ctx, modelAgent.Id)
+			continue
+		}
+		s.restoreModelAgent(ctx, modelAgent)
+	}
+
+	return nil
+}
+
+// 探测模型密钥
+func (s *sCore) probeKey(ctx context.Context, key *entity.Key) error {
+
+	if !key.IsAgentsOnly && len(key.Models) > 0 {
+
+		models, err := service.Model().List(ctx, key.Models)
+		if err != nil {
+			return err
+		}
+
+		if m := pickProbeModel(models, nil); m != nil {
+			return probe(ctx, m.Corp, m, key.Key, m.BaseUrl, m.Path)
+		}
+	}
+
+	if len(key.ModelAgents) > 0 {
+
+		modelAgents, err := service.ModelAgent().List(ctx, key.ModelAgents)
+		if err != nil {
+			return err
+		}
+
+		for _, modelAgent := range modelAgents {
+
+			if modelAgent.Status != 1 || len(modelAgent.Models) == 0 {
+				continue
+			}
+
+			models, err := service.Model().List(ctx, modelAgent.Models)
+			if err != nil {
+				return err
+			}
+
+			if m := pickProbeModel(models, key.Models); m != nil {
+				return probe(ctx, modelAgent.Corp, m, key.Key, modelAgent.BaseUrl, modelAgent.Path)
+			}
+		}
+	}
+
+	return errors.New("no available probe model")
+}
+
+// 探测模型代理
+func (s *sCore) probeModelAgent(ctx context.Context, modelAgent *model.ModelAgent) error {
+
+	if len(modelAgent.Models) == 0 {
+		return errors.New("no available probe model")
+	}
+
+	models, err := service.Model().List(ctx, modelAgent.Models)
+	if err != nil {
+		return err
+	}
+
+	m := pickProbeModel(models, nil)
+	if m == nil {
+		return errors.New("no available probe model")
+	}
+
+	keys, err := service.ModelAgent().GetModelAgentKeys(ctx, modelAgent.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if key.Status == 1 {
+			return probe(ctx, modelAgent.Corp, m, key.Key, modelAgent.BaseUrl, modelAgent.Path)
+		}
+	}
+
+	return errors.New("no available model agent key")
+}
+
+// 恢复模型密钥
+func (s *sCore) restoreKey(ctx context.Context, key *entity.Key) {
+
+	if err := dao.Key.UpdateById(ctx, key.Id, bson.M{
+		"status":               1,
+		"is_auto_disabled":     false,
+		"auto_disabled_reason": "",
+	}); err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	newData, err := dao.Key.FindById(ctx, key.Id)
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	if models, err := service.Model().List(ctx, key.Models); err == nil {
+		for _, m := range models {
+			if _, err = redis.HDel(ctx, fmt.Sprintf(consts.ERROR_MODEL_KEY, m.Model), key.Key); err != nil {
+				logger.Error(ctx, err)
+			}
+		}
+	}
+
+	for _, id := range key.ModelAgents {
+		if _, err = redis.HDel(ctx, fmt.Sprintf(consts.ERROR_MODEL_AGENT_KEY, id), key.Key); err != nil {
+			logger.Error(ctx, err)
+		}
+	}
+
+	if _, err = redis.HDel(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, key.Id); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	if _, err = redis.Publish(ctx, consts.CHANGE_CHANNEL_KEY, model.PubMessage{
+		Action:  consts.ACTION_STATUS,
+		NewData: newData,
+	}); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	logger.Infof(ctx, "sCore HealthProbe restore key: %s", key.Id)
+}
+
+// 恢复模型代理
+func (s *sCore) restoreModelAgent(ctx context.Context, modelAgent *model.ModelAgent) {
+
+	if err := dao.ModelAgent.UpdateById(ctx, modelAgent.Id, bson.M{
+		"status":               1,
+		"is_auto_disabled":     false,
+		"auto_disabled_reason": "",
+	}); err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	if models, err := service.Model().List(ctx, modelAgent.Models); err == nil {
+		for _, m := range models {
+			if _, err = redis.HDel(ctx, fmt.Sprintf(consts.ERROR_MODEL_AGENT, m.Model), modelAgent.Id); err != nil {
+				logger.Error(ctx, err)
+			}
+		}
+	}
+
+	if _, err := redis.HDel(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, modelAgent.Id); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	modelAgent.Status = 1
+	modelAgent.IsAutoDisabled = false
+	modelAgent.AutoDisabledReason = ""
+
+	if _, err := redis.Publish(ctx, consts.CHANGE_CHANNEL_AGENT, model.PubMessage{
+		Action:  consts.ACTION_STATUS,
+		NewData: modelAgent,
+	}); err != nil {
+		logger.Error(ctx, err)
+	}
+
+	logger.Infof(ctx, "sCore HealthProbe restore modelAgent: %s", modelAgent.Id)
+}
+
+// 是否已达到最大探测次数
+func (s *sCore) isMaxAttempts(ctx context.Context, id string) bool {
+
+	if config.Cfg.HealthProbe.MaxAttempts <= 0 {
+		return false
+	}
+
+	attempts, err := redis.HGetInt(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, id)
+	if err != nil {
+		logger.Error(ctx, err)
+		return false
+	}
+
+	return int64(attempts) >= config.Cfg.HealthProbe.MaxAttempts
+}
+
+// 记录探测次数
+func (s *sCore) recordAttempts(ctx context.Context, id string) {
+	if _, err := redis.HIncrBy(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, id, 1); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 挑选探测模型, 优先使用配置的探测模型, 否则使用第一个可用的文生文模型
+func pickProbeModel(models []*model.Model, ids []string) *model.Model {
+
+	var probeModel *model.Model
+	for _, m := range models {
+
+		if m.Status != 1 || m.Type != 1 || (len(ids) > 0 && !slices.Contains(ids, m.Id)) {
+			continue
+		}
+
+		if m.Model == config.Cfg.HealthProbe.Model || m.Name == config.Cfg.HealthProbe.Model {
+			return m
+		}
+
+		if probeModel == nil {
+			probeModel = m
+		}
+	}
+
+	return probeModel
+}
+
+// 发送探测请求
+func probe(ctx context.Context, corp string, m *model.Model, key, baseUrl, path string) error {
+
+	client, err := common.NewClient(ctx, corp, m, key, baseUrl, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.ChatCompletion(ctx, sdkm.ChatCompletionRequest{
+		Model: m.Model,
+		Messages: []sdkm.ChatCompletionMessage{{
+			Role:    consts.ROLE_USER,
+			Content: "hi",
+		}},
+		MaxTokens: 1,
+	})
+
+	return err
+}
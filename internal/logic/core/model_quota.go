@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gredis"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+)
+
+// 模型额度上限重置, 每个周期开始时清零应用和应用密钥在各模型上的已用额度
+func (s *sCore) ResetModelQuota(ctx context.Context) error {
+
+	// 多实例下同一分钟内只由一个实例执行
+	ttl := int64(50)
+	reply, err := redis.Set(ctx, consts.LOCK_MODEL_QUOTA_KEY, gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &ttl},
+		NX:        true,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if reply.IsEmpty() {
+		return nil
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCore ResetModelQuota time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	apps, err := dao.App.Find(ctx, bson.M{"model_quota.period": bson.M{"$gt": 0}, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, app := range apps {
+		if err = s.resetAppModelQuota(ctx, app); err != nil {
+			logger.Errorf(ctx, "sCore ResetModelQuota appId: %d, error: %v", app.AppId, err)
+		}
+	}
+
+	keys, err := dao.Key.Find(ctx, bson.M{"type": 1, "model_quota.period": bson.M{"$gt": 0}, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, key := range keys {
+		if err = s.resetAppKeyModelQuota(ctx, key); err != nil {
+			logger.Errorf(ctx, "sCore ResetModelQuota key: %s, error: %v", key.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// 重置应用模型额度上限
+func (s *sCore) resetAppModelQuota(ctx context.Context, app *entity.App) error {
+
+	startAt, err := getPeriodStart(app.ModelQuota.Period, app.ModelQuota.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	if app.ModelQuota.ResetAt >= startAt {
+		return nil
+	}
+
+	if err = s.delModelUsedFields(ctx, fmt.Sprintf(consts.API_USAGE_KEY, app.UserId), fmt.Sprintf("app.%d.", app.AppId)); err != nil {
+		return err
+	}
+
+	if err = dao.App.UpdateById(ctx, app.Id, bson.M{"model_quota.reset_at": startAt}); err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "sCore resetAppModelQuota appId: %d, startAt: %d", app.AppId, startAt)
+
+	return nil
+}
+
+// 重置应用密钥模型额度上限
+func (s *sCore) resetAppKeyModelQuota(ctx context.Context, key *entity.Key) error {
+
+	startAt, err := getPeriodStart(key.ModelQuota.Period, key.ModelQuota.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	if key.ModelQuota.ResetAt >= startAt {
+		return nil
+	}
+
+	if err = s.delModelUsedFields(ctx, fmt.Sprintf(consts.API_USAGE_KEY, key.UserId), fmt.Sprintf("key.%d.%s.", key.AppId, key.Key)); err != nil {
+		return err
+	}
+
+	if err = dao.Key.UpdateById(ctx, key.Id, bson.M{"model_quota.reset_at": startAt}); err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "sCore resetAppKeyModelQuota key: %s, startAt: %d", key.Key, startAt)
+
+	return nil
+}
+
+// 删除指定前缀下模型和模型类型的已用额度字段
+func (s *sCore) delModelUsedFields(ctx context.Context, usageKey, prefix string) error {
+
+	reply, err := redis.HGetAll(ctx, usageKey)
+	if err != nil {
+		return err
+	}
+
+	fields := make([]string, 0)
+	for field := range reply.Map() {
+		if strings.HasPrefix(field, prefix) && strings.HasSuffix(field, ".used") {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	_, err = redis.HDel(ctx, usageKey, fields...)
+
+	return err
+}
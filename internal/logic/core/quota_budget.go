@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gredis"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// 额度预算重置, 每个周期开始时将应用和应用密钥的额度重置为周期额度, 并记录上一周期的使用情况
+func (s *sCore) ResetQuotaBudget(ctx context.Context) error {
+
+	// 多实例下同一分钟内只由一个实例执行
+	ttl := int64(50)
+	reply, err := redis.Set(ctx, consts.LOCK_QUOTA_BUDGET_KEY, gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &ttl},
+		NX:        true,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if reply.IsEmpty() {
+		return nil
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sCore ResetQuotaBudget time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	apps, err := dao.App.Find(ctx, bson.M{"is_limit_quota": true, "quota_budget.period": bson.M{"$gt": 0}, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, app := range apps {
+		if err = s.resetAppQuotaBudget(ctx, app); err != nil {
+			logger.Errorf(ctx, "sCore ResetQuotaBudget appId: %d, error: %v", app.AppId, err)
+		}
+	}
+
+	keys, err := dao.Key.Find(ctx, bson.M{"type": 1, "is_limit_quota": true, "quota_budget.period": bson.M{"$gt": 0}, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, key := range keys {
+		if err = s.resetAppKeyQuotaBudget(ctx, key); err != nil {
+			logger.Errorf(ctx, "sCore ResetQuotaBudget key: %s, error: %v", key.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// 重置应用额度预算
+func (s *sCore) resetAppQuotaBudget(ctx context.Context, app *entity.App) error {
+
+	startAt, err := getPeriodStart(app.QuotaBudget.Period, app.QuotaBudget.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	if app.QuotaBudget.ResetAt >= startAt {
+		return nil
+	}
+
+	usageKey := fmt.Sprintf(consts.API_USAGE_KEY, app.UserId)
+	field := fmt.Sprintf(consts.APP_QUOTA_FIELD, app.AppId)
+
+	if err = s.saveQuotaBudgetLog(ctx, &do.QuotaBudgetLog{
+		Type:      consts.QUOTA_BUDGET_TYPE_APP,
+		UserId:    app.UserId,
+		AppId:     app.AppId,
+		Period:    app.QuotaBudget.Period,
+		Allowance: app.QuotaBudget.Allowance,
+		UsedQuota: app.UsedQuota - app.QuotaBudget.ResetUsedQuota,
+		StartAt:   app.QuotaBudget.ResetAt,
+		EndAt:     startAt,
+	}, usageKey, field); err != nil {
+		return err
+	}
+
+	if err = dao.App.UpdateById(ctx, app.Id, bson.M{
+		"quota":                         app.QuotaBudget.Allowance,
+		"quota_budget.reset_at":         startAt,
+		"quota_budget.reset_used_quota": app.UsedQuota,
+	}); err != nil {
+		return err
+	}
+
+	if _, err = redis.HSetStrAny(ctx, usageKey, field, app.QuotaBudget.Allowance); err != nil {
+		return err
+	}
+
+	newData, err := dao.App.FindById(ctx, app.Id)
+	if err != nil {
+		return err
+	}
+
+	if _, err = redis.Publish(ctx, consts.CHANGE_CHANNEL_APP, model.PubMessage{
+		Action:  consts.ACTION_QUOTA,
+		OldData: app,
+		NewData: newData,
+	}); err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "sCore resetAppQuotaBudget appId: %d, allowance: %d, startAt: %d", app.AppId, app.QuotaBudget.Allowance, startAt)
+
+	return nil
+}
+
+// 重置应用密钥额度预算
+func (s *sCore) resetAppKeyQuotaBudget(ctx context.Context, key *entity.Key) error {
+
+	startAt, err := getPeriodStart(key.QuotaBudget.Period, key.QuotaBudget.TimeZone)
+	if err != nil {
+		return err
+	}
+
+	if key.QuotaBudget.ResetAt >= startAt {
+		return nil
+	}
+
+	usageKey := fmt.Sprintf(consts.API_USAGE_KEY, key.UserId)
+	field := fmt.Sprintf(consts.KEY_QUOTA_FIELD, key.AppId, key.Key)
+
+	if err = s.saveQuotaBudgetLog(ctx, &do.QuotaBudgetLog{
+		Type:      consts.QUOTA_BUDGET_TYPE_APP_KEY,
+		UserId:    key.UserId,
+		AppId:     key.AppId,
+		Key:       key.Key,
+		Period:    key.QuotaBudget.Period,
+		Allowance: key.QuotaBudget.Allowance,
+		UsedQuota: key.UsedQuota - key.QuotaBudget.ResetUsedQuota,
+		StartAt:   key.QuotaBudget.ResetAt,
+		EndAt:     startAt,
+	}, usageKey, field); err != nil {
+		return err
+	}
+
+	if err = dao.Key.UpdateById(ctx, key.Id, bson.M{
+		"quota":                         key.QuotaBudget.Allowance,
+		"quota_budget.reset_at":         startAt,
+		"quota_budget.reset_used_quota": key.UsedQuota,
+	}); err != nil {
+		return err
+	}
+
+	if _, err = redis.HSetStrAny(ctx, usageKey, field, key.QuotaBudget.Allowance); err != nil {
+		return err
+	}
+
+	newData, err := dao.Key.FindById(ctx, key.Id)
+	if err != nil {
+		return err
+	}
+
+	if _, err = redis.Publish(ctx, consts.CHANGE_CHANNEL_APP_KEY, model.PubMessage{
+		Action:  consts.ACTION_QUOTA,
+		OldData: key,
+		NewData: newData,
+	}); err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "sCore resetAppKeyQuotaBudget key: %s, allowance: %d, startAt: %d", key.Key, key.QuotaBudget.Allowance, startAt)
+
+	return nil
+}
+
+// 记录上一周期的使用情况, 首次重置时没有上一周期不记录
+func (s *sCore) saveQuotaBudgetLog(ctx context.Context, budgetLog *do.QuotaBudgetLog, usageKey, field string) error {
+
+	if budgetLog.StartAt == 0 {
+		return nil
+	}
+
+	remainQuota, err := redis.HGetInt(ctx, usageKey, field)
+	if err != nil {
+		return err
+	}
+
+	budgetLog.RemainQuota = remainQuota
+	budgetLog.CreatedAt = gtime.TimestampMilli()
+
+	if _, err = dao.QuotaBudgetLog.Insert(ctx, budgetLog); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 获取当前周期开始时间, 按配置的时区计算, 每周从周一开始
+func getPeriodStart(period int, timeZone string) (int64, error) {
+
+	location := time.Local
+	if timeZone != "" {
+
+		var err error
+		if location, err = time.LoadLocation(timeZone); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now().In(location)
+	year, month, day := now.Date()
+
+	switch period {
+	case 1:
+		return time.Date(year, month, day, 0, 0, 0, 0, location).UnixMilli(), nil
+	case 2:
+		return time.Date(year, month, day-(int(now.Weekday())+6)%7, 0, 0, 0, 0, location).UnixMilli(), nil
+	case 3:
+		return time.Date(year, month, 1, 0, 0, 0, 0, location).UnixMilli(), nil
+	}
+
+	return 0, fmt.Errorf("invalid period: %d", period)
+}
@@ -3,11 +3,18 @@ package dashboard
 import (
 	"context"
 	"github.com/gogf/gf/v2/os/gtime"
-	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
 	"github.com/iimeta/fastapi/internal/model"
+	mcommon "github.com/iimeta/fastapi/internal/model/common"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
+	"go.mongodb.org/mongo-driver/bson"
 	"math"
+	"slices"
+	"strings"
+	"time"
 )
 
 type sDashboard struct{}
@@ -28,7 +35,10 @@ func (s *sDashboard) Subscription(ctx context.Context) (*model.DashboardSubscrip
 		logger.Debugf(ctx, "sDashboard Subscription time: %d", gtime.TimestampMilli()-now)
 	}()
 
-	quota := 0
+	var (
+		quota     = 0
+		softLimit *mcommon.SoftLimit
+	)
 
 	if service.Session().GetAppIsLimitQuota(ctx) {
 
@@ -39,6 +49,7 @@ func (s *sDashboard) Subscription(ctx context.Context) (*model.DashboardSubscrip
 		}
 
 		quota = app.Quota
+		softLimit = app.SoftLimit
 	}
 
 	if service.Session().GetKeyIsLimitQuota(ctx) {
@@ -50,6 +61,7 @@ func (s *sDashboard) Subscription(ctx context.Context) (*model.DashboardSubscrip
 		}
 
 		quota = key.Quota
+		softLimit = key.SoftLimit
 	}
 
 	if quota == 0 {
@@ -61,26 +73,41 @@ func (s *sDashboard) Subscription(ctx context.Context) (*model.DashboardSubscrip
 		}
 
 		quota = user.Quota
+		softLimit = user.SoftLimit
+	}
+
+	// 按配置的显示货币换算金额, 字段名沿用OpenAI接口
+	amount := round(common.QuotaToAmount(quota, common.GetQuotaCurrency()), 4)
+
+	// 软限制为剩余额度降到软限制额度前可用的金额
+	softLimitAmount := amount
+	if softLimit != nil && softLimit.Quota > 0 {
+		softLimitAmount = round(common.QuotaToAmount(max(quota-softLimit.Quota, 0), common.GetQuotaCurrency()), 4)
 	}
 
 	return &model.DashboardSubscriptionRes{
 		Object:             "billing_subscription",
 		HasPaymentMethod:   true,
-		SoftLimitUSD:       round(float64(quota)/consts.QUOTA_USD_UNIT, 4),
-		HardLimitUSD:       round(float64(quota)/consts.QUOTA_USD_UNIT, 4),
-		SystemHardLimitUSD: round(float64(quota)/consts.QUOTA_USD_UNIT, 4),
+		SoftLimitUSD:       softLimitAmount,
+		HardLimitUSD:       amount,
+		SystemHardLimitUSD: amount,
 		AccessUntil:        0,
 	}, nil
 }
 
 // Usage
-func (s *sDashboard) Usage(ctx context.Context) (*model.DashboardUsageRes, error) {
+func (s *sDashboard) Usage(ctx context.Context, params model.DashboardUsageReq) (*model.DashboardUsageRes, error) {
 
 	now := gtime.TimestampMilli()
 	defer func() {
 		logger.Debugf(ctx, "sDashboard Usage time: %d", gtime.TimestampMilli()-now)
 	}()
 
+	// 指定日期范围时按日期和模型统计日志中的用量
+	if params.StartDate != "" || params.EndDate != "" {
+		return s.dailyUsage(ctx, params)
+	}
+
 	usedQuota := 0
 
 	if service.Session().GetAppIsLimitQuota(ctx) {
@@ -118,10 +145,215 @@ func (s *sDashboard) Usage(ctx context.Context) (*model.DashboardUsageRes, error
 
 	return &model.DashboardUsageRes{
 		Object:     "list",
-		TotalUsage: round(float64(usedQuota)/consts.QUOTA_USD_UNIT, 4),
+		TotalUsage: round(common.QuotaToAmount(usedQuota, common.GetQuotaCurrency()), 4),
 	}, nil
 }
 
+// 按日期和模型统计用量, 限制额度的密钥优先, 其次是限制额度的应用, 否则统计用户的用量
+func (s *sDashboard) dailyUsage(ctx context.Context, params model.DashboardUsageReq) (*model.DashboardUsageRes, error) {
+
+	startDate, endDate, err := getUsageDateRange(params)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	filter := bson.M{
+		"user_id":  service.Session().GetUserId(ctx),
+		"req_date": bson.M{"$gte": startDate.Format(time.DateOnly), "$lt": endDate.Format(time.DateOnly)},
+		"status":   bson.M{"$in": []int{1, 2}},
+	}
+
+	if service.Session().GetKeyIsLimitQuota(ctx) {
+		filter["creator"] = service.Session().GetSecretKey(ctx)
+	} else if service.Session().GetAppIsLimitQuota(ctx) {
+		filter["app_id"] = service.Session().GetAppId(ctx)
+	}
+
+	// 按记录时的额度单位和汇率计算金额, 记录时的货币与当前显示货币不同或未记录时按当前汇率计算
+	quotaCurrency := common.GetQuotaCurrency()
+
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{
+			"_id":                bson.M{"req_date": "$req_date", "model": "$model"},
+			"requests":           bson.M{"$sum": 1},
+			"prompt_tokens":      bson.M{"$sum": "$prompt_tokens"},
+			"completion_tokens":  bson.M{"$sum": "$completion_tokens"},
+			"cache_write_tokens": bson.M{"$sum": "$cache_write_tokens"},
+			"cache_hit_tokens":   bson.M{"$sum": "$cache_hit_tokens"},
+			"total_tokens":       bson.M{"$sum": "$total_tokens"},
+			"cost": bson.M{"$sum": bson.M{"$multiply": bson.A{
+				bson.M{"$divide": bson.A{"$total_tokens", bson.M{"$ifNull": bson.A{"$quota_currency.unit", quotaCurrency.Unit}}}},
+				bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{"$quota_currency.currency", quotaCurrency.Currency}},
+					"$quota_currency.exchange_rate",
+					quotaCurrency.ExchangeRate,
+				}},
+			}}},
+		}},
+	}
+
+	results := make([]*usageResult, 0)
+	for _, aggregate := range []func(ctx context.Context, pipeline []bson.M, result interface{}) error{
+		dao.Chat.Aggregate,
+		dao.Image.Aggregate,
+		dao.Audio.Aggregate,
+		dao.Midjourney.Aggregate,
+	} {
+
+		result := make([]*usageResult, 0)
+		if err = aggregate(ctx, pipeline, &result); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+
+		results = append(results, result...)
+	}
+
+	// 同一日期同一模型在多个日志集合中的用量合并
+	dailyModels := make(map[string]map[string]*model.DashboardUsageItem)
+	for _, result := range results {
+
+		if dailyModels[result.Id.ReqDate] == nil {
+			dailyModels[result.Id.ReqDate] = make(map[string]*model.DashboardUsageItem)
+		}
+
+		item := dailyModels[result.Id.ReqDate][result.Id.Model]
+		if item == nil {
+			item = &model.DashboardUsageItem{Model: result.Id.Model}
+			dailyModels[result.Id.ReqDate][result.Id.Model] = item
+		}
+
+		addUsageItem(item, &model.DashboardUsageItem{
+			Requests:         result.Requests,
+			PromptTokens:     result.PromptTokens,
+			CompletionTokens: result.CompletionTokens,
+			CacheWriteTokens: result.CacheWriteTokens,
+			CacheHitTokens:   result.CacheHitTokens,
+			TotalTokens:      result.TotalTokens,
+			Cost:             result.Cost,
+		})
+	}
+
+	usageRes := &model.DashboardUsageRes{
+		Object:     "list",
+		DailyCosts: make([]*model.DashboardDailyCost, 0),
+	}
+
+	usageFastAPI := &model.DashboardUsageFastAPI{
+		Currency:  quotaCurrency.Currency,
+		StartDate: startDate.Format(time.DateOnly),
+		EndDate:   endDate.Format(time.DateOnly),
+		Total:     &model.DashboardUsageItem{},
+		Daily:     make([]*model.DashboardUsageDaily, 0),
+	}
+
+	for date := startDate; date.Before(endDate); date = date.AddDate(0, 0, 1) {
+
+		models := make([]*model.DashboardUsageItem, 0)
+		for _, item := range dailyModels[date.Format(time.DateOnly)] {
+			models = append(models, item)
+		}
+
+		slices.SortFunc(models, func(a, b *model.DashboardUsageItem) int {
+			return strings.Compare(a.Model, b.Model)
+		})
+
+		dailyCost := &model.DashboardDailyCost{
+			Timestamp: float64(date.Unix()),
+			LineItems: make([]*model.DashboardLineItem, 0),
+		}
+
+		daily := &model.DashboardUsageDaily{
+			Date:   date.Format(time.DateOnly),
+			Total:  &model.DashboardUsageItem{},
+			Models: models,
+		}
+
+		for _, item := range models {
+
+			addUsageItem(daily.Total, item)
+
+			item.Cost = round(item.Cost, 4)
+
+			dailyCost.LineItems = append(dailyCost.LineItems, &model.DashboardLineItem{
+				Name: item.Model,
+				Cost: item.Cost,
+			})
+		}
+
+		addUsageItem(usageFastAPI.Total, daily.Total)
+
+		daily.Total.Cost = round(daily.Total.Cost, 4)
+
+		usageRes.DailyCosts = append(usageRes.DailyCosts, dailyCost)
+		usageFastAPI.Daily = append(usageFastAPI.Daily, daily)
+	}
+
+	usageFastAPI.Total.Cost = round(usageFastAPI.Total.Cost, 4)
+	usageRes.TotalUsage = usageFastAPI.Total.Cost
+
+	if params.IsFastAPI {
+		usageRes.FastAPI = usageFastAPI
+	}
+
+	return usageRes, nil
+}
+
+// 日志用量统计结果
+type usageResult struct {
+	Id struct {
+		ReqDate string `bson:"req_date"`
+		Model   string `bson:"model"`
+	} `bson:"_id"`
+	Requests         int     `bson:"requests"`
+	PromptTokens     int     `bson:"prompt_tokens"`
+	CompletionTokens int     `bson:"completion_tokens"`
+	CacheWriteTokens int     `bson:"cache_write_tokens"`
+	CacheHitTokens   int     `bson:"cache_hit_tokens"`
+	TotalTokens      int     `bson:"total_tokens"`
+	Cost             float64 `bson:"cost"`
+}
+
+// 累加用量
+func addUsageItem(total, item *model.DashboardUsageItem) {
+	total.Requests += item.Requests
+	total.PromptTokens += item.PromptTokens
+	total.CompletionTokens += item.CompletionTokens
+	total.CacheWriteTokens += item.CacheWriteTokens
+	total.CacheHitTokens += item.CacheHitTokens
+	total.TotalTokens += item.TotalTokens
+	total.Cost += item.Cost
+}
+
+// 解析日期范围, 未指定结束日期时统计到今天, 未指定开始日期时统计结束日期前30天, 最多统计100天
+func getUsageDateRange(params model.DashboardUsageReq) (startDate, endDate time.Time, err error) {
+
+	endDate = time.Now().AddDate(0, 0, 1)
+	endDate = time.Date(endDate.Year(), endDate.Month(), endDate.Day(), 0, 0, 0, 0, time.Local)
+
+	if params.EndDate != "" {
+		if endDate, err = time.ParseInLocation(time.DateOnly, params.EndDate, time.Local); err != nil {
+			return startDate, endDate, errors.ERR_INVALID_PARAMETER
+		}
+	}
+
+	startDate = endDate.AddDate(0, 0, -30)
+
+	if params.StartDate != "" {
+		if startDate, err = time.ParseInLocation(time.DateOnly, params.StartDate, time.Local); err != nil {
+			return startDate, endDate, errors.ERR_INVALID_PARAMETER
+		}
+	}
+
+	if !startDate.Before(endDate) || endDate.Sub(startDate) > 100*24*time.Hour {
+		return startDate, endDate, errors.ERR_INVALID_PARAMETER
+	}
+
+	return startDate, endDate, nil
+}
+
 func round(f float64, n int) float64 {
 	n10 := math.Pow10(n)
 	return math.Trunc((f+0.5/n10)*n10) / n10
@@ -19,7 +19,6 @@ import (
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
 	"github.com/iimeta/fastapi/utility/util"
-	"math"
 	"slices"
 	"time"
 )
@@ -59,14 +58,13 @@ func (s *sEmbedding) Embeddings(ctx context.Context, params sdkm.EmbeddingReques
 		internalTime := gtime.TimestampMilli() - enterTime - response.TotalTime
 
 		if mak.ReqModel != nil && response.Usage != nil {
-			if mak.ReqModel.TextQuota.BillingMethod == 1 {
-				totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(response.Usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-			} else {
-				totalTokens = mak.ReqModel.TextQuota.FixedQuota
-			}
+			totalTokens = service.Pricing().Text(ctx, mak.ReqModel.TextQuota, common.GetPricingUsage(response.Usage))
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -123,7 +121,7 @@ func (s *sEmbedding) Embeddings(ctx context.Context, params sdkm.EmbeddingReques
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -143,29 +141,14 @@ func (s *sEmbedding) Embeddings(ctx context.Context, params sdkm.EmbeddingReques
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Embeddings(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Embeddings(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Embeddings(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -183,6 +166,10 @@ func (s *sEmbedding) Embeddings(ctx context.Context, params sdkm.EmbeddingReques
 		return response, err
 	}
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -253,6 +240,7 @@ func (s *sEmbedding) SaveLog(ctx context.Context, reqModel, realModel *model.Mod
 				BaseUrl: realModel.ModelAgent.BaseUrl,
 				Path:    realModel.ModelAgent.Path,
 				Weight:  realModel.ModelAgent.Weight,
+				Cost:    realModel.ModelAgent.Cost,
 				Remark:  realModel.ModelAgent.Remark,
 				Status:  realModel.ModelAgent.Status,
 			}
@@ -262,6 +250,7 @@ func (s *sEmbedding) SaveLog(ctx context.Context, reqModel, realModel *model.Mod
 	chat.PromptTokens = completionsRes.Usage.PromptTokens
 	chat.CompletionTokens = completionsRes.Usage.CompletionTokens
 	chat.TotalTokens = completionsRes.Usage.TotalTokens
+	chat.QuotaCurrency = common.GetQuotaCurrency()
 
 	if fallbackModelAgent != nil {
 		chat.IsEnableFallback = true
@@ -280,6 +269,14 @@ func (s *sEmbedding) SaveLog(ctx context.Context, reqModel, realModel *model.Mod
 		chat.FallbackConfig.ModelName = fallbackModel.Name
 	}
 
+	if fallbacks := service.Session().GetFallbacks(ctx); len(fallbacks) > 0 {
+		chat.IsEnableFallback = true
+		if chat.FallbackConfig == nil {
+			chat.FallbackConfig = new(mcommon.FallbackConfig)
+		}
+		chat.FallbackConfig.Path = fallbacks
+	}
+
 	if key != nil {
 		chat.Key = key.Key
 	}
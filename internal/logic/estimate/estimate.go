@@ -0,0 +1,292 @@
+package estimate
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/gogf/gf/v2/util/gconv"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/util"
+	"github.com/iimeta/tiktoken-go"
+	"math"
+)
+
+type sEstimate struct{}
+
+func init() {
+	service.RegisterEstimate(New())
+}
+
+func New() service.IEstimate {
+	return &sEstimate{}
+}
+
+// 对话费用预估
+func (s *sEstimate) ChatCompletions(ctx context.Context, params sdkm.ChatCompletionRequest) (*model.EstimateRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sEstimate ChatCompletions time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if len(params.Functions) == 0 {
+		params.Messages = common.HandleMessages(params.Messages)
+		if len(params.Messages) == 0 {
+			return nil, errors.ERR_INVALID_PARAMETER
+		}
+	}
+
+	mak := &common.MAK{
+		Model:        params.Model,
+		Messages:     params.Messages,
+		MaxTokens:    max(params.MaxTokens, params.MaxCompletionTokens),
+		User:         params.User,
+		SkipAffinity: true,
+		DryRun:       true,
+	}
+
+	if err := mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	messages := params.Messages
+	maxTokens := mak.MaxTokens
+
+	// 预设配置, 与实际请求一致地替换预设提示词和调整MaxTokens取值范围
+	if mak.RealModel.IsEnablePresetConfig {
+
+		if mak.RealModel.PresetConfig.IsSupportSystemRole && mak.RealModel.PresetConfig.SystemRolePrompt != "" {
+			if messages[0].Role == consts.ROLE_SYSTEM {
+				messages = append([]sdkm.ChatCompletionMessage{{
+					Role:    consts.ROLE_SYSTEM,
+					Content: mak.RealModel.PresetConfig.SystemRolePrompt,
+				}}, messages[1:]...)
+			} else {
+				messages = append([]sdkm.ChatCompletionMessage{{
+					Role:    consts.ROLE_SYSTEM,
+					Content: mak.RealModel.PresetConfig.SystemRolePrompt,
+				}}, messages...)
+			}
+		}
+
+		if maxTokens != 0 {
+			if mak.RealModel.PresetConfig.MinTokens != 0 && maxTokens < mak.RealModel.PresetConfig.MinTokens {
+				maxTokens = mak.RealModel.PresetConfig.MinTokens
+			} else if mak.RealModel.PresetConfig.MaxTokens != 0 && maxTokens > mak.RealModel.PresetConfig.MaxTokens {
+				maxTokens = mak.RealModel.PresetConfig.MaxTokens
+			}
+		} else if mak.RealModel.PresetConfig.MaxTokens != 0 {
+			maxTokens = mak.RealModel.PresetConfig.MaxTokens
+		}
+	}
+
+	if maxTokens == 0 {
+		maxTokens = common.GetDefaultMaxTokens()
+	}
+
+	tokenModel := mak.ReqModel.Model
+	if !tiktoken.IsEncodingForModel(tokenModel) {
+		tokenModel = consts.DEFAULT_MODEL
+	}
+
+	var (
+		textTokens   int
+		imageTokens  int
+		audioTokens  int
+		pricingUsage = new(model.PricingUsage)
+	)
+
+	if mak.ReqModel.Type == 100 { // 多模态
+
+		if content, ok := messages[len(messages)-1].Content.([]interface{}); ok {
+			textTokens, imageTokens = common.GetMultimodalTokens(ctx, tokenModel, content, mak.ReqModel)
+			pricingUsage.PromptTokens = textTokens
+			pricingUsage.ImageQuota = imageTokens
+		} else {
+			textTokens = common.GetPromptTokens(ctx, tokenModel, messages)
+			pricingUsage.PromptTokens = textTokens
+		}
+
+		if params.Tools != nil {
+			if tools := gconv.String(params.Tools); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
+				pricingUsage.IsSearch = true
+			}
+		}
+
+	} else if mak.ReqModel.Type == 102 { // 多模态语音
+
+		textTokens, audioTokens = common.GetMultimodalAudioTokens(ctx, tokenModel, messages, mak.ReqModel)
+		pricingUsage.PromptTokens = textTokens + audioTokens
+
+	} else {
+		textTokens = common.GetPromptTokens(ctx, tokenModel, messages)
+		pricingUsage.PromptTokens = textTokens
+	}
+
+	minQuota := service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
+
+	pricingUsage.CompletionTokens = maxTokens
+	maxQuota := service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
+
+	res := s.newEstimateRes(ctx, mak, minQuota, maxQuota)
+	res.PromptTokens = textTokens + imageTokens + audioTokens
+	res.ImageTokens = imageTokens
+	res.MaxTokens = maxTokens
+
+	return res, nil
+}
+
+// 图像费用预估
+func (s *sEstimate) ImageGenerations(ctx context.Context, params sdkm.ImageRequest) (*model.EstimateRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sEstimate ImageGenerations time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	mak := &common.MAK{
+		Model:        params.Model,
+		SkipAffinity: true,
+		DryRun:       true,
+	}
+
+	if err := mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	quota := service.Pricing().Image(ctx, common.GetImageQuota(mak.RealModel, params.Size), max(params.N, 1))
+
+	return s.newEstimateRes(ctx, mak, quota, quota), nil
+}
+
+// 语音合成费用预估
+func (s *sEstimate) AudioSpeech(ctx context.Context, params sdkm.SpeechRequest) (*model.EstimateRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sEstimate AudioSpeech time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	mak := &common.MAK{
+		Model:        gconv.String(params.Model),
+		SkipAffinity: true,
+		DryRun:       true,
+	}
+
+	if err := mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	quota := service.Pricing().Audio(ctx, mak.ReqModel.AudioQuota, &model.PricingUsage{PromptTokens: len(params.Input)})
+
+	res := s.newEstimateRes(ctx, mak, quota, quota)
+	res.PromptTokens = len(params.Input)
+
+	return res, nil
+}
+
+// 语音识别费用预估, 按音频时长计算
+func (s *sEstimate) AudioTranscriptions(ctx context.Context, m string, duration float64) (*model.EstimateRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sEstimate AudioTranscriptions time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	mak := &common.MAK{
+		Model:        m,
+		SkipAffinity: true,
+		DryRun:       true,
+	}
+
+	if err := mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	minute := util.Round(duration/60, 2)
+	quota := service.Pricing().Audio(ctx, mak.ReqModel.AudioQuota, &model.PricingUsage{CompletionTokens: int(math.Ceil(minute * 1000))})
+
+	return s.newEstimateRes(ctx, mak, quota, quota), nil
+}
+
+// 向量费用预估
+func (s *sEstimate) Embeddings(ctx context.Context, params sdkm.EmbeddingRequest) (*model.EstimateRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sEstimate Embeddings time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	mak := &common.MAK{
+		Model:        gconv.String(params.Model),
+		SkipAffinity: true,
+		DryRun:       true,
+	}
+
+	if err := mak.InitMAK(ctx); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	tokenModel := mak.ReqModel.Model
+	if !tiktoken.IsEncodingForModel(tokenModel) {
+		tokenModel = consts.DEFAULT_MODEL
+	}
+
+	promptTokens := 0
+
+	switch input := params.Input.(type) {
+	case string:
+		promptTokens = common.GetCompletionTokens(ctx, tokenModel, input)
+	case []interface{}:
+		for _, value := range input {
+			if text, ok := value.(string); ok {
+				promptTokens += common.GetCompletionTokens(ctx, tokenModel, text)
+			} else {
+				// 令牌数组直接按数组长度计算
+				promptTokens += len(gconv.SliceAny(value))
+			}
+		}
+	}
+
+	quota := service.Pricing().Text(ctx, mak.ReqModel.TextQuota, &model.PricingUsage{PromptTokens: promptTokens})
+
+	res := s.newEstimateRes(ctx, mak, quota, quota)
+	res.PromptTokens = promptTokens
+
+	return res, nil
+}
+
+// 预估结果, 按配置的显示货币换算金额
+func (s *sEstimate) newEstimateRes(ctx context.Context, mak *common.MAK, minQuota, maxQuota int) *model.EstimateRes {
+
+	quotaCurrency := common.GetQuotaCurrency()
+
+	res := &model.EstimateRes{
+		Object:      "estimate",
+		Model:       mak.ReqModel.Model,
+		RealModel:   mak.RealModel.Model,
+		MinQuota:    minQuota,
+		MaxQuota:    maxQuota,
+		Currency:    quotaCurrency.Currency,
+		MinAmount:   util.Round(common.QuotaToAmount(minQuota, quotaCurrency), 6),
+		MaxAmount:   util.Round(common.QuotaToAmount(maxQuota, quotaCurrency), 6),
+		IsSoftLimit: service.Session().GetSoftLimit(ctx) != nil,
+	}
+
+	if mak.ModelAgent != nil {
+		res.ModelAgent = mak.ModelAgent.Name
+	}
+
+	return res
+}
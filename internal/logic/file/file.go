@@ -4,13 +4,22 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"github.com/gogf/gf/v2/os/gctx"
 	"github.com/gogf/gf/v2/os/gfile"
 	"github.com/gogf/gf/v2/os/gtime"
 	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/logic/common"
 	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -60,6 +69,129 @@ func (s *sFile) Files(ctx context.Context, params model.FileFilesReq) ([]byte, e
 	return bytes, nil
 }
 
+// 上传文件, 存储到本地用于批处理
+func (s *sFile) Upload(ctx context.Context, params model.FileFilesReq) (*model.FileRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sFile Upload time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	batchConfig := common.GetBatchConfig()
+
+	if !batchConfig.Open {
+		return nil, errors.ERR_BATCH_NOT_ENABLED
+	}
+
+	if params.Purpose != consts.FILE_PURPOSE_BATCH {
+		return nil, errors.ERR_INVALID_PARAMETER
+	}
+
+	if params.File.Size == 0 || params.File.Size > batchConfig.MaxFileSize {
+		return nil, errors.NewErrorf(400, "invalid_file_size", "File size must be between 1 and %d bytes.", "fastapi_request_error", batchConfig.MaxFileSize)
+	}
+
+	if gfile.ExtName(params.File.Filename) != "jsonl" {
+		return nil, errors.ERR_UNSUPPORTED_FILE_FORMAT
+	}
+
+	fileName, err := params.File.Save(batchConfig.FileDir, true)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	file := &do.File{
+		FileId:    consts.FILE_ID_PREFIX + util.GenerateId(),
+		TraceId:   gctx.CtxId(ctx),
+		UserId:    service.Session().GetUserId(ctx),
+		AppId:     service.Session().GetAppId(ctx),
+		Purpose:   params.Purpose,
+		Filename:  params.File.Filename,
+		Bytes:     params.File.Size,
+		FilePath:  gfile.Join(batchConfig.FileDir, fileName),
+		Status:    consts.FILE_STATUS_PROCESSED,
+		CreatedAt: gtime.TimestampMilli(),
+	}
+
+	if _, err = dao.File.Insert(ctx, file); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return &model.FileRes{
+		Id:        file.FileId,
+		Object:    consts.FILE_OBJECT,
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt / 1000,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}, nil
+}
+
+// 获取文件
+func (s *sFile) Retrieve(ctx context.Context, fileId string) (*model.FileRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sFile Retrieve time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	file, err := s.getFile(ctx, fileId)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return &model.FileRes{
+		Id:        file.FileId,
+		Object:    consts.FILE_OBJECT,
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt / 1000,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}, nil
+}
+
+// 获取文件内容
+func (s *sFile) Content(ctx context.Context, fileId string) ([]byte, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sFile Content time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	file, err := s.getFile(ctx, fileId)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	content, err := os.ReadFile(file.FilePath)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// 获取当前用户的文件记录
+func (s *sFile) getFile(ctx context.Context, fileId string) (*entity.File, error) {
+
+	file, err := dao.File.FindOne(ctx, bson.M{"file_id": fileId, "user_id": service.Session().GetUserId(ctx)})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.ERR_FILE_NOT_FOUND
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
 func uploadFile(ctx context.Context, filename string, targetUrl string) ([]byte, error) {
 
 	// 打开文件
@@ -24,7 +24,6 @@ import (
 	"github.com/iimeta/fastapi/utility/util"
 	"github.com/iimeta/tiktoken-go"
 	"io"
-	"math"
 )
 
 type sGoogle struct{}
@@ -50,6 +49,8 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 		mak    = &common.MAK{
 			Model:              params.Model,
 			Messages:           params.Messages,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
 		}
@@ -60,6 +61,7 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 		imageTokens int
 		audioTokens int
 		totalTokens int
+		isSearch    bool
 	)
 
 	defer func() {
@@ -99,17 +101,13 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 					}
 
 					response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
-
-				} else {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
 				}
 
 				body := make(map[string]interface{})
 				if err := gjson.Unmarshal(request.GetBody(), &body); err == nil {
 					if t, ok := body["tools"]; ok {
 						if tools := gconv.String(t); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
-							totalTokens += mak.ReqModel.MultimodalQuota.SearchQuota
+							isSearch = true
 						}
 					}
 				} else {
@@ -133,7 +131,6 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 				}
 
 				response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
-				totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(response.Usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
 
 			} else if response.Usage == nil || response.Usage.TotalTokens == 0 {
 
@@ -152,34 +149,24 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 		}
 
 		if mak.ReqModel != nil && response.Usage != nil {
-			if mak.ReqModel.Type == 102 {
 
-				if response.Usage.PromptTokensDetails != nil {
-					textTokens = int(math.Ceil(float64(response.Usage.PromptTokensDetails.TextTokens) * mak.ReqModel.MultimodalAudioQuota.TextQuota.PromptRatio))
-					audioTokens = int(math.Ceil(float64(response.Usage.PromptTokensDetails.AudioTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio))
-				} else {
-					audioTokens = int(math.Ceil(float64(response.Usage.PromptTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio))
-				}
+			pricingUsage := common.GetPricingUsage(response.Usage)
 
-				if response.Usage.CompletionTokensDetails != nil {
-					textTokens += int(math.Ceil(float64(response.Usage.CompletionTokensDetails.TextTokens) * mak.ReqModel.MultimodalAudioQuota.TextQuota.CompletionRatio))
-					audioTokens += int(math.Ceil(float64(response.Usage.CompletionTokensDetails.AudioTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					audioTokens += int(math.Ceil(float64(response.Usage.CompletionTokens) * mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				}
+			// 本地计算的多模态用量, 图像按图像额度单独计费
+			if imageTokens != 0 {
+				pricingUsage.PromptTokens = textTokens
+				pricingUsage.ImageQuota = imageTokens
+			}
 
-				totalTokens = textTokens + audioTokens
+			pricingUsage.IsSearch = isSearch
 
-			} else if mak.ReqModel.Type != 100 {
-				if mak.ReqModel.TextQuota.BillingMethod == 1 {
-					totalTokens = int(math.Ceil(float64(response.Usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(response.Usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-				} else {
-					totalTokens = mak.ReqModel.TextQuota.FixedQuota
-				}
-			}
+			totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -280,7 +267,7 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -300,29 +287,14 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Completions(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Completions(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Completions(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -342,6 +314,10 @@ func (s *sGoogle) Completions(ctx context.Context, request *ghttp.Request, fallb
 
 	response = convToChatCompletionResponse(g.RequestFromCtx(ctx).GetCtx(), res, false)
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -358,6 +334,8 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 		mak    = &common.MAK{
 			Model:              params.Model,
 			Messages:           params.Messages,
+			MaxTokens:          max(params.MaxTokens, params.MaxCompletionTokens),
+			User:               params.User,
 			FallbackModelAgent: fallbackModelAgent,
 			FallbackModel:      fallbackModel,
 		}
@@ -370,6 +348,7 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 		imageTokens int
 		audioTokens int
 		totalTokens int
+		isSearch    bool
 		usage       *sdkm.Usage
 		retryInfo   *mcommon.Retry
 	)
@@ -411,68 +390,47 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 						usage.CompletionTokens += 388
 					}
 				}
+			}
 
-				if mak.ReqModel.Type == 100 { // 多模态
+			if retryInfo == nil && usage != nil && mak.ReqModel != nil {
 
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = imageTokens + int(math.Ceil(float64(textTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
+				if mak.ReqModel.Type == 100 { // 多模态
 
 					body := make(map[string]interface{})
 					if err := gjson.Unmarshal(request.GetBody(), &body); err == nil {
 						if t, ok := body["tools"]; ok {
 							if tools := gconv.String(t); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
-								totalTokens += mak.ReqModel.MultimodalQuota.SearchQuota
+								isSearch = true
 							}
 						}
 					} else {
 						logger.Error(ctx, err)
 					}
+				}
 
-				} else if mak.ReqModel.Type == 102 { // 多模态语音
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
+				if mak.ReqModel.Type != 100 && mak.ReqModel.Type != 102 && mak.ReqModel.TextQuota.BillingMethod == 2 {
+					usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
 				} else {
-					if mak.ReqModel.TextQuota.BillingMethod == 1 {
-						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-						totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-					} else {
-						usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
-						totalTokens = mak.ReqModel.TextQuota.FixedQuota
-					}
+					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 				}
 
-			} else if retryInfo == nil && usage != nil && mak.ReqModel != nil {
+				pricingUsage := common.GetPricingUsage(usage)
 
-				if mak.ReqModel.Type == 100 { // 多模态
-
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalQuota.TextQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalQuota.TextQuota.CompletionRatio))
+				// 本地计算的多模态用量, 图像按图像额度单独计费
+				if imageTokens != 0 {
+					pricingUsage.PromptTokens = textTokens
+					pricingUsage.ImageQuota = imageTokens
+				}
 
-					body := make(map[string]interface{})
-					if err := gjson.Unmarshal(request.GetBody(), &body); err == nil {
-						if t, ok := body["tools"]; ok {
-							if tools := gconv.String(t); gstr.Contains(tools, "google_search") || gstr.Contains(tools, "googleSearch") {
-								totalTokens += mak.ReqModel.MultimodalQuota.SearchQuota
-							}
-						}
-					} else {
-						logger.Error(ctx, err)
-					}
+				pricingUsage.IsSearch = isSearch
 
-				} else if mak.ReqModel.Type == 102 { // 多模态语音
-					usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-					totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.PromptRatio)) + int(math.Ceil(float64(usage.CompletionTokens)*mak.ReqModel.MultimodalAudioQuota.AudioQuota.CompletionRatio))
-				} else {
-					if mak.ReqModel.TextQuota.BillingMethod == 1 {
-						usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-						totalTokens = int(math.Ceil(float64(usage.PromptTokens)*mak.ReqModel.TextQuota.PromptRatio + float64(usage.CompletionTokens)*mak.ReqModel.TextQuota.CompletionRatio))
-					} else {
-						usage.TotalTokens = mak.ReqModel.TextQuota.FixedQuota
-						totalTokens = mak.ReqModel.TextQuota.FixedQuota
-					}
-				}
+				totalTokens = service.Pricing().Chat(ctx, mak.ReqModel, pricingUsage)
 			}
 
 			if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+				// 预占额度由记录使用额度随实际花费一并释放
+				service.Common().SettleQuota(ctx)
+
 				if err := grpool.Add(ctx, func(ctx context.Context) {
 					if err := service.Common().RecordUsage(ctx, totalTokens, mak.Key.Key); err != nil {
 						logger.Error(ctx, err)
@@ -565,7 +523,7 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -585,29 +543,14 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 				}
 
 				return err
@@ -664,13 +607,17 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 					return err
 				}
 
+				// 记录成功和延迟
+				service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+				service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, totalTime)
+
 				return nil
 			}
 
 			err = response.Error
 
 			// 记录错误次数和禁用
-			service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+			service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 			isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -686,33 +633,23 @@ func (s *sGoogle) CompletionsStream(ctx context.Context, request *ghttp.Request,
 				}
 			}
 
+			// 已向客户端输出内容时不再重试, 避免重复输出
+			if isRetry && util.IsSSEFlushed(ctx) {
+				return err
+			}
+
 			if isRetry {
 
 				if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-					if mak.RealModel.IsEnableFallback {
-
-						if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-							if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-								retryInfo = &mcommon.Retry{
-									IsRetry:    true,
-									RetryCount: len(retry),
-									ErrMsg:     err.Error(),
-								}
-								return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-							}
-						}
-
-						if mak.RealModel.FallbackConfig.Model != "" {
-							if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-								retryInfo = &mcommon.Retry{
-									IsRetry:    true,
-									RetryCount: len(retry),
-									ErrMsg:     err.Error(),
-								}
-								return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-							}
+					// 按后备链切换模型代理或模型
+					if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+						retryInfo = &mcommon.Retry{
+							IsRetry:    true,
+							RetryCount: len(retry),
+							ErrMsg:     err.Error(),
 						}
+						return s.CompletionsStream(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 					}
 
 					return err
@@ -56,10 +56,13 @@ func (s *sImage) Generations(ctx context.Context, params sdkm.ImageRequest, fall
 		enterTime := g.RequestFromCtx(ctx).EnterTime.TimestampMilli()
 		internalTime := gtime.TimestampMilli() - enterTime - response.TotalTime
 		usage := &sdkm.Usage{
-			TotalTokens: imageQuota.FixedQuota * len(response.Data),
+			TotalTokens: service.Pricing().Image(ctx, imageQuota, len(response.Data)),
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, usage.TotalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -120,7 +123,7 @@ func (s *sImage) Generations(ctx context.Context, params sdkm.ImageRequest, fall
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -140,29 +143,14 @@ func (s *sImage) Generations(ctx context.Context, params sdkm.ImageRequest, fall
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Generations(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Generations(g.RequestFromCtx(ctx).GetCtx(), params, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Generations(g.RequestFromCtx(ctx).GetCtx(), params, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -180,6 +168,10 @@ func (s *sImage) Generations(ctx context.Context, params sdkm.ImageRequest, fall
 		return response, err
 	}
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -253,6 +245,7 @@ func (s *sImage) SaveLog(ctx context.Context, reqModel, realModel *model.Model,
 				BaseUrl: realModel.ModelAgent.BaseUrl,
 				Path:    realModel.ModelAgent.Path,
 				Weight:  realModel.ModelAgent.Weight,
+				Cost:    realModel.ModelAgent.Cost,
 				Remark:  realModel.ModelAgent.Remark,
 				Status:  realModel.ModelAgent.Status,
 			}
@@ -260,6 +253,7 @@ func (s *sImage) SaveLog(ctx context.Context, reqModel, realModel *model.Model,
 	}
 
 	image.TotalTokens = imageRes.Usage.TotalTokens
+	image.QuotaCurrency = common.GetQuotaCurrency()
 
 	if fallbackModelAgent != nil {
 		image.IsEnableFallback = true
@@ -278,6 +272,14 @@ func (s *sImage) SaveLog(ctx context.Context, reqModel, realModel *model.Model,
 		image.FallbackConfig.ModelName = fallbackModel.Name
 	}
 
+	if fallbacks := service.Session().GetFallbacks(ctx); len(fallbacks) > 0 {
+		image.IsEnableFallback = true
+		if image.FallbackConfig == nil {
+			image.FallbackConfig = new(mcommon.FallbackConfig)
+		}
+		image.FallbackConfig.Path = fallbacks
+	}
+
 	if key != nil {
 		image.Key = key.Key
 	}
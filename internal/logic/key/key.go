@@ -11,6 +11,7 @@ import (
 	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/dao"
 	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
 	"github.com/iimeta/fastapi/internal/model"
 	"github.com/iimeta/fastapi/internal/model/entity"
 	"github.com/iimeta/fastapi/internal/service"
@@ -25,6 +26,7 @@ import (
 type sKey struct {
 	modelKeysCache           *cache.Cache // [模型ID][]密钥列表
 	modelKeysRoundRobinCache *cache.Cache // [模型ID]密钥下标索引
+	modelKeysLatencyCache    *cache.Cache // [模型ID]密钥延迟统计
 }
 
 func init() {
@@ -35,6 +37,7 @@ func New() service.IKey {
 	return &sKey{
 		modelKeysRoundRobinCache: cache.New(),
 		modelKeysCache:           cache.New(),
+		modelKeysLatencyCache:    cache.New(),
 	}
 }
 
@@ -60,6 +63,7 @@ func (s *sKey) GetKey(ctx context.Context, secretKey string) (*model.Key, error)
 		Key:                 key.Key,
 		Type:                key.Type,
 		Weight:              key.Weight,
+		MaxConcurrency:      key.MaxConcurrency,
 		Models:              key.Models,
 		ModelAgents:         key.ModelAgents,
 		IsLimitQuota:        key.IsLimitQuota,
@@ -68,6 +72,10 @@ func (s *sKey) GetKey(ctx context.Context, secretKey string) (*model.Key, error)
 		QuotaExpiresRule:    key.QuotaExpiresRule,
 		QuotaExpiresAt:      key.QuotaExpiresAt,
 		QuotaExpiresMinutes: key.QuotaExpiresMinutes,
+		QuotaBudget:         key.QuotaBudget,
+		SoftLimit:           key.SoftLimit,
+		ModelQuota:          key.ModelQuota,
+		RateLimit:           key.RateLimit,
 		IpWhitelist:         key.IpWhitelist,
 		IpBlacklist:         key.IpBlacklist,
 		Status:              key.Status,
@@ -98,6 +106,7 @@ func (s *sKey) GetModelKeys(ctx context.Context, id string) ([]*model.Key, error
 			Key:                 result.Key,
 			Type:                result.Type,
 			Weight:              result.Weight,
+			MaxConcurrency:      result.MaxConcurrency,
 			Models:              result.Models,
 			ModelAgents:         result.ModelAgents,
 			IsLimitQuota:        result.IsLimitQuota,
@@ -106,6 +115,10 @@ func (s *sKey) GetModelKeys(ctx context.Context, id string) ([]*model.Key, error
 			QuotaExpiresRule:    result.QuotaExpiresRule,
 			QuotaExpiresAt:      result.QuotaExpiresAt,
 			QuotaExpiresMinutes: result.QuotaExpiresMinutes,
+			QuotaBudget:         result.QuotaBudget,
+			SoftLimit:           result.SoftLimit,
+			ModelQuota:          result.ModelQuota,
+			RateLimit:           result.RateLimit,
 			IpWhitelist:         result.IpWhitelist,
 			IpBlacklist:         result.IpBlacklist,
 			Status:              result.Status,
@@ -143,6 +156,7 @@ func (s *sKey) List(ctx context.Context, typ int) ([]*model.Key, error) {
 			Key:                 result.Key,
 			Type:                result.Type,
 			Weight:              result.Weight,
+			MaxConcurrency:      result.MaxConcurrency,
 			Models:              result.Models,
 			ModelAgents:         result.ModelAgents,
 			IsLimitQuota:        result.IsLimitQuota,
@@ -151,6 +165,10 @@ func (s *sKey) List(ctx context.Context, typ int) ([]*model.Key, error) {
 			QuotaExpiresRule:    result.QuotaExpiresRule,
 			QuotaExpiresAt:      result.QuotaExpiresAt,
 			QuotaExpiresMinutes: result.QuotaExpiresMinutes,
+			QuotaBudget:         result.QuotaBudget,
+			SoftLimit:           result.SoftLimit,
+			ModelQuota:          result.ModelQuota,
+			RateLimit:           result.RateLimit,
 			IpWhitelist:         result.IpWhitelist,
 			IpBlacklist:         result.IpBlacklist,
 			Status:              result.Status,
@@ -161,7 +179,7 @@ func (s *sKey) List(ctx context.Context, typ int) ([]*model.Key, error) {
 }
 
 // 挑选模型密钥
-func (s *sKey) PickModelKey(ctx context.Context, m *model.Model) (int, *model.Key, error) {
+func (s *sKey) PickModelKey(ctx context.Context, m *model.Model, affinity *model.Affinity, retry ...int) (total int, key *model.Key, err error) {
 
 	now := gtime.TimestampMilli()
 	defer func() {
@@ -171,43 +189,49 @@ func (s *sKey) PickModelKey(ctx context.Context, m *model.Model) (int, *model.Ke
 	var (
 		modelKeys  []*model.Key
 		roundRobin *lb.RoundRobin
-		err        error
+		probeIds   []string
 	)
 
-	if modelKeysValue := s.modelKeysCache.GetVal(ctx, m.Id); modelKeysValue != nil {
-		modelKeys = modelKeysValue.([]*model.Key)
-	}
-
-	if len(modelKeys) == 0 {
-
-		if modelKeys, err = s.GetCacheModelKeys(ctx, m.Id); err != nil {
-
-			if modelKeys, err = s.GetModelKeys(ctx, m.Id); err != nil {
-				logger.Error(ctx, err)
-				return 0, nil, err
-			}
-
-			if err = s.SaveCacheModelKeys(ctx, m.Id, modelKeys); err != nil {
-				logger.Error(ctx, err)
-				return 0, nil, err
+	defer func() {
+		if len(probeIds) > 0 {
+			pickedId := ""
+			if key != nil {
+				pickedId = key.Id
 			}
+			common.ReleaseProbes(ctx, consts.BREAKER_TYPE_MODEL_KEY, probeIds, pickedId)
 		}
+	}()
 
-		if len(modelKeys) == 0 {
-			return 0, nil, errors.ERR_NO_AVAILABLE_KEY
+	defer func() {
+		// 占用密钥并发数, 被其他请求抢先占满时重新挑选, 超过最大次数时返回排队已满
+		if key != nil && !service.Concurrency().Acquire(ctx, consts.CONCURRENCY_TYPE_KEY, key.Id, key.MaxConcurrency) {
+			if len(retry) >= consts.CONCURRENCY_ACQUIRE_MAX_RETRY {
+				total, key, err = 0, nil, errors.ERR_CONCURRENCY_QUEUE_FULL
+				return
+			}
+			total, key, err = s.PickModelKey(ctx, m, affinity, append(retry, 1)...)
 		}
+	}()
 
-		if err = s.modelKeysCache.Set(ctx, m.Id, modelKeys, 0); err != nil {
-			logger.Error(ctx, err)
-			return 0, nil, err
-		}
+	if modelKeys, err = s.getModelKeys(ctx, m); err != nil {
+		return 0, nil, err
 	}
 
 	keyList := make([]*model.Key, 0)
 	for _, key := range modelKeys {
 		// 过滤被禁用的模型密钥
 		if key.Status == 1 {
-			keyList = append(keyList, key)
+			// 过滤限流冷却中的模型密钥
+			if service.Cooldown().IsCooldown(ctx, key.Id) {
+				continue
+			}
+			// 过滤已熔断的模型密钥
+			if isAllow, isProbe := service.Breaker().Allow(ctx, consts.BREAKER_TYPE_MODEL_KEY, key.Id); isAllow {
+				keyList = append(keyList, key)
+				if isProbe {
+					probeIds = append(probeIds, key.Id)
+				}
+			}
 		}
 	}
 
@@ -236,11 +260,50 @@ func (s *sKey) PickModelKey(ctx context.Context, m *model.Model) (int, *model.Ke
 		return 0, nil, errors.ERR_ALL_KEY
 	}
 
+	// 过滤并发已满的密钥, 均已满时排队等待
+	if concurrencyKeyList := common.FilterConcurrencyKeys(ctx, filterKeyList); len(concurrencyKeyList) > 0 {
+		filterKeyList = concurrencyKeyList
+	} else {
+		if err = service.Concurrency().Wait(ctx, m.Id, func() bool {
+			concurrencyKeyList = common.FilterConcurrencyKeys(ctx, filterKeyList)
+			return len(concurrencyKeyList) > 0
+		}); err != nil {
+			logger.Error(ctx, err)
+			return 0, nil, err
+		}
+		filterKeyList = concurrencyKeyList
+	}
+
+	// 亲和路由, 优先使用已绑定且可用的模型密钥
+	if affinity != nil {
+
+		affinityKey := fmt.Sprintf(consts.AFFINITY_MODEL_KEY, m.Id, affinity.Key)
+
+		defer func() {
+			if key != nil {
+				common.BindAffinity(ctx, affinityKey, key.Id, affinity.Ttl)
+			}
+		}()
+
+		if id := common.GetAffinity(ctx, affinityKey); id != "" {
+			for _, key := range filterKeyList {
+				if key.Id == id {
+					return len(filterKeyList), key, nil
+				}
+			}
+		}
+	}
+
 	// 负载策略-权重
 	if m.LbStrategy == 2 {
 		return len(filterKeyList), lb.NewKeyWeight(filterKeyList).PickKey(), nil
 	}
 
+	// 负载策略-最快响应
+	if m.LbStrategy == 3 {
+		return len(filterKeyList), common.GetLatency(ctx, s.modelKeysLatencyCache, m.Id).PickKey(filterKeyList), nil
+	}
+
 	if roundRobinValue := s.modelKeysRoundRobinCache.GetVal(ctx, m.Id); roundRobinValue != nil {
 		roundRobin = roundRobinValue.(*lb.RoundRobin)
 	}
@@ -253,7 +316,89 @@ func (s *sKey) PickModelKey(ctx context.Context, m *model.Model) (int, *model.Ke
 		}
 	}
 
-	return len(keyList), keyList[roundRobin.Index(len(keyList))], nil
+	return len(filterKeyList), filterKeyList[roundRobin.Index(len(filterKeyList))], nil
+}
+
+// 只读挑选模型密钥, 不占用并发数、不排队等待、不发起熔断探测, 跳过排除的密钥
+func (s *sKey) PeekModelKey(ctx context.Context, m *model.Model, excludeIds ...string) (total int, key *model.Key, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sKey PeekModelKey time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	modelKeys, err := s.getModelKeys(ctx, m)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errorKeys := service.Session().GetErrorKeys(ctx)
+
+	keyList := make([]*model.Key, 0)
+	for _, key := range modelKeys {
+		// 过滤被禁用、冷却中、已熔断、错误和排除的模型密钥
+		if key.Status == 1 && !service.Cooldown().IsCooldown(ctx, key.Id) && service.Breaker().GetState(ctx, consts.BREAKER_TYPE_MODEL_KEY, key.Id) != consts.BREAKER_STATE_OPEN &&
+			!slices.Contains(errorKeys, key.Id) && !slices.Contains(excludeIds, key.Id) {
+			keyList = append(keyList, key)
+		}
+	}
+
+	// 只读挑选不排队, 并发已满的密钥直接跳过
+	if keyList = common.FilterConcurrencyKeys(ctx, keyList); len(keyList) == 0 {
+		return 0, nil, errors.ERR_ALL_KEY
+	}
+
+	// 负载策略-权重
+	if m.LbStrategy == 2 {
+		return len(keyList), lb.NewKeyWeight(keyList).PickKey(), nil
+	}
+
+	// 负载策略-最快响应
+	if m.LbStrategy == 3 {
+		return len(keyList), common.GetLatency(ctx, s.modelKeysLatencyCache, m.Id).PickKey(keyList), nil
+	}
+
+	// 轮询只查看当前下标, 不推进
+	if roundRobinValue := s.modelKeysRoundRobinCache.GetVal(ctx, m.Id); roundRobinValue != nil {
+		return len(keyList), keyList[roundRobinValue.(*lb.RoundRobin).Current(len(keyList))], nil
+	}
+
+	return len(keyList), keyList[0], nil
+}
+
+// 获取模型的密钥列表
+func (s *sKey) getModelKeys(ctx context.Context, m *model.Model) (modelKeys []*model.Key, err error) {
+
+	if modelKeysValue := s.modelKeysCache.GetVal(ctx, m.Id); modelKeysValue != nil {
+		modelKeys = modelKeysValue.([]*model.Key)
+	}
+
+	if len(modelKeys) == 0 {
+
+		if modelKeys, err = s.GetCacheModelKeys(ctx, m.Id); err != nil {
+
+			if modelKeys, err = s.GetModelKeys(ctx, m.Id); err != nil {
+				logger.Error(ctx, err)
+				return nil, err
+			}
+
+			if err = s.SaveCacheModelKeys(ctx, m.Id, modelKeys); err != nil {
+				logger.Error(ctx, err)
+				return nil, err
+			}
+		}
+
+		if len(modelKeys) == 0 {
+			return nil, errors.ERR_NO_AVAILABLE_KEY
+		}
+
+		if err = s.modelKeysCache.Set(ctx, m.Id, modelKeys, 0); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+	}
+
+	return modelKeys, nil
 }
 
 // 移除模型密钥
@@ -304,11 +449,29 @@ func (s *sKey) RecordErrorModelKey(ctx context.Context, m *model.Model, key *mod
 		logger.Error(ctx, err)
 	}
 
-	if reply >= config.Cfg.Base.ModelKeyErrDisable {
+	common.GetLatency(ctx, s.modelKeysLatencyCache, m.Id).RecordError(key.Id)
+
+	service.Breaker().RecordFailure(ctx, consts.BREAKER_TYPE_MODEL_KEY, key.Id)
+
+	// 开启熔断器后由熔断器接管, 不再达到错误次数后禁用
+	if !service.Breaker().IsOpen() && reply >= config.Cfg.Base.ModelKeyErrDisable {
 		s.DisabledModelKey(ctx, key, "Reached the maximum number of errors")
 	}
 }
 
+// 记录模型密钥延迟
+func (s *sKey) RecordLatencyModelKey(ctx context.Context, m *model.Model, key *model.Key, latency int64) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sKey RecordLatencyModelKey time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if latency > 0 {
+		common.GetLatency(ctx, s.modelKeysLatencyCache, m.Id).Record(key.Id, latency)
+	}
+}
+
 // 禁用模型密钥
 func (s *sKey) DisabledModelKey(ctx context.Context, key *model.Key, disabledReason string) {
 
@@ -325,6 +488,7 @@ func (s *sKey) DisabledModelKey(ctx context.Context, key *model.Key, disabledRea
 		Key:                 key.Key,
 		Type:                key.Type,
 		Weight:              key.Weight,
+		MaxConcurrency:      key.MaxConcurrency,
 		Models:              key.Models,
 		ModelAgents:         key.ModelAgents,
 		IsLimitQuota:        key.IsLimitQuota,
@@ -333,6 +497,10 @@ func (s *sKey) DisabledModelKey(ctx context.Context, key *model.Key, disabledRea
 		QuotaExpiresRule:    key.QuotaExpiresRule,
 		QuotaExpiresAt:      key.QuotaExpiresAt,
 		QuotaExpiresMinutes: key.QuotaExpiresMinutes,
+		QuotaBudget:         key.QuotaBudget,
+		SoftLimit:           key.SoftLimit,
+		ModelQuota:          key.ModelQuota,
+		RateLimit:           key.RateLimit,
 		IpWhitelist:         key.IpWhitelist,
 		IpBlacklist:         key.IpBlacklist,
 		Status:              2,
@@ -347,6 +515,11 @@ func (s *sKey) DisabledModelKey(ctx context.Context, key *model.Key, disabledRea
 	}); err != nil {
 		logger.Error(ctx, err)
 	}
+
+	// 重新计数健康探测次数
+	if _, err := redis.HDel(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, key.Id); err != nil {
+		logger.Error(ctx, err)
+	}
 }
 
 // 保存模型密钥列表到缓存
@@ -450,6 +623,7 @@ func (s *sKey) CreateCacheModelKey(ctx context.Context, key *entity.Key) {
 		Key:                 key.Key,
 		Type:                key.Type,
 		Weight:              key.Weight,
+		MaxConcurrency:      key.MaxConcurrency,
 		Models:              key.Models,
 		ModelAgents:         key.ModelAgents,
 		IsLimitQuota:        key.IsLimitQuota,
@@ -458,6 +632,10 @@ func (s *sKey) CreateCacheModelKey(ctx context.Context, key *entity.Key) {
 		QuotaExpiresRule:    key.QuotaExpiresRule,
 		QuotaExpiresAt:      key.QuotaExpiresAt,
 		QuotaExpiresMinutes: key.QuotaExpiresMinutes,
+		QuotaBudget:         key.QuotaBudget,
+		SoftLimit:           key.SoftLimit,
+		ModelQuota:          key.ModelQuota,
+		RateLimit:           key.RateLimit,
 		IpWhitelist:         key.IpWhitelist,
 		IpBlacklist:         key.IpBlacklist,
 		Status:              key.Status,
@@ -493,6 +671,7 @@ func (s *sKey) UpdateCacheModelKey(ctx context.Context, oldData *entity.Key, new
 		Key:                 newData.Key,
 		Type:                newData.Type,
 		Weight:              newData.Weight,
+		MaxConcurrency:      newData.MaxConcurrency,
 		Models:              newData.Models,
 		ModelAgents:         newData.ModelAgents,
 		IsLimitQuota:        newData.IsLimitQuota,
@@ -501,6 +680,10 @@ func (s *sKey) UpdateCacheModelKey(ctx context.Context, oldData *entity.Key, new
 		QuotaExpiresRule:    newData.QuotaExpiresRule,
 		QuotaExpiresAt:      newData.QuotaExpiresAt,
 		QuotaExpiresMinutes: newData.QuotaExpiresMinutes,
+		QuotaBudget:         newData.QuotaBudget,
+		SoftLimit:           newData.SoftLimit,
+		ModelQuota:          newData.ModelQuota,
+		RateLimit:           newData.RateLimit,
 		IpWhitelist:         newData.IpWhitelist,
 		IpBlacklist:         newData.IpBlacklist,
 		Status:              newData.Status,
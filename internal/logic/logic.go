@@ -9,12 +9,18 @@ import (
 	_ "github.com/iimeta/fastapi/internal/logic/app"
 	_ "github.com/iimeta/fastapi/internal/logic/audio"
 	_ "github.com/iimeta/fastapi/internal/logic/auth"
+	_ "github.com/iimeta/fastapi/internal/logic/batch"
+	_ "github.com/iimeta/fastapi/internal/logic/breaker"
 	_ "github.com/iimeta/fastapi/internal/logic/chat"
 	_ "github.com/iimeta/fastapi/internal/logic/common"
+	_ "github.com/iimeta/fastapi/internal/logic/completion"
+	_ "github.com/iimeta/fastapi/internal/logic/concurrency"
+	_ "github.com/iimeta/fastapi/internal/logic/cooldown"
 	_ "github.com/iimeta/fastapi/internal/logic/core"
 	_ "github.com/iimeta/fastapi/internal/logic/corp"
 	_ "github.com/iimeta/fastapi/internal/logic/dashboard"
 	_ "github.com/iimeta/fastapi/internal/logic/embedding"
+	_ "github.com/iimeta/fastapi/internal/logic/estimate"
 	_ "github.com/iimeta/fastapi/internal/logic/file"
 	_ "github.com/iimeta/fastapi/internal/logic/google"
 	_ "github.com/iimeta/fastapi/internal/logic/image"
@@ -23,7 +29,11 @@ import (
 	_ "github.com/iimeta/fastapi/internal/logic/model"
 	_ "github.com/iimeta/fastapi/internal/logic/model_agent"
 	_ "github.com/iimeta/fastapi/internal/logic/moderation"
+	_ "github.com/iimeta/fastapi/internal/logic/notice"
+	_ "github.com/iimeta/fastapi/internal/logic/pricing"
+	_ "github.com/iimeta/fastapi/internal/logic/rate_limit"
 	_ "github.com/iimeta/fastapi/internal/logic/realtime"
+	_ "github.com/iimeta/fastapi/internal/logic/responses"
 	_ "github.com/iimeta/fastapi/internal/logic/session"
 	_ "github.com/iimeta/fastapi/internal/logic/sys_config"
 	_ "github.com/iimeta/fastapi/internal/logic/user"
@@ -71,10 +71,13 @@ func (s *sMidjourney) Submit(ctx context.Context, request *ghttp.Request, fallba
 		enterTime := g.RequestFromCtx(ctx).EnterTime.TimestampMilli()
 		internalTime := gtime.TimestampMilli() - enterTime - response.TotalTime
 		usage := &sdkm.Usage{
-			TotalTokens: midjourneyQuota.FixedQuota,
+			TotalTokens: service.Pricing().Midjourney(ctx, midjourneyQuota),
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, usage.TotalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -130,7 +133,7 @@ func (s *sMidjourney) Submit(ctx context.Context, request *ghttp.Request, fallba
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -150,29 +153,14 @@ func (s *sMidjourney) Submit(ctx context.Context, request *ghttp.Request, fallba
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Submit(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Submit(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Submit(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -198,6 +186,10 @@ func (s *sMidjourney) Submit(ctx context.Context, request *ghttp.Request, fallba
 
 	taskId = data["result"].(string)
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -235,10 +227,13 @@ func (s *sMidjourney) Task(ctx context.Context, request *ghttp.Request, fallback
 		enterTime := g.RequestFromCtx(ctx).EnterTime.TimestampMilli()
 		internalTime := gtime.TimestampMilli() - enterTime - response.TotalTime
 		usage := &sdkm.Usage{
-			TotalTokens: midjourneyQuota.FixedQuota,
+			TotalTokens: service.Pricing().Midjourney(ctx, midjourneyQuota),
 		}
 
 		if retryInfo == nil && (err == nil || common.IsAborted(err)) && mak.ReqModel != nil {
+			// 预占额度由记录使用额度随实际花费一并释放
+			service.Common().SettleQuota(ctx)
+
 			if err := grpool.Add(gctx.NeverDone(ctx), func(ctx context.Context) {
 				if err := service.Common().RecordUsage(ctx, usage.TotalTokens, mak.Key.Key); err != nil {
 					logger.Error(ctx, err)
@@ -293,7 +288,7 @@ func (s *sMidjourney) Task(ctx context.Context, request *ghttp.Request, fallback
 		logger.Error(ctx, err)
 
 		// 记录错误次数和禁用
-		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+		service.Common().RecordError(ctx, mak.RealModel, mak.Key, mak.ModelAgent, err)
 
 		isRetry, isDisabled := common.IsNeedRetry(err)
 
@@ -313,29 +308,14 @@ func (s *sMidjourney) Task(ctx context.Context, request *ghttp.Request, fallback
 
 			if common.IsMaxRetry(mak.RealModel.IsEnableModelAgent, mak.AgentTotal, mak.KeyTotal, len(retry)) {
 
-				if mak.RealModel.IsEnableFallback {
-
-					if mak.RealModel.FallbackConfig.ModelAgent != "" && mak.RealModel.FallbackConfig.ModelAgent != mak.ModelAgent.Id {
-						if fallbackModelAgent, _ = service.ModelAgent().GetFallbackModelAgent(ctx, mak.RealModel); fallbackModelAgent != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Task(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
-						}
-					}
-
-					if mak.RealModel.FallbackConfig.Model != "" {
-						if fallbackModel, _ = service.Model().GetFallbackModel(ctx, mak.RealModel); fallbackModel != nil {
-							retryInfo = &mcommon.Retry{
-								IsRetry:    true,
-								RetryCount: len(retry),
-								ErrMsg:     err.Error(),
-							}
-							return s.Task(g.RequestFromCtx(ctx).GetCtx(), request, nil, fallbackModel)
-						}
+				// 按后备链切换模型代理或模型
+				if fallbackModelAgent, fallbackModel, isFallback := common.NextFallback(ctx, mak, err); isFallback {
+					retryInfo = &mcommon.Retry{
+						IsRetry:    true,
+						RetryCount: len(retry),
+						ErrMsg:     err.Error(),
 					}
+					return s.Task(g.RequestFromCtx(ctx).GetCtx(), request, fallbackModelAgent, fallbackModel)
 				}
 
 				return response, err
@@ -373,6 +353,10 @@ func (s *sMidjourney) Task(ctx context.Context, request *ghttp.Request, fallback
 		}
 	}
 
+	// 记录成功和延迟
+	service.Common().RecordSuccess(ctx, mak.RealModel, mak.Key, mak.ModelAgent)
+	service.Common().RecordLatency(ctx, mak.RealModel, mak.Key, mak.ModelAgent, response.TotalTime)
+
 	return response, nil
 }
 
@@ -441,6 +425,7 @@ func (s *sMidjourney) SaveLog(ctx context.Context, reqModel, realModel *model.Mo
 				BaseUrl: realModel.ModelAgent.BaseUrl,
 				Path:    realModel.ModelAgent.Path,
 				Weight:  realModel.ModelAgent.Weight,
+				Cost:    realModel.ModelAgent.Cost,
 				Remark:  realModel.ModelAgent.Remark,
 				Status:  realModel.ModelAgent.Status,
 			}
@@ -448,6 +433,7 @@ func (s *sMidjourney) SaveLog(ctx context.Context, reqModel, realModel *model.Mo
 	}
 
 	midjourney.TotalTokens = response.Usage.TotalTokens
+	midjourney.QuotaCurrency = common.GetQuotaCurrency()
 
 	if fallbackModelAgent != nil {
 		midjourney.IsEnableFallback = true
@@ -466,6 +452,14 @@ func (s *sMidjourney) SaveLog(ctx context.Context, reqModel, realModel *model.Mo
 		midjourney.FallbackConfig.ModelName = fallbackModel.Name
 	}
 
+	if fallbacks := service.Session().GetFallbacks(ctx); len(fallbacks) > 0 {
+		midjourney.IsEnableFallback = true
+		if midjourney.FallbackConfig == nil {
+			midjourney.FallbackConfig = new(mcommon.FallbackConfig)
+		}
+		midjourney.FallbackConfig.Path = fallbacks
+	}
+
 	if key != nil {
 		midjourney.Key = key.Key
 	}
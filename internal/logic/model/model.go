@@ -78,6 +78,12 @@ func (s *sModel) GetModel(ctx context.Context, m string) (*model.Model, error) {
 		ForwardConfig:        result.ForwardConfig,
 		IsEnableFallback:     result.IsEnableFallback,
 		FallbackConfig:       result.FallbackConfig,
+		IsEnableHedge:        result.IsEnableHedge,
+		HedgeConfig:          result.HedgeConfig,
+		IsEnableAffinity:     result.IsEnableAffinity,
+		AffinityConfig:       result.AffinityConfig,
+		IsEnableStreamResume: result.IsEnableStreamResume,
+		IsSupportCompletions: result.IsSupportCompletions,
 		Remark:               result.Remark,
 		Status:               result.Status,
 	}, nil
@@ -123,6 +129,12 @@ func (s *sModel) GetModelById(ctx context.Context, id string) (*model.Model, err
 		ForwardConfig:        result.ForwardConfig,
 		IsEnableFallback:     result.IsEnableFallback,
 		FallbackConfig:       result.FallbackConfig,
+		IsEnableHedge:        result.IsEnableHedge,
+		HedgeConfig:          result.HedgeConfig,
+		IsEnableAffinity:     result.IsEnableAffinity,
+		AffinityConfig:       result.AffinityConfig,
+		IsEnableStreamResume: result.IsEnableStreamResume,
+		IsSupportCompletions: result.IsSupportCompletions,
 		Remark:               result.Remark,
 		Status:               result.Status,
 	}, nil
@@ -534,6 +546,12 @@ func (s *sModel) List(ctx context.Context, ids []string) ([]*model.Model, error)
 			ForwardConfig:        result.ForwardConfig,
 			IsEnableFallback:     result.IsEnableFallback,
 			FallbackConfig:       result.FallbackConfig,
+			IsEnableHedge:        result.IsEnableHedge,
+			HedgeConfig:          result.HedgeConfig,
+			IsEnableAffinity:     result.IsEnableAffinity,
+			AffinityConfig:       result.AffinityConfig,
+			IsEnableStreamResume: result.IsEnableStreamResume,
+			IsSupportCompletions: result.IsSupportCompletions,
 			Remark:               result.Remark,
 			Status:               result.Status,
 			CreatedAt:            result.CreatedAt,
@@ -587,6 +605,12 @@ func (s *sModel) ListAll(ctx context.Context) ([]*model.Model, error) {
 			ForwardConfig:        result.ForwardConfig,
 			IsEnableFallback:     result.IsEnableFallback,
 			FallbackConfig:       result.FallbackConfig,
+			IsEnableHedge:        result.IsEnableHedge,
+			HedgeConfig:          result.HedgeConfig,
+			IsEnableAffinity:     result.IsEnableAffinity,
+			AffinityConfig:       result.AffinityConfig,
+			IsEnableStreamResume: result.IsEnableStreamResume,
+			IsSupportCompletions: result.IsSupportCompletions,
 			Remark:               result.Remark,
 			Status:               result.Status,
 			CreatedAt:            result.CreatedAt,
@@ -800,6 +824,12 @@ func (s *sModel) UpdateCacheModel(ctx context.Context, oldData *entity.Model, ne
 		ForwardConfig:        newData.ForwardConfig,
 		IsEnableFallback:     newData.IsEnableFallback,
 		FallbackConfig:       newData.FallbackConfig,
+		IsEnableHedge:        newData.IsEnableHedge,
+		HedgeConfig:          newData.HedgeConfig,
+		IsEnableAffinity:     newData.IsEnableAffinity,
+		AffinityConfig:       newData.AffinityConfig,
+		IsEnableStreamResume: newData.IsEnableStreamResume,
+		IsSupportCompletions: newData.IsSupportCompletions,
 		Status:               newData.Status,
 	}); err != nil {
 		logger.Error(ctx, err)
@@ -964,15 +994,15 @@ func (s *sModel) GetTargetModel(ctx context.Context, model *model.Model, message
 }
 
 // 获取后备模型
-func (s *sModel) GetFallbackModel(ctx context.Context, model *model.Model) (fallbackModel *model.Model, err error) {
+func (s *sModel) GetFallbackModel(ctx context.Context, id string) (fallbackModel *model.Model, err error) {
 
 	now := gtime.TimestampMilli()
 	defer func() {
 		logger.Debugf(ctx, "sModel GetFallbackModel time: %d", gtime.TimestampMilli()-now)
 	}()
 
-	if fallbackModel, err = s.GetCacheModel(ctx, model.FallbackConfig.Model); err != nil || fallbackModel == nil {
-		if fallbackModel, err = s.GetModelAndSaveCache(ctx, model.FallbackConfig.Model); err != nil {
+	if fallbackModel, err = s.GetCacheModel(ctx, id); err != nil || fallbackModel == nil {
+		if fallbackModel, err = s.GetModelAndSaveCache(ctx, id); err != nil {
 			logger.Error(ctx, err)
 			return nil, err
 		}
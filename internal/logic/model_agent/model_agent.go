@@ -11,6 +11,7 @@ import (
 	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/dao"
 	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/logic/common"
 	"github.com/iimeta/fastapi/internal/model"
 	"github.com/iimeta/fastapi/internal/model/entity"
 	"github.com/iimeta/fastapi/internal/service"
@@ -28,6 +29,8 @@ type sModelAgent struct {
 	modelAgentsRoundRobinCache    *cache.Cache // [模型ID]模型代理下标索引
 	modelAgentKeysCache           *cache.Cache // [模型代理ID][]模型代理密钥列表
 	modelAgentKeysRoundRobinCache *cache.Cache // [模型代理ID]模型代理密钥下标索引
+	modelAgentsLatencyCache       *cache.Cache // [模型ID]模型代理延迟统计
+	modelAgentKeysLatencyCache    *cache.Cache // [模型代理ID]模型代理密钥延迟统计
 }
 
 func init() {
@@ -41,6 +44,8 @@ func New() service.IModelAgent {
 		modelAgentKeysRoundRobinCache: cache.New(),
 		modelAgentCache:               cache.New(),
 		modelAgentKeysCache:           cache.New(),
+		modelAgentsLatencyCache:       cache.New(),
+		modelAgentKeysLatencyCache:    cache.New(),
 	}
 }
 
@@ -59,14 +64,16 @@ func (s *sModelAgent) GetModelAgentById(ctx context.Context, id string) (*model.
 	}
 
 	return &model.ModelAgent{
-		Id:         modelAgent.Id,
-		Corp:       modelAgent.Corp,
-		Name:       modelAgent.Name,
-		BaseUrl:    modelAgent.BaseUrl,
-		Path:       modelAgent.Path,
-		Weight:     modelAgent.Weight,
-		LbStrategy: modelAgent.LbStrategy,
-		Status:     modelAgent.Status,
+		Id:             modelAgent.Id,
+		Corp:           modelAgent.Corp,
+		Name:           modelAgent.Name,
+		BaseUrl:        modelAgent.BaseUrl,
+		Path:           modelAgent.Path,
+		Weight:         modelAgent.Weight,
+		LbStrategy:     modelAgent.LbStrategy,
+		Cost:           modelAgent.Cost,
+		MaxConcurrency: modelAgent.MaxConcurrency,
+		Status:         modelAgent.Status,
 	}, nil
 }
 
@@ -109,16 +116,18 @@ func (s *sModelAgent) List(ctx context.Context, ids []string) ([]*model.ModelAge
 	items := make([]*model.ModelAgent, 0)
 	for _, result := range results {
 		items = append(items, &model.ModelAgent{
-			Id:         result.Id,
-			Corp:       result.Corp,
-			Name:       result.Name,
-			BaseUrl:    result.BaseUrl,
-			Path:       result.Path,
-			Weight:     result.Weight,
-			LbStrategy: result.LbStrategy,
-			Models:     modelMap[result.Id],
-			ModelNames: modelNameMap[result.Id],
-			Status:     result.Status,
+			Id:             result.Id,
+			Corp:           result.Corp,
+			Name:           result.Name,
+			BaseUrl:        result.BaseUrl,
+			Path:           result.Path,
+			Weight:         result.Weight,
+			LbStrategy:     result.LbStrategy,
+			Cost:           result.Cost,
+			MaxConcurrency: result.MaxConcurrency,
+			Models:         modelMap[result.Id],
+			ModelNames:     modelNameMap[result.Id],
+			Status:         result.Status,
 		})
 	}
 
@@ -160,16 +169,18 @@ func (s *sModelAgent) ListAll(ctx context.Context) ([]*model.ModelAgent, error)
 	items := make([]*model.ModelAgent, 0)
 	for _, result := range results {
 		items = append(items, &model.ModelAgent{
-			Id:         result.Id,
-			Corp:       result.Corp,
-			Name:       result.Name,
-			BaseUrl:    result.BaseUrl,
-			Path:       result.Path,
-			Weight:     result.Weight,
-			LbStrategy: result.LbStrategy,
-			Models:     modelMap[result.Id],
-			ModelNames: modelNameMap[result.Id],
-			Status:     result.Status,
+			Id:             result.Id,
+			Corp:           result.Corp,
+			Name:           result.Name,
+			BaseUrl:        result.BaseUrl,
+			Path:           result.Path,
+			Weight:         result.Weight,
+			LbStrategy:     result.LbStrategy,
+			Cost:           result.Cost,
+			MaxConcurrency: result.MaxConcurrency,
+			Models:         modelMap[result.Id],
+			ModelNames:     modelNameMap[result.Id],
+			Status:         result.Status,
 		})
 	}
 
@@ -200,12 +211,14 @@ func (s *sModelAgent) GetModelAgentKeys(ctx context.Context, id string) ([]*mode
 			Key:            result.Key,
 			Type:           result.Type,
 			Weight:         result.Weight,
+			MaxConcurrency: result.MaxConcurrency,
 			Models:         result.Models,
 			ModelAgents:    result.ModelAgents,
 			IsLimitQuota:   result.IsLimitQuota,
 			Quota:          result.Quota,
 			UsedQuota:      result.UsedQuota,
 			QuotaExpiresAt: result.QuotaExpiresAt,
+			RateLimit:      result.RateLimit,
 			IpWhitelist:    result.IpWhitelist,
 			IpBlacklist:    result.IpBlacklist,
 			Status:         result.Status,
@@ -216,7 +229,7 @@ func (s *sModelAgent) GetModelAgentKeys(ctx context.Context, id string) ([]*mode
 }
 
 // 挑选模型代理
-func (s *sModelAgent) PickModelAgent(ctx context.Context, m *model.Model) (int, *model.ModelAgent, error) {
+func (s *sModelAgent) PickModelAgent(ctx context.Context, m *model.Model, affinity *model.Affinity, retry ...int) (total int, modelAgent *model.ModelAgent, err error) {
 
 	now := gtime.TimestampMilli()
 	defer func() {
@@ -226,44 +239,45 @@ func (s *sModelAgent) PickModelAgent(ctx context.Context, m *model.Model) (int,
 	var (
 		modelAgents []*model.ModelAgent
 		roundRobin  *lb.RoundRobin
-		err         error
+		probeIds    []string
 	)
 
-	if modelAgentsValue := s.modelAgentsCache.GetVal(ctx, m.Id); modelAgentsValue != nil {
-		modelAgents = modelAgentsValue.([]*model.ModelAgent)
-	}
-
-	if len(modelAgents) == 0 {
-
-		modelAgents, err = s.GetCacheList(ctx, m.ModelAgents...)
-		if err != nil || len(modelAgents) != len(m.ModelAgents) {
-
-			if modelAgents, err = s.List(ctx, m.ModelAgents); err != nil {
-				logger.Error(ctx, err)
-				return 0, nil, err
-			}
-
-			if err = s.SaveCacheList(ctx, modelAgents); err != nil {
-				logger.Error(ctx, err)
-				return 0, nil, err
+	defer func() {
+		if len(probeIds) > 0 {
+			pickedId := ""
+			if modelAgent != nil {
+				pickedId = modelAgent.Id
 			}
+			common.ReleaseProbes(ctx, consts.BREAKER_TYPE_MODEL_AGENT, probeIds, pickedId)
 		}
+	}()
 
-		if len(modelAgents) == 0 {
-			return 0, nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT
+	defer func() {
+		// 占用模型代理并发数, 被其他请求抢先占满时重新挑选, 超过最大次数时返回排队已满
+		if modelAgent != nil && !service.Concurrency().Acquire(ctx, consts.CONCURRENCY_TYPE_MODEL_AGENT, modelAgent.Id, modelAgent.MaxConcurrency) {
+			if len(retry) >= consts.CONCURRENCY_ACQUIRE_MAX_RETRY {
+				total, modelAgent, err = 0, nil, errors.ERR_CONCURRENCY_QUEUE_FULL
+				return
+			}
+			total, modelAgent, err = s.PickModelAgent(ctx, m, affinity, append(retry, 1)...)
 		}
+	}()
 
-		if err = s.modelAgentsCache.Set(ctx, m.Id, modelAgents, 0); err != nil {
-			logger.Error(ctx, err)
-			return 0, nil, err
-		}
+	if modelAgents, err = s.getModelAgents(ctx, m); err != nil {
+		return 0, nil, err
 	}
 
 	modelAgentList := make([]*model.ModelAgent, 0)
 	for _, modelAgent := range modelAgents {
 		// 过滤被禁用的模型代理
 		if modelAgent.Status == 1 {
-			modelAgentList = append(modelAgentList, modelAgent)
+			// 过滤已熔断的模型代理
+			if isAllow, isProbe := service.Breaker().Allow(ctx, consts.BREAKER_TYPE_MODEL_AGENT, modelAgent.Id); isAllow {
+				modelAgentList = append(modelAgentList, modelAgent)
+				if isProbe {
+					probeIds = append(probeIds, modelAgent.Id)
+				}
+			}
 		}
 	}
 
@@ -292,11 +306,55 @@ func (s *sModelAgent) PickModelAgent(ctx context.Context, m *model.Model) (int,
 		return 0, nil, errors.ERR_ALL_MODEL_AGENT
 	}
 
+	// 过滤并发已满的模型代理, 均已满时排队等待
+	if concurrencyModelAgentList := common.FilterConcurrencyModelAgents(ctx, filterModelAgentList); len(concurrencyModelAgentList) > 0 {
+		filterModelAgentList = concurrencyModelAgentList
+	} else {
+		if err = service.Concurrency().Wait(ctx, m.Id, func() bool {
+			concurrencyModelAgentList = common.FilterConcurrencyModelAgents(ctx, filterModelAgentList)
+			return len(concurrencyModelAgentList) > 0
+		}); err != nil {
+			logger.Error(ctx, err)
+			return 0, nil, err
+		}
+		filterModelAgentList = concurrencyModelAgentList
+	}
+
+	// 亲和路由, 优先使用已绑定且可用的模型代理
+	if affinity != nil {
+
+		affinityKey := fmt.Sprintf(consts.AFFINITY_MODEL_AGENT, m.Id, affinity.Key)
+
+		defer func() {
+			if modelAgent != nil {
+				common.BindAffinity(ctx, affinityKey, modelAgent.Id, affinity.Ttl)
+			}
+		}()
+
+		if id := common.GetAffinity(ctx, affinityKey); id != "" {
+			for _, modelAgent := range filterModelAgentList {
+				if modelAgent.Id == id {
+					return len(filterModelAgentList), modelAgent, nil
+				}
+			}
+		}
+	}
+
+	// 负载策略-最低成本
+	if m.LbStrategy == 4 {
+		return len(filterModelAgentList), s.pickLowestCost(ctx, filterModelAgentList), nil
+	}
+
 	// 负载策略-权重
 	if m.LbStrategy == 2 {
 		return len(filterModelAgentList), lb.NewModelAgentWeight(filterModelAgentList).PickModelAgent(), nil
 	}
 
+	// 负载策略-最快响应
+	if m.LbStrategy == 3 {
+		return len(filterModelAgentList), common.GetLatency(ctx, s.modelAgentsLatencyCache, m.Id).PickModelAgent(filterModelAgentList), nil
+	}
+
 	if roundRobinValue := s.modelAgentsRoundRobinCache.GetVal(ctx, m.Id); roundRobinValue != nil {
 		roundRobin = roundRobinValue.(*lb.RoundRobin)
 	}
@@ -312,6 +370,136 @@ func (s *sModelAgent) PickModelAgent(ctx context.Context, m *model.Model) (int,
 	return len(filterModelAgentList), filterModelAgentList[roundRobin.Index(len(filterModelAgentList))], nil
 }
 
+// 只读挑选模型代理, 不占用并发数、不排队等待、不发起熔断探测, 用于费用预估等不实际请求上游的场景
+func (s *sModelAgent) PeekModelAgent(ctx context.Context, m *model.Model, excludeIds ...string) (total int, modelAgent *model.ModelAgent, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sModelAgent PeekModelAgent time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	modelAgents, err := s.getModelAgents(ctx, m)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errorModelAgents := service.Session().GetErrorModelAgents(ctx)
+
+	modelAgentList := make([]*model.ModelAgent, 0)
+	for _, modelAgent := range modelAgents {
+		// 过滤被禁用、已熔断、错误和排除的模型代理
+		if modelAgent.Status == 1 && service.Breaker().GetState(ctx, consts.BREAKER_TYPE_MODEL_AGENT, modelAgent.Id) != consts.BREAKER_STATE_OPEN &&
+			!slices.Contains(errorModelAgents, modelAgent.Id) && !slices.Contains(excludeIds, modelAgent.Id) {
+			modelAgentList = append(modelAgentList, modelAgent)
+		}
+	}
+
+	if len(modelAgentList) == 0 {
+		return 0, nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT
+	}
+
+	// 负载策略-最低成本
+	if m.LbStrategy == 4 {
+		return len(modelAgentList), s.pickLowestCost(ctx, modelAgentList), nil
+	}
+
+	// 负载策略-权重
+	if m.LbStrategy == 2 {
+		return len(modelAgentList), lb.NewModelAgentWeight(modelAgentList).PickModelAgent(), nil
+	}
+
+	// 负载策略-最快响应
+	if m.LbStrategy == 3 {
+		return len(modelAgentList), common.GetLatency(ctx, s.modelAgentsLatencyCache, m.Id).PickModelAgent(modelAgentList), nil
+	}
+
+	// 轮询只查看当前下标, 不推进
+	if roundRobinValue := s.modelAgentsRoundRobinCache.GetVal(ctx, m.Id); roundRobinValue != nil {
+		return len(modelAgentList), modelAgentList[roundRobinValue.(*lb.RoundRobin).Current(len(modelAgentList))], nil
+	}
+
+	return len(modelAgentList), modelAgentList[0], nil
+}
+
+// 获取模型的模型代理列表
+func (s *sModelAgent) getModelAgents(ctx context.Context, m *model.Model) (modelAgents []*model.ModelAgent, err error) {
+
+	if modelAgentsValue := s.modelAgentsCache.GetVal(ctx, m.Id); modelAgentsValue != nil {
+		modelAgents = modelAgentsValue.([]*model.ModelAgent)
+	}
+
+	if len(modelAgents) == 0 {
+
+		modelAgents, err = s.GetCacheList(ctx, m.ModelAgents...)
+		if err != nil || len(modelAgents) != len(m.ModelAgents) {
+
+			if modelAgents, err = s.List(ctx, m.ModelAgents); err != nil {
+				logger.Error(ctx, err)
+				return nil, err
+			}
+
+			if err = s.SaveCacheList(ctx, modelAgents); err != nil {
+				logger.Error(ctx, err)
+				return nil, err
+			}
+		}
+
+		if len(modelAgents) == 0 {
+			return nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT
+		}
+
+		if err = s.modelAgentsCache.Set(ctx, m.Id, modelAgents, 0); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+	}
+
+	return modelAgents, nil
+}
+
+// 负载策略-最低成本, 按成本系数从低到高挑选, 成本较低的模型代理出错、熔断、并发已满(已在挑选前过滤)或密钥均在限流冷却中时溢出到成本较高的模型代理
+func (s *sModelAgent) pickLowestCost(ctx context.Context, modelAgents []*model.ModelAgent) *model.ModelAgent {
+
+	modelAgentList := slices.Clone(modelAgents)
+	slices.SortStableFunc(modelAgentList, func(a, b *model.ModelAgent) int {
+		return cmp.Compare(a.Cost, b.Cost)
+	})
+
+	for _, modelAgent := range modelAgentList {
+
+		if s.isCooldown(ctx, modelAgent) {
+			continue
+		}
+
+		return modelAgent
+	}
+
+	// 均不满足时仍使用成本最低的模型代理
+	return modelAgentList[0]
+}
+
+// 模型代理的密钥是否均在限流冷却中
+func (s *sModelAgent) isCooldown(ctx context.Context, modelAgent *model.ModelAgent) bool {
+
+	keysValue := s.modelAgentKeysCache.GetVal(ctx, modelAgent.Id)
+	if keysValue == nil {
+		return false
+	}
+
+	keys := keysValue.([]*model.Key)
+	if len(keys) == 0 {
+		return false
+	}
+
+	for _, key := range keys {
+		if key.Status == 1 && !service.Cooldown().IsCooldown(ctx, key.Id) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // 移除模型代理
 func (s *sModelAgent) RemoveModelAgent(ctx context.Context, m *model.Model, modelAgent *model.ModelAgent) {
 
@@ -359,11 +547,29 @@ func (s *sModelAgent) RecordErrorModelAgent(ctx context.Context, m *model.Model,
 		logger.Error(ctx, err)
 	}
 
-	if reply >= config.Cfg.Base.ModelAgentErrDisable {
+	common.GetLatency(ctx, s.modelAgentsLatencyCache, m.Id).RecordError(modelAgent.Id)
+
+	service.Breaker().RecordFailure(ctx, consts.BREAKER_TYPE_MODEL_AGENT, modelAgent.Id)
+
+	// 开启熔断器后由熔断器接管, 不再达到错误次数后禁用
+	if !service.Breaker().IsOpen() && reply >= config.Cfg.Base.ModelAgentErrDisable {
 		s.DisabledModelAgent(ctx, modelAgent, "Reached the maximum number of errors")
 	}
 }
 
+// 记录模型代理延迟
+func (s *sModelAgent) RecordLatencyModelAgent(ctx context.Context, m *model.Model, modelAgent *model.ModelAgent, latency int64) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sModelAgent RecordLatencyModelAgent time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if latency > 0 {
+		common.GetLatency(ctx, s.modelAgentsLatencyCache, m.Id).Record(modelAgent.Id, latency)
+	}
+}
+
 // 禁用模型代理
 func (s *sModelAgent) DisabledModelAgent(ctx context.Context, modelAgent *model.ModelAgent, disabledReason string) {
 
@@ -385,10 +591,15 @@ func (s *sModelAgent) DisabledModelAgent(ctx context.Context, modelAgent *model.
 	}); err != nil {
 		logger.Error(ctx, err)
 	}
+
+	// 重新计数健康探测次数
+	if _, err := redis.HDel(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, modelAgent.Id); err != nil {
+		logger.Error(ctx, err)
+	}
 }
 
 // 挑选模型代理密钥
-func (s *sModelAgent) PickModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent) (int, *model.Key, error) {
+func (s *sModelAgent) PickModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, affinity *model.Affinity, retry ...int) (total int, key *model.Key, err error) {
 
 	now := gtime.TimestampMilli()
 	defer func() {
@@ -398,42 +609,62 @@ func (s *sModelAgent) PickModelAgentKey(ctx context.Context, modelAgent *model.M
 	var (
 		keys       []*model.Key
 		roundRobin *lb.RoundRobin
-		err        error
+		probeIds   []string
 	)
 
-	if keysValue := s.modelAgentKeysCache.GetVal(ctx, modelAgent.Id); keysValue != nil {
-		keys = keysValue.([]*model.Key)
-	}
-
-	if len(keys) == 0 {
-
-		if keys, err = s.GetCacheModelAgentKeys(ctx, modelAgent.Id); err != nil {
-			if keys, err = s.GetModelAgentKeys(ctx, modelAgent.Id); err != nil {
-				logger.Error(ctx, err)
-				return 0, nil, err
+	defer func() {
+		if len(probeIds) > 0 {
+			pickedId := ""
+			if key != nil {
+				pickedId = key.Id
 			}
+			common.ReleaseProbes(ctx, consts.BREAKER_TYPE_MODEL_AGENT_KEY, probeIds, pickedId)
 		}
+	}()
 
-		if len(keys) == 0 {
-			return 0, nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT_KEY
+	defer func() {
+		// 占用密钥并发数, 被其他请求抢先占满时重新挑选, 超过最大次数时返回排队已满
+		if key != nil && !service.Concurrency().Acquire(ctx, consts.CONCURRENCY_TYPE_KEY, key.Id, key.MaxConcurrency) {
+			if len(retry) >= consts.CONCURRENCY_ACQUIRE_MAX_RETRY {
+				total, key, err = 0, nil, errors.ERR_CONCURRENCY_QUEUE_FULL
+				return
+			}
+			total, key, err = s.PickModelAgentKey(ctx, modelAgent, affinity, append(retry, 1)...)
 		}
+	}()
 
-		if err = s.SaveCacheModelAgentKeys(ctx, modelAgent.Id, keys); err != nil {
-			logger.Error(ctx, err)
-			return 0, nil, err
-		}
+	if keys, err = s.getModelAgentKeys(ctx, modelAgent); err != nil {
+		return 0, nil, err
 	}
 
+	enabledTotal := 0
 	keyList := make([]*model.Key, 0)
 	for _, key := range keys {
 		// 过滤被禁用的模型代理密钥
 		if key.Status == 1 {
-			keyList = append(keyList, key)
+			enabledTotal++
+			// 过滤限流冷却中的模型代理密钥
+			if service.Cooldown().IsCooldown(ctx, key.Id) {
+				continue
+			}
+			// 过滤已熔断的模型代理密钥
+			if isAllow, isProbe := service.Breaker().Allow(ctx, consts.BREAKER_TYPE_MODEL_AGENT_KEY, key.Id); isAllow {
+				keyList = append(keyList, key)
+				if isProbe {
+					probeIds = append(probeIds, key.Id)
+				}
+			}
 		}
 	}
 
 	if len(keyList) == 0 {
-		return 0, nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT_KEY
+
+		if enabledTotal == 0 {
+			return 0, nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT_KEY
+		}
+
+		// 存在启用的密钥, 但均在冷却中或已熔断, 为暂时不可用
+		return 0, nil, errors.ERR_MODEL_AGENT_KEY_UNAVAILABLE
 	}
 
 	filterKeyList := make([]*model.Key, 0)
@@ -457,11 +688,50 @@ func (s *sModelAgent) PickModelAgentKey(ctx context.Context, modelAgent *model.M
 		return 0, nil, errors.ERR_ALL_MODEL_AGENT_KEY
 	}
 
+	// 过滤并发已满的密钥, 均已满时排队等待
+	if concurrencyKeyList := common.FilterConcurrencyKeys(ctx, filterKeyList); len(concurrencyKeyList) > 0 {
+		filterKeyList = concurrencyKeyList
+	} else {
+		if err = service.Concurrency().Wait(ctx, modelAgent.Id, func() bool {
+			concurrencyKeyList = common.FilterConcurrencyKeys(ctx, filterKeyList)
+			return len(concurrencyKeyList) > 0
+		}); err != nil {
+			logger.Error(ctx, err)
+			return 0, nil, err
+		}
+		filterKeyList = concurrencyKeyList
+	}
+
+	// 亲和路由, 优先使用已绑定且可用的模型代理密钥
+	if affinity != nil {
+
+		affinityKey := fmt.Sprintf(consts.AFFINITY_MODEL_AGENT_KEY, modelAgent.Id, affinity.Key)
+
+		defer func() {
+			if key != nil {
+				common.BindAffinity(ctx, affinityKey, key.Id, affinity.Ttl)
+			}
+		}()
+
+		if id := common.GetAffinity(ctx, affinityKey); id != "" {
+			for _, key := range filterKeyList {
+				if key.Id == id {
+					return len(filterKeyList), key, nil
+				}
+			}
+		}
+	}
+
 	// 负载策略-权重
 	if modelAgent.LbStrategy == 2 {
 		return len(filterKeyList), lb.NewKeyWeight(filterKeyList).PickKey(), nil
 	}
 
+	// 负载策略-最快响应
+	if modelAgent.LbStrategy == 3 {
+		return len(filterKeyList), common.GetLatency(ctx, s.modelAgentKeysLatencyCache, modelAgent.Id).PickKey(filterKeyList), nil
+	}
+
 	if roundRobinValue := s.modelAgentKeysRoundRobinCache.GetVal(ctx, modelAgent.Id); roundRobinValue != nil {
 		roundRobin = roundRobinValue.(*lb.RoundRobin)
 	}
@@ -477,6 +747,82 @@ func (s *sModelAgent) PickModelAgentKey(ctx context.Context, modelAgent *model.M
 	return len(filterKeyList), filterKeyList[roundRobin.Index(len(filterKeyList))], nil
 }
 
+// 只读挑选模型代理密钥, 不占用并发数、不排队等待、不发起熔断探测, 跳过排除的密钥
+func (s *sModelAgent) PeekModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, excludeIds ...string) (total int, key *model.Key, err error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sModelAgent PeekModelAgentKey time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	keys, err := s.getModelAgentKeys(ctx, modelAgent)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	errorKeys := service.Session().GetErrorKeys(ctx)
+
+	keyList := make([]*model.Key, 0)
+	for _, key := range keys {
+		// 过滤被禁用、冷却中、已熔断、错误和排除的模型代理密钥
+		if key.Status == 1 && !service.Cooldown().IsCooldown(ctx, key.Id) && service.Breaker().GetState(ctx, consts.BREAKER_TYPE_MODEL_AGENT_KEY, key.Id) != consts.BREAKER_STATE_OPEN &&
+			!slices.Contains(errorKeys, key.Id) && !slices.Contains(excludeIds, key.Id) {
+			keyList = append(keyList, key)
+		}
+	}
+
+	// 只读挑选不排队, 并发已满的密钥直接跳过
+	if keyList = common.FilterConcurrencyKeys(ctx, keyList); len(keyList) == 0 {
+		return 0, nil, errors.ERR_ALL_MODEL_AGENT_KEY
+	}
+
+	// 负载策略-权重
+	if modelAgent.LbStrategy == 2 {
+		return len(keyList), lb.NewKeyWeight(keyList).PickKey(), nil
+	}
+
+	// 负载策略-最快响应
+	if modelAgent.LbStrategy == 3 {
+		return len(keyList), common.GetLatency(ctx, s.modelAgentKeysLatencyCache, modelAgent.Id).PickKey(keyList), nil
+	}
+
+	// 轮询只查看当前下标, 不推进
+	if roundRobinValue := s.modelAgentKeysRoundRobinCache.GetVal(ctx, modelAgent.Id); roundRobinValue != nil {
+		return len(keyList), keyList[roundRobinValue.(*lb.RoundRobin).Current(len(keyList))], nil
+	}
+
+	return len(keyList), keyList[0], nil
+}
+
+// 获取模型代理的密钥列表
+func (s *sModelAgent) getModelAgentKeys(ctx context.Context, modelAgent *model.ModelAgent) (keys []*model.Key, err error) {
+
+	if keysValue := s.modelAgentKeysCache.GetVal(ctx, modelAgent.Id); keysValue != nil {
+		keys = keysValue.([]*model.Key)
+	}
+
+	if len(keys) == 0 {
+
+		if keys, err = s.GetCacheModelAgentKeys(ctx, modelAgent.Id); err != nil {
+			if keys, err = s.GetModelAgentKeys(ctx, modelAgent.Id); err != nil {
+				logger.Error(ctx, err)
+				return nil, err
+			}
+		}
+
+		if len(keys) == 0 {
+			return nil, errors.ERR_NO_AVAILABLE_MODEL_AGENT_KEY
+		}
+
+		if err = s.SaveCacheModelAgentKeys(ctx, modelAgent.Id, keys); err != nil {
+			logger.Error(ctx, err)
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
 // 移除模型代理密钥
 func (s *sModelAgent) RemoveModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, key *model.Key) {
 
@@ -526,11 +872,29 @@ func (s *sModelAgent) RecordErrorModelAgentKey(ctx context.Context, modelAgent *
 		logger.Error(ctx, err)
 	}
 
-	if reply >= config.Cfg.Base.ModelAgentKeyErrDisable {
+	common.GetLatency(ctx, s.modelAgentKeysLatencyCache, modelAgent.Id).RecordError(key.Id)
+
+	service.Breaker().RecordFailure(ctx, consts.BREAKER_TYPE_MODEL_AGENT_KEY, key.Id)
+
+	// 开启熔断器后由熔断器接管, 不再达到错误次数后禁用
+	if !service.Breaker().IsOpen() && reply >= config.Cfg.Base.ModelAgentKeyErrDisable {
 		s.DisabledModelAgentKey(ctx, key, "Reached the maximum number of errors")
 	}
 }
 
+// 记录模型代理密钥延迟
+func (s *sModelAgent) RecordLatencyModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, key *model.Key, latency int64) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sModelAgent RecordLatencyModelAgentKey time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	if latency > 0 {
+		common.GetLatency(ctx, s.modelAgentKeysLatencyCache, modelAgent.Id).Record(key.Id, latency)
+	}
+}
+
 // 禁用模型代理密钥
 func (s *sModelAgent) DisabledModelAgentKey(ctx context.Context, key *model.Key, disabledReason string) {
 
@@ -547,12 +911,14 @@ func (s *sModelAgent) DisabledModelAgentKey(ctx context.Context, key *model.Key,
 		Key:                key.Key,
 		Type:               key.Type,
 		Weight:             key.Weight,
+		MaxConcurrency:     key.MaxConcurrency,
 		Models:             key.Models,
 		ModelAgents:        key.ModelAgents,
 		IsLimitQuota:       key.IsLimitQuota,
 		Quota:              key.Quota,
 		UsedQuota:          key.UsedQuota,
 		QuotaExpiresAt:     key.QuotaExpiresAt,
+		RateLimit:          key.RateLimit,
 		IpWhitelist:        key.IpWhitelist,
 		IpBlacklist:        key.IpBlacklist,
 		Status:             2,
@@ -567,6 +933,11 @@ func (s *sModelAgent) DisabledModelAgentKey(ctx context.Context, key *model.Key,
 	}); err != nil {
 		logger.Error(ctx, err)
 	}
+
+	// 重新计数健康探测次数
+	if _, err := redis.HDel(ctx, consts.HEALTH_PROBE_ATTEMPTS_KEY, key.Id); err != nil {
+		logger.Error(ctx, err)
+	}
 }
 
 // 保存模型代理列表到缓存
@@ -670,15 +1041,17 @@ func (s *sModelAgent) CreateCacheModelAgent(ctx context.Context, newData *model.
 	}()
 
 	if err := s.SaveCacheList(ctx, []*model.ModelAgent{{
-		Id:         newData.Id,
-		Corp:       newData.Corp,
-		Name:       newData.Name,
-		BaseUrl:    newData.BaseUrl,
-		Path:       newData.Path,
-		Weight:     newData.Weight,
-		LbStrategy: newData.LbStrategy,
-		Models:     newData.Models,
-		Status:     newData.Status,
+		Id:             newData.Id,
+		Corp:           newData.Corp,
+		Name:           newData.Name,
+		BaseUrl:        newData.BaseUrl,
+		Path:           newData.Path,
+		Weight:         newData.Weight,
+		LbStrategy:     newData.LbStrategy,
+		Cost:           newData.Cost,
+		MaxConcurrency: newData.MaxConcurrency,
+		Models:         newData.Models,
+		Status:         newData.Status,
 	}}); err != nil {
 		logger.Error(ctx, err)
 	}
@@ -709,6 +1082,8 @@ func (s *sModelAgent) UpdateCacheModelAgent(ctx context.Context, oldData *model.
 		Path:               newData.Path,
 		Weight:             newData.Weight,
 		LbStrategy:         newData.LbStrategy,
+		Cost:               newData.Cost,
+		MaxConcurrency:     newData.MaxConcurrency,
 		Models:             newData.Models,
 		Status:             newData.Status,
 		IsAutoDisabled:     newData.IsAutoDisabled,
@@ -919,12 +1294,14 @@ func (s *sModelAgent) CreateCacheModelAgentKey(ctx context.Context, key *entity.
 		Key:            key.Key,
 		Type:           key.Type,
 		Weight:         key.Weight,
+		MaxConcurrency: key.MaxConcurrency,
 		Models:         key.Models,
 		ModelAgents:    key.ModelAgents,
 		IsLimitQuota:   key.IsLimitQuota,
 		Quota:          key.Quota,
 		UsedQuota:      key.UsedQuota,
 		QuotaExpiresAt: key.QuotaExpiresAt,
+		RateLimit:      key.RateLimit,
 		IpWhitelist:    key.IpWhitelist,
 		IpBlacklist:    key.IpBlacklist,
 		Status:         key.Status,
@@ -960,12 +1337,14 @@ func (s *sModelAgent) UpdateCacheModelAgentKey(ctx context.Context, oldData *ent
 		Key:                newData.Key,
 		Type:               newData.Type,
 		Weight:             newData.Weight,
+		MaxConcurrency:     newData.MaxConcurrency,
 		Models:             newData.Models,
 		ModelAgents:        newData.ModelAgents,
 		IsLimitQuota:       newData.IsLimitQuota,
 		Quota:              newData.Quota,
 		UsedQuota:          newData.UsedQuota,
 		QuotaExpiresAt:     newData.QuotaExpiresAt,
+		RateLimit:          newData.RateLimit,
 		IpWhitelist:        newData.IpWhitelist,
 		IpBlacklist:        newData.IpBlacklist,
 		Status:             newData.Status,
@@ -1154,15 +1533,15 @@ func (s *sModelAgent) SaveCache(ctx context.Context, modelAgent *model.ModelAgen
 }
 
 // 获取后备模型代理
-func (s *sModelAgent) GetFallbackModelAgent(ctx context.Context, model *model.Model) (fallbackModelAgent *model.ModelAgent, err error) {
+func (s *sModelAgent) GetFallbackModelAgent(ctx context.Context, id string) (fallbackModelAgent *model.ModelAgent, err error) {
 
 	now := gtime.TimestampMilli()
 	defer func() {
 		logger.Debugf(ctx, "sModelAgent GetFallbackModelAgent time: %d", gtime.TimestampMilli()-now)
 	}()
 
-	if fallbackModelAgent, err = s.GetCacheModelAgent(ctx, model.FallbackConfig.ModelAgent); err != nil || fallbackModelAgent == nil {
-		if fallbackModelAgent, err = s.GetModelAgentAndSaveCache(ctx, model.FallbackConfig.ModelAgent); err != nil {
+	if fallbackModelAgent, err = s.GetCacheModelAgent(ctx, id); err != nil || fallbackModelAgent == nil {
+		if fallbackModelAgent, err = s.GetModelAgentAndSaveCache(ctx, id); err != nil {
 			logger.Error(ctx, err)
 			return nil, err
 		}
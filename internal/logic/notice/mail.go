@@ -0,0 +1,104 @@
+package notice
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 通过SMTP发送邮件, 465端口使用SSL连接, 其它端口由服务端决定是否启用STARTTLS
+func sendMail(email *common.Email, to, subject, content string, timeout time.Duration) error {
+
+	addr := net.JoinHostPort(email.Host, strconv.Itoa(email.Port))
+	auth := smtp.PlainAuth("", email.UserName, email.Password, email.Host)
+
+	from := email.UserName
+	if email.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", encodeHeader(email.FromName), email.UserName)
+	}
+
+	message := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + encodeHeader(subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Transfer-Encoding: base64",
+		"",
+		base64.StdEncoding.EncodeToString([]byte(content)),
+	}, "\r\n")
+
+	var (
+		dialer = &net.Dialer{Timeout: timeout}
+		conn   net.Conn
+		err    error
+	)
+
+	if email.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: email.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 整个发送过程的超时时间, smtp.SendMail 没有超时控制, 服务端无响应时会一直阻塞
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, email.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if email.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(&tls.Config{ServerName: email.Host}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = client.Auth(auth); err != nil {
+		return err
+	}
+
+	if err = client.Mail(email.UserName); err != nil {
+		return err
+	}
+
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = writer.Write([]byte(message)); err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// 邮件头非ASCII字符编码
+func encodeHeader(s string) string {
+	return fmt.Sprintf("=?UTF-8?B?%s?=", base64.StdEncoding.EncodeToString([]byte(s)))
+}
@@ -0,0 +1,393 @@
+package notice
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/database/gredis"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/grpool"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+type sNotice struct{}
+
+// 剩余额度高于上次记录时视为充值, 以充值后的剩余额度作为发放额度
+var grantedScript = `
+local last = tonumber(redis.call('HGET', KEYS[1], 'last'))
+local granted = tonumber(redis.call('HGET', KEYS[1], 'granted'))
+local quota = tonumber(ARGV[1])
+if last == nil or granted == nil or quota > last then
+	granted = quota
+end
+redis.call('HSET', KEYS[1], 'last', quota, 'granted', granted)
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return granted
+`
+
+func init() {
+	service.RegisterNotice(New())
+}
+
+func New() service.INotice {
+	return &sNotice{}
+}
+
+// 额度通知检查, 剩余额度低于阈值或耗尽时发送通知
+func (s *sNotice) CheckQuota(ctx context.Context, typ string, userId, appId int, key string, quota int) {
+
+	cfg := config.Cfg.QuotaNotice
+	if cfg == nil || !cfg.Open {
+		return
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sNotice CheckQuota time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	notice := &model.QuotaNotice{
+		Type:   typ,
+		UserId: userId,
+		AppId:  appId,
+		Key:    key,
+		Quota:  quota,
+	}
+
+	var quotaBudget *common.QuotaBudget
+
+	switch typ {
+	case consts.NOTICE_TYPE_APP:
+
+		app, err := service.App().GetCacheApp(ctx, appId)
+		if err != nil {
+			logger.Error(ctx, err)
+			return
+		}
+
+		quotaBudget = app.QuotaBudget
+
+	case consts.NOTICE_TYPE_APP_KEY:
+
+		appKey, err := service.App().GetCacheAppKey(ctx, key)
+		if err != nil {
+			logger.Error(ctx, err)
+			return
+		}
+
+		quotaBudget = appKey.QuotaBudget
+	}
+
+	// 未配置额度预算时同一阈值在去重周期内只通知一次, 有额度预算时在每个预算周期内只通知一次
+	period := ""
+	ttl := cfg.Period
+	if ttl <= 0 {
+		ttl = 86400
+	}
+
+	if quotaBudget != nil && quotaBudget.Period > 0 && quotaBudget.ResetAt > 0 {
+		notice.TotalQuota = quotaBudget.Allowance
+		period = fmt.Sprintf("%d", quotaBudget.ResetAt)
+		ttl = 31 * 86400
+	} else if quota > 0 {
+		granted, err := s.grantedQuota(ctx, noticeTarget(notice), quota)
+		if err != nil {
+			logger.Error(ctx, err)
+			return
+		}
+		notice.TotalQuota = granted
+	}
+
+	if quota <= 0 {
+		notice.Event = consts.NOTICE_EVENT_QUOTA_EXHAUSTED
+	} else {
+
+		if notice.TotalQuota <= 0 {
+			return
+		}
+
+		// 同时低于多个阈值时按最低的阈值通知
+		percent := float64(quota) * 100 / float64(notice.TotalQuota)
+		for _, threshold := range cfg.Thresholds {
+			if percent < float64(threshold) && (notice.Threshold == 0 || threshold < notice.Threshold) {
+				notice.Threshold = threshold
+			}
+		}
+
+		if notice.Threshold == 0 {
+			return
+		}
+
+		notice.Event = consts.NOTICE_EVENT_QUOTA_LOW
+	}
+
+	s.send(ctx, cfg, notice, fmt.Sprintf("%d:%s", notice.Threshold, period), ttl)
+}
+
+// 额度过期通知检查, 额度即将过期时发送通知
+func (s *sNotice) CheckQuotaExpires(ctx context.Context) error {
+
+	cfg := config.Cfg.QuotaNotice
+	if cfg == nil || !cfg.Open || cfg.ExpireWarning <= 0 {
+		return nil
+	}
+
+	// 多实例下同一分钟内只由一个实例执行
+	lockTtl := int64(50)
+	reply, err := redis.Set(ctx, consts.LOCK_QUOTA_NOTICE_KEY, gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &lockTtl},
+		NX:        true,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	if reply.IsEmpty() {
+		return nil
+	}
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sNotice CheckQuotaExpires time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	quotaExpiresAt := bson.M{"$gt": now, "$lte": now + cfg.ExpireWarning*1000}
+
+	// 同一过期时间只通知一次, 续期后过期时间变化会重新通知
+	ttl := cfg.ExpireWarning + 86400
+
+	users, err := dao.User.Find(ctx, bson.M{"quota_expires_at": quotaExpiresAt, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, user := range users {
+		s.send(ctx, cfg, &model.QuotaNotice{
+			Type:           consts.NOTICE_TYPE_USER,
+			Event:          consts.NOTICE_EVENT_QUOTA_EXPIRING,
+			UserId:         user.UserId,
+			Quota:          user.Quota,
+			QuotaExpiresAt: user.QuotaExpiresAt,
+		}, fmt.Sprintf("%d", user.QuotaExpiresAt), ttl)
+	}
+
+	apps, err := dao.App.Find(ctx, bson.M{"is_limit_quota": true, "quota_expires_at": quotaExpiresAt, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, app := range apps {
+		s.send(ctx, cfg, &model.QuotaNotice{
+			Type:           consts.NOTICE_TYPE_APP,
+			Event:          consts.NOTICE_EVENT_QUOTA_EXPIRING,
+			UserId:         app.UserId,
+			AppId:          app.AppId,
+			Quota:          app.Quota,
+			QuotaExpiresAt: app.QuotaExpiresAt,
+		}, fmt.Sprintf("%d", app.QuotaExpiresAt), ttl)
+	}
+
+	keys, err := dao.Key.Find(ctx, bson.M{"type": 1, "is_limit_quota": true, "quota_expires_at": quotaExpiresAt, "status": 1})
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	for _, key := range keys {
+		s.send(ctx, cfg, &model.QuotaNotice{
+			Type:           consts.NOTICE_TYPE_APP_KEY,
+			Event:          consts.NOTICE_EVENT_QUOTA_EXPIRING,
+			UserId:         key.UserId,
+			AppId:          key.AppId,
+			Key:            key.Key,
+			Quota:          key.Quota,
+			QuotaExpiresAt: key.QuotaExpiresAt,
+		}, fmt.Sprintf("%d", key.QuotaExpiresAt), ttl)
+	}
+
+	return nil
+}
+
+// 软限制通知, 剩余额度低于软限制额度时发送通知, 同一软限制在去重周期内只通知一次
+func (s *sNotice) SoftLimit(ctx context.Context, typ string, userId, appId int, key string, quota int, softLimit *common.SoftLimit) {
+
+	cfg := config.Cfg.QuotaNotice
+	if cfg == nil || !cfg.Open {
+		return
+	}
+
+	ttl := cfg.Period
+	if ttl <= 0 {
+		ttl = 86400
+	}
+
+	s.send(ctx, cfg, &model.QuotaNotice{
+		Type:        typ,
+		Event:       consts.NOTICE_EVENT_SOFT_LIMIT,
+		UserId:      userId,
+		AppId:       appId,
+		Key:         key,
+		Quota:       quota,
+		SoftLimit:   softLimit.Quota,
+		TargetModel: softLimit.TargetModel,
+	}, fmt.Sprintf("%d", softLimit.Quota), ttl)
+}
+
+// 发送通知, 按通知对象、事件和去重标识去重
+func (s *sNotice) send(ctx context.Context, cfg *common.QuotaNotice, notice *model.QuotaNotice, mark string, ttl int64) {
+
+	reply, err := redis.Set(ctx, fmt.Sprintf(consts.QUOTA_NOTICE_KEY, noticeTarget(notice), notice.Event, mark), gtime.TimestampMilli(), gredis.SetOption{
+		TTLOption: gredis.TTLOption{EX: &ttl},
+		NX:        true,
+	})
+	if err != nil {
+		logger.Error(ctx, err)
+		return
+	}
+
+	if reply.IsEmpty() {
+		return
+	}
+
+	notice.Key = maskKey(notice.Key)
+	notice.CreatedAt = gtime.TimestampMilli()
+
+	logger.Infof(ctx, "sNotice send notice: %s", gjson.MustEncodeString(notice))
+
+	// 邮件和Webhook异步发送, 避免阻塞账本入账
+	if err = grpool.AddWithRecover(gctx.NeverDone(ctx), func(ctx context.Context) {
+
+		if cfg.EmailOpen {
+			if err := s.sendEmail(ctx, notice); err != nil {
+				logger.Errorf(ctx, "sNotice sendEmail notice: %s, error: %v", gjson.MustEncodeString(notice), err)
+			}
+		}
+
+		if cfg.Webhook != "" {
+			if err := s.sendWebhook(ctx, cfg.Webhook, notice); err != nil {
+				logger.Errorf(ctx, "sNotice sendWebhook notice: %s, error: %v", gjson.MustEncodeString(notice), err)
+			}
+		}
+	}, nil); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 发放额度, 以最近一次充值(剩余额度增加)后的剩余额度作为总额度, 未记录时以当前剩余额度初始化
+func (s *sNotice) grantedQuota(ctx context.Context, target string, quota int) (int, error) {
+
+	reply, err := redis.Eval(ctx, grantedScript, 1, []string{fmt.Sprintf(consts.QUOTA_NOTICE_GRANTED_KEY, target)}, []interface{}{quota, 31 * 86400})
+	if err != nil {
+		return 0, err
+	}
+
+	return reply.Int(), nil
+}
+
+// 通知对象
+func noticeTarget(notice *model.QuotaNotice) string {
+	switch notice.Type {
+	case consts.NOTICE_TYPE_APP:
+		return fmt.Sprintf("%s:%d", notice.Type, notice.AppId)
+	case consts.NOTICE_TYPE_APP_KEY:
+		return fmt.Sprintf("%s:%s", notice.Type, notice.Key)
+	}
+	return fmt.Sprintf("%s:%d", notice.Type, notice.UserId)
+}
+
+// 发送邮件通知到用户邮箱
+func (s *sNotice) sendEmail(ctx context.Context, notice *model.QuotaNotice) error {
+
+	if config.Cfg.Email == nil || !config.Cfg.Email.Open {
+		return nil
+	}
+
+	user, err := dao.User.FindOne(ctx, bson.M{"user_id": notice.UserId})
+	if err != nil {
+		return err
+	}
+
+	if user.Email == "" {
+		return nil
+	}
+
+	subject, content := getNoticeContent(notice)
+
+	return sendMail(config.Cfg.Email, user.Email, subject, content, config.Cfg.Http.Timeout*time.Second)
+}
+
+// 发送Webhook通知
+func (s *sNotice) sendWebhook(ctx context.Context, webhook string, notice *model.QuotaNotice) error {
+
+	response, err := g.Client().Timeout(config.Cfg.Http.Timeout*time.Second).ContentJson().Post(ctx, webhook, notice)
+	if response != nil {
+		defer func() {
+			if err := response.Close(); err != nil {
+				logger.Error(ctx, err)
+			}
+		}()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return errors.Newf("statusCode: %d, response: %s", response.StatusCode, response.ReadAllString())
+	}
+
+	return nil
+}
+
+// 通知标题和内容
+func getNoticeContent(notice *model.QuotaNotice) (subject, content string) {
+
+	target := "您的账号"
+	switch notice.Type {
+	case consts.NOTICE_TYPE_APP:
+		target = fmt.Sprintf("您的应用(ID: %d)", notice.AppId)
+	case consts.NOTICE_TYPE_APP_KEY:
+		target = fmt.Sprintf("您的应用密钥 %s ", notice.Key)
+	}
+
+	switch notice.Event {
+	case consts.NOTICE_EVENT_QUOTA_LOW:
+		return "额度不足提醒", fmt.Sprintf("%s剩余额度为 %d, 已低于总额度 %d 的 %d%%, 请及时充值。", target, notice.Quota, notice.TotalQuota, notice.Threshold)
+	case consts.NOTICE_EVENT_QUOTA_EXHAUSTED:
+		return "额度耗尽提醒", fmt.Sprintf("%s额度已用尽, 后续请求将被拒绝, 请及时充值。", target)
+	case consts.NOTICE_EVENT_QUOTA_EXPIRING:
+		return "额度即将过期提醒", fmt.Sprintf("%s剩余额度 %d 将于 %s 过期, 请及时使用或续期。", target, notice.Quota, gtime.NewFromTimeStamp(notice.QuotaExpiresAt).String())
+	case consts.NOTICE_EVENT_SOFT_LIMIT:
+		if notice.TargetModel != "" {
+			return "额度软限制提醒", fmt.Sprintf("%s剩余额度为 %d, 已低于软限制额度 %d, 后续请求将降级到模型 %s, 请及时充值。", target, notice.Quota, notice.SoftLimit, notice.TargetModel)
+		}
+		return "额度软限制提醒", fmt.Sprintf("%s剩余额度为 %d, 已低于软限制额度 %d, 请求仍可继续, 请及时充值。", target, notice.Quota, notice.SoftLimit)
+	}
+
+	return "额度提醒", target
+}
+
+// 密钥脱敏
+func maskKey(key string) string {
+
+	if len(key) <= 12 {
+		return key
+	}
+
+	return key[:8] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,211 @@
+package pricing
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"math"
+	"time"
+)
+
+type sPricing struct{}
+
+func init() {
+	service.RegisterPricing(New())
+}
+
+func New() service.IPricing {
+	return &sPricing{}
+}
+
+// 对话计费, 按模型类型选择额度配置
+func (s *sPricing) Chat(ctx context.Context, m *model.Model, usage *model.PricingUsage) int {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sPricing Chat time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	switch m.Type {
+	case 100: // 多模态
+
+		// 图像和搜索额度按文本额度的分时折扣计费
+		quota := usage.ImageQuota
+
+		if usage.IsSearch {
+			quota += m.MultimodalQuota.SearchQuota
+		}
+
+		return s.Text(ctx, m.MultimodalQuota.TextQuota, usage) + applyDiscount(ctx, float64(quota), m.MultimodalQuota.TextQuota.TimeDiscounts)
+
+	case 102: // 多模态语音
+
+		// 未返回音频令牌明细时全部按音频倍率计费
+		if usage.AudioPromptTokens == 0 && usage.AudioCompletionTokens == 0 {
+			return s.Audio(ctx, m.MultimodalAudioQuota.AudioQuota, usage)
+		}
+
+		textUsage := *usage
+		textUsage.PromptTokens -= usage.AudioPromptTokens
+		textUsage.CompletionTokens -= usage.AudioCompletionTokens
+
+		return s.Text(ctx, m.MultimodalAudioQuota.TextQuota, &textUsage) + s.Audio(ctx, m.MultimodalAudioQuota.AudioQuota, &model.PricingUsage{
+			PromptTokens:     usage.AudioPromptTokens,
+			CompletionTokens: usage.AudioCompletionTokens,
+		})
+	}
+
+	return s.Text(ctx, m.TextQuota, usage)
+}
+
+// 文本计费, 支持阶梯价格、缓存、推理、每次请求附加额度、分时折扣和批处理折扣
+func (s *sPricing) Text(ctx context.Context, textQuota common.TextQuota, usage *model.PricingUsage) int {
+
+	if textQuota.BillingMethod == 2 {
+		return applyDiscount(ctx, float64(textQuota.FixedQuota), textQuota.TimeDiscounts)
+	}
+
+	promptRatio := textQuota.PromptRatio
+	completionRatio := textQuota.CompletionRatio
+	cacheWriteRatio := textQuota.CacheWriteRatio
+	cacheReadRatio := textQuota.CacheReadRatio
+
+	// 阶梯价格按含缓存在内的提示令牌数选择
+	if priceTier := getPriceTier(textQuota.PriceTiers, usage.PromptTokens+usage.CacheWriteTokens+usage.CacheReadTokens); priceTier != nil {
+
+		if priceTier.PromptRatio != 0 {
+			promptRatio = priceTier.PromptRatio
+		}
+
+		if priceTier.CompletionRatio != 0 {
+			completionRatio = priceTier.CompletionRatio
+		}
+
+		if priceTier.CacheWriteRatio != 0 {
+			cacheWriteRatio = priceTier.CacheWriteRatio
+		}
+
+		if priceTier.CacheReadRatio != 0 {
+			cacheReadRatio = priceTier.CacheReadRatio
+		}
+	}
+
+	quota := float64(usage.PromptTokens) * promptRatio
+
+	if textQuota.ReasoningRatio != 0 && usage.ReasoningTokens != 0 {
+		quota += float64(usage.CompletionTokens-usage.ReasoningTokens)*completionRatio + float64(usage.ReasoningTokens)*textQuota.ReasoningRatio
+	} else {
+		quota += float64(usage.CompletionTokens) * completionRatio
+	}
+
+	if usage.CacheWriteTokens != 0 {
+
+		if cacheWriteRatio == 0 {
+			cacheWriteRatio = promptRatio * 1.25
+		}
+
+		quota += float64(usage.CacheWriteTokens) * cacheWriteRatio
+	}
+
+	if usage.CacheReadTokens != 0 {
+
+		if cacheReadRatio == 0 {
+			cacheReadRatio = promptRatio * 0.1
+		}
+
+		quota += float64(usage.CacheReadTokens) * cacheReadRatio
+
+	} else if cacheReadRatio != 0 && usage.CachedTokens != 0 {
+		// 缓存命中令牌数已包含在提示令牌数中并按提示倍率计费, 仅在显式配置缓存读取倍率时按差额调整
+		quota += float64(usage.CachedTokens) * (cacheReadRatio - promptRatio)
+	}
+
+	quota += float64(textQuota.RequestQuota)
+
+	return applyDiscount(ctx, quota, textQuota.TimeDiscounts)
+}
+
+// 音频计费, 支持分时折扣和批处理折扣
+func (s *sPricing) Audio(ctx context.Context, audioQuota common.AudioQuota, usage *model.PricingUsage) int {
+
+	if audioQuota.BillingMethod == 2 {
+		return applyDiscount(ctx, float64(audioQuota.FixedQuota), audioQuota.TimeDiscounts)
+	}
+
+	return applyDiscount(ctx, float64(usage.PromptTokens)*audioQuota.PromptRatio+float64(usage.CompletionTokens)*audioQuota.CompletionRatio, audioQuota.TimeDiscounts)
+}
+
+// 图像计费, 支持分时折扣和批处理折扣
+func (s *sPricing) Image(ctx context.Context, imageQuota common.ImageQuota, n int) int {
+	return applyDiscount(ctx, float64(imageQuota.FixedQuota*n), imageQuota.TimeDiscounts)
+}
+
+// Midjourney计费, 支持分时折扣和批处理折扣
+func (s *sPricing) Midjourney(ctx context.Context, midjourneyQuota common.MidjourneyQuota) int {
+	return applyDiscount(ctx, float64(midjourneyQuota.FixedQuota), midjourneyQuota.TimeDiscounts)
+}
+
+// 按分时折扣和批处理折扣计算额度, 所有计费类型统一经过此处, 向上取整
+func applyDiscount(ctx context.Context, quota float64, timeDiscounts []*common.TimeDiscount) int {
+	return int(math.Ceil(quota * getDiscount(ctx, timeDiscounts) * getBatchDiscount(ctx)))
+}
+
+// 获取提示令牌数超过阈值的最高档位
+func getPriceTier(priceTiers []*common.PriceTier, promptTokens int) (priceTier *common.PriceTier) {
+
+	for _, tier := range priceTiers {
+		if promptTokens > tier.Threshold && (priceTier == nil || tier.Threshold > priceTier.Threshold) {
+			priceTier = tier
+		}
+	}
+
+	return priceTier
+}
+
+// 获取当前时间所在时段的折扣, 不在任何时段内时不打折
+func getDiscount(ctx context.Context, timeDiscounts []*common.TimeDiscount) float64 {
+
+	for _, timeDiscount := range timeDiscounts {
+
+		if timeDiscount.Discount <= 0 {
+			continue
+		}
+
+		location := time.Local
+		if timeDiscount.TimeZone != "" {
+
+			var err error
+			if location, err = time.LoadLocation(timeDiscount.TimeZone); err != nil {
+				logger.Error(ctx, err)
+				continue
+			}
+		}
+
+		current := time.Now().In(location).Format("15:04")
+
+		if timeDiscount.StartTime <= timeDiscount.EndTime {
+			if current >= timeDiscount.StartTime && current < timeDiscount.EndTime {
+				return timeDiscount.Discount
+			}
+		} else if current >= timeDiscount.StartTime || current < timeDiscount.EndTime {
+			return timeDiscount.Discount
+		}
+	}
+
+	return 1
+}
+
+// 获取批处理折扣, 仅批处理任务发起的请求按配置的折扣率计费
+func getBatchDiscount(ctx context.Context) float64 {
+
+	if ctx.Value(consts.BATCH_ID_KEY) == nil || config.Cfg.Batch == nil || config.Cfg.Batch.DiscountRatio <= 0 {
+		return 1
+	}
+
+	return config.Cfg.Batch.DiscountRatio
+}
@@ -0,0 +1,308 @@
+package rate_limit
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/util/gconv"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/redis"
+	"math"
+	"slices"
+)
+
+// 滑动窗口保存在有序集合中, 成员为"权重:请求ID", 分值为请求时间(毫秒), 请求数窗口权重为1, 令牌数窗口权重为令牌数
+// KEYS: 窗口...; ARGV: 当前时间, 窗口时长(毫秒), 请求ID, 令牌数, 每个窗口的类型和限制...
+// 返回: {超限窗口序号(0为未超限), 重试等待时间(毫秒), 每个窗口的剩余量...}, 全部窗口均未超限时才记录本次请求
+const slidingWindowScript = `
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local tokens = tonumber(ARGV[4])
+local result = {0, 0}
+local weights = {}
+local useds = {}
+for i = 1, #KEYS do
+	local typ = ARGV[3 + i * 2]
+	local limit = tonumber(ARGV[4 + i * 2])
+	local weight = 1
+	if typ == 'tokens' then
+		weight = tokens
+	end
+	redis.call('ZREMRANGEBYSCORE', KEYS[i], '-inf', now - window)
+	local entries = redis.call('ZRANGE', KEYS[i], 0, -1, 'WITHSCORES')
+	local used = 0
+	for j = 1, #entries, 2 do
+		used = used + tonumber(string.match(entries[j], '^(%d+):'))
+	end
+	if used + weight > limit or (weight == 0 and used >= limit) then
+		local retryAfter = window
+		local freed = 0
+		for j = 1, #entries, 2 do
+			freed = freed + tonumber(string.match(entries[j], '^(%d+):'))
+			if used - freed + weight <= limit then
+				retryAfter = tonumber(entries[j + 1]) + window - now
+				break
+			end
+		end
+		result[1] = i
+		result[2] = retryAfter
+		return result
+	end
+	weights[i] = weight
+	useds[i] = used
+end
+for i = 1, #KEYS do
+	if weights[i] > 0 then
+		redis.call('ZADD', KEYS[i], now, weights[i] .. ':' .. ARGV[3])
+	end
+	redis.call('PEXPIRE', KEYS[i], window)
+	result[2 + i] = tonumber(ARGV[4 + i * 2]) - useds[i] - weights[i]
+end
+return result
+`
+
+// 滑动窗口时长(毫秒)
+const windowTime = 60000
+
+type sRateLimit struct{}
+
+func init() {
+	service.RegisterRateLimit(New())
+}
+
+func New() service.IRateLimit {
+	return &sRateLimit{}
+}
+
+type window struct {
+	key   string // 窗口键
+	typ   string // 类型[requests:请求数, tokens:令牌数]
+	limit int    // 限制
+}
+
+// 速率限制, 按用户、应用和密钥依次校验并发请求数和每分钟请求数, 在鉴权通过后由中间件调用
+func (s *sRateLimit) Limit(ctx context.Context) error {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sRateLimit Limit time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	targets, rateLimits := s.targets(ctx)
+
+	windows := make([]*window, 0)
+
+	for i, target := range targets {
+
+		if err := s.acquire(ctx, target, rateLimits[i].Concurrency); err != nil {
+			return err
+		}
+
+		windows = append(windows, s.windows(target, rateLimits[i].Rpm, 0)...)
+	}
+
+	return s.check(ctx, windows, nil)
+}
+
+// 模型速率限制, 按用户、应用和密钥依次校验每分钟令牌数及按模型配置的并发请求数、每分钟请求数和每分钟令牌数, 令牌数仅在配置了每分钟令牌数时计算, 同一请求只校验一次
+func (s *sRateLimit) LimitModel(ctx context.Context, m *model.Model, tokens func() int) error {
+
+	if service.Session().GetIsRateLimitChecked(ctx) {
+		return nil
+	}
+
+	service.Session().SaveIsRateLimitChecked(ctx)
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sRateLimit LimitModel time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	targets, rateLimits := s.targets(ctx)
+
+	windows := make([]*window, 0)
+
+	for i, target := range targets {
+
+		rateLimit := rateLimits[i]
+
+		windows = append(windows, s.windows(target, 0, rateLimit.Tpm)...)
+
+		for _, modelRateLimit := range rateLimit.Models {
+			if modelRateLimit.Model == m.Id {
+
+				modelTarget := fmt.Sprintf("%s:model:%s", target, m.Id)
+
+				if err := s.acquire(ctx, modelTarget, modelRateLimit.Concurrency); err != nil {
+					return err
+				}
+
+				windows = append(windows, s.windows(modelTarget, modelRateLimit.Rpm, modelRateLimit.Tpm)...)
+			}
+		}
+	}
+
+	return s.check(ctx, windows, tokens)
+}
+
+// 会话中配置了速率限制的用户、应用和密钥
+func (s *sRateLimit) targets(ctx context.Context) ([]string, []*common.RateLimit) {
+
+	targets := make([]string, 0)
+	rateLimits := make([]*common.RateLimit, 0)
+
+	if user := service.Session().GetUser(ctx); user != nil && user.RateLimit != nil {
+		targets = append(targets, fmt.Sprintf("user:%d", user.UserId))
+		rateLimits = append(rateLimits, user.RateLimit)
+	}
+
+	if app := service.Session().GetApp(ctx); app != nil && app.RateLimit != nil {
+		targets = append(targets, fmt.Sprintf("app:%d", app.AppId))
+		rateLimits = append(rateLimits, app.RateLimit)
+	}
+
+	if key := service.Session().GetKey(ctx); key != nil && key.RateLimit != nil {
+		targets = append(targets, fmt.Sprintf("key:%s", key.Id))
+		rateLimits = append(rateLimits, key.RateLimit)
+	}
+
+	return targets, rateLimits
+}
+
+// 校验滑动窗口, 全部窗口均未超限时记录本次请求
+func (s *sRateLimit) check(ctx context.Context, windows []*window, tokens func() int) error {
+
+	if len(windows) == 0 {
+		return nil
+	}
+
+	totalTokens := 0
+	if tokens != nil && slices.ContainsFunc(windows, func(w *window) bool {
+		return w.typ == consts.RATE_LIMIT_TYPE_TOKENS
+	}) {
+		totalTokens = tokens()
+	}
+
+	keys := make([]string, 0)
+	args := []interface{}{gtime.TimestampMilli(), windowTime, gctx.CtxId(ctx), totalTokens}
+	for _, w := range windows {
+		keys = append(keys, w.key)
+		args = append(args, w.typ, w.limit)
+	}
+
+	reply, err := redis.Eval(ctx, slidingWindowScript, int64(len(keys)), keys, args)
+	if err != nil {
+		// 出错时不限制, 避免影响请求
+		logger.Error(ctx, err)
+		return nil
+	}
+
+	result := reply.Ints()
+	if len(result) < 2 {
+		logger.Errorf(ctx, "sRateLimit check invalid result: %v", result)
+		return nil
+	}
+
+	// 超限
+	if result[0] > 0 {
+
+		w := windows[result[0]-1]
+
+		s.setHeaders(ctx, w.typ, w.limit, 0)
+		s.setRetryAfter(ctx, gconv.String(math.Ceil(float64(result[1])/1000)))
+
+		logger.Errorf(ctx, "sRateLimit check key: %s, type: %s, limit: %d, retryAfter: %d", w.key, w.typ, w.limit, result[1])
+
+		if w.typ == consts.RATE_LIMIT_TYPE_TOKENS {
+			return errors.ERR_RATE_LIMIT_TOKENS
+		}
+
+		return errors.ERR_RATE_LIMIT_REQUESTS
+	}
+
+	// 返回剩余量最少的窗口
+	remaining := make(map[string]*window)
+	remainingValue := make(map[string]int)
+	for i, w := range windows {
+		if len(result) > i+2 {
+			if _, ok := remaining[w.typ]; !ok || result[i+2] < remainingValue[w.typ] {
+				remaining[w.typ] = w
+				remainingValue[w.typ] = result[i+2]
+			}
+		}
+	}
+
+	for typ, w := range remaining {
+		s.setHeaders(ctx, typ, w.limit, remainingValue[typ])
+	}
+
+	return nil
+}
+
+// 占用并发请求数
+func (s *sRateLimit) acquire(ctx context.Context, target string, concurrency int) error {
+
+	if concurrency <= 0 || service.Concurrency().Acquire(ctx, consts.CONCURRENCY_TYPE_RATE_LIMIT, target, concurrency) {
+		return nil
+	}
+
+	logger.Errorf(ctx, "sRateLimit acquire target: %s, concurrency: %d, exceeded", target, concurrency)
+
+	s.setRetryAfter(ctx, "1")
+
+	return errors.ERR_RATE_LIMIT_CONCURRENCY
+}
+
+// 每分钟请求数和每分钟令牌数窗口
+func (s *sRateLimit) windows(target string, rpm, tpm int) []*window {
+
+	windows := make([]*window, 0)
+
+	if rpm > 0 {
+		windows = append(windows, &window{
+			key:   fmt.Sprintf(consts.RATE_LIMIT_KEY, consts.RATE_LIMIT_TYPE_REQUESTS, target),
+			typ:   consts.RATE_LIMIT_TYPE_REQUESTS,
+			limit: rpm,
+		})
+	}
+
+	if tpm > 0 {
+		windows = append(windows, &window{
+			key:   fmt.Sprintf(consts.RATE_LIMIT_KEY, consts.RATE_LIMIT_TYPE_TOKENS, target),
+			typ:   consts.RATE_LIMIT_TYPE_TOKENS,
+			limit: tpm,
+		})
+	}
+
+	return windows
+}
+
+// 设置速率限制响应头
+func (s *sRateLimit) setHeaders(ctx context.Context, typ string, limit, remaining int) {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil || r.Response == nil {
+		return
+	}
+
+	r.Response.Header().Set("x-ratelimit-limit-"+typ, gconv.String(limit))
+	r.Response.Header().Set("x-ratelimit-remaining-"+typ, gconv.String(max(remaining, 0)))
+}
+
+// 设置重试等待时间响应头(秒)
+func (s *sRateLimit) setRetryAfter(ctx context.Context, retryAfter string) {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil || r.Response == nil {
+		return
+	}
+
+	r.Response.Header().Set("retry-after", retryAfter)
+}
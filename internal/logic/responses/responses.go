@@ -0,0 +1,584 @@
+package responses
+
+import (
+	"context"
+	"fmt"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gctx"
+	"github.com/gogf/gf/v2/os/gtime"
+	"github.com/gogf/gf/v2/util/gconv"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/dao"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/do"
+	"github.com/iimeta/fastapi/internal/model/entity"
+	"github.com/iimeta/fastapi/internal/service"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/util"
+	"github.com/iimeta/go-openai"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+)
+
+type sResponses struct{}
+
+func init() {
+	service.RegisterResponses(New())
+}
+
+func New() service.IResponses {
+	return &sResponses{}
+}
+
+// 创建响应
+func (s *sResponses) Create(ctx context.Context, params model.ResponsesReq) (*model.ResponsesRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sResponses Create time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	messages, inputMessages, err := s.getMessages(ctx, params)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	request, err := convToChatCompletionRequest(params, messages)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	response, err := service.Chat().Completions(ctx, request, nil, nil)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	res := newResponsesRes(params)
+	res.Model = response.Model
+
+	if len(response.Choices) > 0 && response.Choices[0].Message != nil {
+
+		message := response.Choices[0].Message
+
+		if content := gconv.String(message.Content); content != "" {
+			res.Output = append(res.Output, &model.ResponsesOutputItem{
+				Type:   "message",
+				Id:     consts.RESPONSE_MESSAGE_ID + util.GenerateId(),
+				Status: "completed",
+				Role:   consts.ROLE_ASSISTANT,
+				Content: []*model.ResponsesOutputContent{{
+					Type:        "output_text",
+					Text:        content,
+					Annotations: []interface{}{},
+				}},
+			})
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			res.Output = append(res.Output, &model.ResponsesOutputItem{
+				Type:      "function_call",
+				Id:        consts.RESPONSE_FUNCTION_ID + util.GenerateId(),
+				Status:    "completed",
+				CallId:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+
+		setStatus(res, string(response.Choices[0].FinishReason))
+
+	} else {
+		res.Status = "completed"
+	}
+
+	res.Usage = convToResponsesUsage(response.Usage)
+
+	s.save(ctx, params, res, append(inputMessages, convToMessage(res)))
+
+	return res, nil
+}
+
+// 创建响应流式
+func (s *sResponses) CreateStream(ctx context.Context, params model.ResponsesReq) error {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sResponses CreateStream time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	messages, inputMessages, err := s.getMessages(ctx, params)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	request, err := convToChatCompletionRequest(params, messages)
+	if err != nil {
+		logger.Error(ctx, err)
+		return err
+	}
+
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	converter := newStreamConverter(ctx, newResponsesRes(params))
+	g.RequestFromCtx(ctx).SetCtxVar(consts.SESSION_SSE_CONVERTER, util.SSEConverter(converter.convert))
+
+	if err = service.Chat().CompletionsStream(ctx, request, nil, nil); err != nil {
+
+		logger.Error(ctx, err)
+
+		// 尚未输出内容时直接返回错误, 已输出时以response.failed事件结束
+		if !util.IsSSEFlushed(ctx) {
+			return err
+		}
+
+		converter.fail(err)
+	}
+
+	s.save(ctx, params, converter.res, append(inputMessages, convToMessage(converter.res)))
+
+	return nil
+}
+
+// 获取响应
+func (s *sResponses) Retrieve(ctx context.Context, responseId string) (*model.ResponsesRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sResponses Retrieve time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	response, err := s.getResponse(ctx, responseId)
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	res := new(model.ResponsesRes)
+	if err = gjson.Unmarshal([]byte(response.Response), &res); err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// 删除响应
+func (s *sResponses) Delete(ctx context.Context, responseId string) (*model.ResponsesDeleteRes, error) {
+
+	now := gtime.TimestampMilli()
+	defer func() {
+		logger.Debugf(ctx, "sResponses Delete time: %d", gtime.TimestampMilli()-now)
+	}()
+
+	deletedCount, err := dao.Response.DeleteOne(ctx, bson.M{"response_id": responseId, "user_id": service.Session().GetUserId(ctx)})
+	if err != nil {
+		logger.Error(ctx, err)
+		return nil, err
+	}
+
+	if deletedCount == 0 {
+		return nil, errors.ERR_RESPONSE_NOT_FOUND
+	}
+
+	return &model.ResponsesDeleteRes{
+		Id:      responseId,
+		Object:  consts.RESPONSE_DELETE_OBJECT,
+		Deleted: true,
+	}, nil
+}
+
+// 获取当前用户的响应记录
+func (s *sResponses) getResponse(ctx context.Context, responseId string) (*entity.Response, error) {
+
+	response, err := dao.Response.FindOne(ctx, bson.M{"response_id": responseId, "user_id": service.Session().GetUserId(ctx)})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.ERR_RESPONSE_NOT_FOUND
+		}
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// 获取对话消息和本轮输入消息, 存在previous_response_id时沿响应链拼接历史对话
+func (s *sResponses) getMessages(ctx context.Context, params model.ResponsesReq) (messages, inputMessages []sdkm.ChatCompletionMessage, err error) {
+
+	if inputMessages, err = convToMessages(ctx, params.Input); err != nil {
+		return nil, nil, err
+	}
+
+	if len(inputMessages) == 0 {
+		return nil, nil, errors.ERR_INVALID_PARAMETER
+	}
+
+	// 每个响应只保存本轮对话消息, 从上一个响应开始逐个向前查找
+	turns := make([][]sdkm.ChatCompletionMessage, 0)
+	for responseId := params.PreviousResponseId; responseId != ""; {
+
+		response, err := s.getResponse(ctx, responseId)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		turn := make([]sdkm.ChatCompletionMessage, 0)
+		if err = gjson.Unmarshal([]byte(response.TurnMessages), &turn); err != nil {
+			return nil, nil, err
+		}
+
+		turns = append(turns, turn)
+		responseId = response.PreviousResponseId
+	}
+
+	messages = make([]sdkm.ChatCompletionMessage, 0)
+	for i := len(turns) - 1; i >= 0; i-- {
+		messages = append(messages, turns[i]...)
+	}
+
+	return append(messages, inputMessages...), inputMessages, nil
+}
+
+// 保存响应和本轮对话消息, 用于获取响应和previous_response_id续接
+func (s *sResponses) save(ctx context.Context, params model.ResponsesReq, res *model.ResponsesRes, turnMessages []sdkm.ChatCompletionMessage) {
+
+	if !res.Store {
+		return
+	}
+
+	if _, err := dao.Response.Insert(ctx, &do.Response{
+		ResponseId:         res.Id,
+		PreviousResponseId: params.PreviousResponseId,
+		TraceId:            gctx.CtxId(ctx),
+		UserId:             service.Session().GetUserId(ctx),
+		AppId:              service.Session().GetAppId(ctx),
+		Model:              res.Model,
+		TurnMessages:       gjson.MustEncodeString(turnMessages),
+		Response:           gjson.MustEncodeString(res),
+		Status:             res.Status,
+	}); err != nil {
+		logger.Error(ctx, err)
+	}
+}
+
+// 初始化响应对象, 回显请求参数
+func newResponsesRes(params model.ResponsesReq) *model.ResponsesRes {
+
+	res := &model.ResponsesRes{
+		Id:                 consts.RESPONSE_ID_PREFIX + util.GenerateId(),
+		Object:             consts.RESPONSE_OBJECT,
+		CreatedAt:          gtime.Timestamp(),
+		Status:             "in_progress",
+		Instructions:       params.Instructions,
+		MaxOutputTokens:    params.MaxOutputTokens,
+		Model:              params.Model,
+		Output:             make([]*model.ResponsesOutputItem, 0),
+		ParallelToolCalls:  params.ParallelToolCalls,
+		PreviousResponseId: params.PreviousResponseId,
+		Reasoning:          params.Reasoning,
+		Store:              params.Store == nil || *params.Store,
+		Temperature:        params.Temperature,
+		Text:               params.Text,
+		ToolChoice:         params.ToolChoice,
+		Tools:              params.Tools,
+		TopP:               params.TopP,
+		User:               params.User,
+		Metadata:           params.Metadata,
+	}
+
+	if res.Tools == nil {
+		res.Tools = make([]map[string]interface{}, 0)
+	}
+
+	return res
+}
+
+// 按结束原因设置响应状态
+func setStatus(res *model.ResponsesRes, finishReason string) {
+	switch finishReason {
+	case string(openai.FinishReasonLength):
+		res.Status = "incomplete"
+		res.IncompleteDetails = &model.ResponsesIncompleteDetails{Reason: "max_output_tokens"}
+	case string(openai.FinishReasonContentFilter):
+		res.Status = "incomplete"
+		res.IncompleteDetails = &model.ResponsesIncompleteDetails{Reason: "content_filter"}
+	default:
+		res.Status = "completed"
+	}
+}
+
+// 转换成Chat Completions请求, instructions作为系统消息仅在本次请求中生效, 仅支持函数工具
+func convToChatCompletionRequest(params model.ResponsesReq, messages []sdkm.ChatCompletionMessage) (sdkm.ChatCompletionRequest, error) {
+
+	request := sdkm.ChatCompletionRequest{
+		Model:               params.Model,
+		Messages:            messages,
+		MaxCompletionTokens: params.MaxOutputTokens,
+		Temperature:         params.Temperature,
+		TopP:                params.TopP,
+		ParallelToolCalls:   params.ParallelToolCalls,
+		User:                params.User,
+		Metadata:            params.Metadata,
+	}
+
+	if params.Instructions != "" {
+		request.Messages = append([]sdkm.ChatCompletionMessage{{
+			Role:    consts.ROLE_SYSTEM,
+			Content: params.Instructions,
+		}}, messages...)
+	}
+
+	tools := make([]g.Map, 0)
+	for _, tool := range params.Tools {
+		// 内置工具(web_search、file_search等)无法转换成对话接口, 直接返回不支持, 避免静默忽略
+		if typ := gconv.String(tool["type"]); typ != "function" {
+			return request, errors.NewError(400, "unsupported_parameter", fmt.Sprintf("Unsupported tool type: %s.", typ), "fastapi_request_error")
+		}
+		function := g.Map{
+			"name":       tool["name"],
+			"parameters": tool["parameters"],
+		}
+		if tool["description"] != nil {
+			function["description"] = tool["description"]
+		}
+		if tool["strict"] != nil {
+			function["strict"] = tool["strict"]
+		}
+		tools = append(tools, g.Map{
+			"type":     "function",
+			"function": function,
+		})
+	}
+
+	if len(tools) > 0 {
+		request.Tools = tools
+	}
+
+	switch toolChoice := params.ToolChoice.(type) {
+	case string:
+		request.ToolChoice = toolChoice
+	case map[string]interface{}:
+		if gconv.String(toolChoice["type"]) == "function" {
+			request.ToolChoice = g.Map{
+				"type": "function",
+				"function": g.Map{
+					"name": toolChoice["name"],
+				},
+			}
+		}
+	}
+
+	if params.Text != nil && params.Text.Format != nil {
+		switch params.Text.Format.Type {
+		case "json_schema":
+			request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+				JSONSchema: g.Map{
+					"name":        params.Text.Format.Name,
+					"description": params.Text.Format.Description,
+					"schema":      params.Text.Format.Schema,
+					"strict":      params.Text.Format.Strict,
+				},
+			}
+		case "json_object":
+			request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+				Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+			}
+		}
+	}
+
+	if params.Reasoning != nil {
+		request.ReasoningEffort = params.Reasoning.Effort
+	}
+
+	return request, nil
+}
+
+// 转换输入内容为对话消息, 不支持的输入项(reasoning等)返回不支持
+func convToMessages(ctx context.Context, input any) ([]sdkm.ChatCompletionMessage, error) {
+
+	messages := make([]sdkm.ChatCompletionMessage, 0)
+
+	switch input := input.(type) {
+	case string:
+		messages = append(messages, sdkm.ChatCompletionMessage{
+			Role:    consts.ROLE_USER,
+			Content: input,
+		})
+	case []interface{}:
+		for _, value := range input {
+
+			item, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			switch gconv.String(item["type"]) {
+			case "", "message":
+
+				role := gconv.String(item["role"])
+				if role == "developer" {
+					role = consts.ROLE_SYSTEM
+				}
+
+				messages = append(messages, sdkm.ChatCompletionMessage{
+					Role:    role,
+					Content: convToContent(ctx, role, item["content"]),
+				})
+
+			case "function_call":
+
+				toolCall := openai.ToolCall{
+					ID:   gconv.String(item["call_id"]),
+					Type: openai.ToolTypeFunction,
+					Function: openai.FunctionCall{
+						Name:      gconv.String(item["name"]),
+						Arguments: gconv.String(item["arguments"]),
+					},
+				}
+
+				// 连续的函数调用合并到同一条助手消息中
+				if len(messages) > 0 && messages[len(messages)-1].Role == consts.ROLE_ASSISTANT {
+					messages[len(messages)-1].ToolCalls = append(messages[len(messages)-1].ToolCalls, toolCall)
+				} else {
+					messages = append(messages, sdkm.ChatCompletionMessage{
+						Role:      consts.ROLE_ASSISTANT,
+						ToolCalls: []openai.ToolCall{toolCall},
+					})
+				}
+
+			case "function_call_output":
+				messages = append(messages, sdkm.ChatCompletionMessage{
+					Role:       consts.ROLE_TOOL,
+					Content:    gconv.String(item["output"]),
+					ToolCallID: gconv.String(item["call_id"]),
+				})
+			default:
+				return nil, errors.NewError(400, "unsupported_parameter", fmt.Sprintf("Unsupported input item type: %s.", item["type"]), "fastapi_request_error")
+			}
+		}
+	default:
+		return nil, errors.ERR_INVALID_PARAMETER
+	}
+
+	return messages, nil
+}
+
+// 转换消息内容, 助手消息合并为文本
+func convToContent(ctx context.Context, role string, content any) any {
+
+	parts, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+
+	texts := make([]string, 0)
+	contents := make([]interface{}, 0)
+
+	for _, value := range parts {
+
+		part, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch gconv.String(part["type"]) {
+		case "input_text", "output_text", "text":
+			texts = append(texts, gconv.String(part["text"]))
+			contents = append(contents, g.Map{
+				"type": "text",
+				"text": part["text"],
+			})
+		case "input_image":
+			imageUrl := g.Map{
+				"url": part["image_url"],
+			}
+			if part["detail"] != nil {
+				imageUrl["detail"] = part["detail"]
+			}
+			contents = append(contents, g.Map{
+				"type":      "image_url",
+				"image_url": imageUrl,
+			})
+		default:
+			logger.Infof(ctx, "convToContent unsupported content type: %s", part["type"])
+		}
+	}
+
+	if role == consts.ROLE_ASSISTANT {
+		return strings.Join(texts, "")
+	}
+
+	return contents
+}
+
+// 转换输出内容为助手消息
+func convToMessage(res *model.ResponsesRes) sdkm.ChatCompletionMessage {
+
+	message := sdkm.ChatCompletionMessage{
+		Role: consts.ROLE_ASSISTANT,
+	}
+
+	content := ""
+	for _, item := range res.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				content += part.Text
+			}
+		case "function_call":
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   item.CallId,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			})
+		}
+	}
+
+	if content != "" {
+		message.Content = content
+	}
+
+	return message
+}
+
+// 转换用量
+func convToResponsesUsage(usage *sdkm.Usage) *model.ResponsesUsage {
+
+	if usage == nil {
+		return nil
+	}
+
+	responsesUsage := &model.ResponsesUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.TotalTokens,
+	}
+
+	if usage.PromptTokensDetails != nil {
+		responsesUsage.InputTokensDetails.CachedTokens = usage.PromptTokensDetails.CachedTokens
+	} else {
+		responsesUsage.InputTokensDetails.CachedTokens = usage.CacheReadInputTokens
+	}
+
+	if usage.CompletionTokensDetails != nil {
+		responsesUsage.OutputTokensDetails.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+
+	if responsesUsage.TotalTokens == 0 {
+		responsesUsage.TotalTokens = responsesUsage.InputTokens + responsesUsage.OutputTokens
+	}
+
+	return responsesUsage
+}
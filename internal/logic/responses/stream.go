@@ -0,0 +1,265 @@
+package responses
+
+import (
+	"context"
+	"github.com/gogf/gf/v2/encoding/gjson"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	sdkm "github.com/iimeta/fastapi-sdk/model"
+	"github.com/iimeta/fastapi/internal/consts"
+	"github.com/iimeta/fastapi/internal/errors"
+	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/utility/logger"
+	"github.com/iimeta/fastapi/utility/util"
+)
+
+// 流式转换器, 将Chat Completions流式数据转换成Responses事件
+type streamConverter struct {
+	ctx            context.Context
+	res            *model.ResponsesRes
+	sequenceNumber int
+	isCreated      bool
+	isDone         bool
+	message        *model.ResponsesOutputItem
+	toolCalls      map[int]*model.ResponsesOutputItem
+	finishReason   string
+	usage          *sdkm.Usage
+}
+
+func newStreamConverter(ctx context.Context, res *model.ResponsesRes) *streamConverter {
+	return &streamConverter{
+		ctx:       ctx,
+		res:       res,
+		toolCalls: make(map[int]*model.ResponsesOutputItem),
+	}
+}
+
+// 转换流式数据
+func (c *streamConverter) convert(data string) ([]*util.SSEEvent, error) {
+
+	if c.isDone {
+		return nil, nil
+	}
+
+	events := make([]*util.SSEEvent, 0)
+
+	if !c.isCreated {
+		c.isCreated = true
+		events = append(events, c.event("response.created", g.Map{"response": c.res}))
+		events = append(events, c.event("response.in_progress", g.Map{"response": c.res}))
+	}
+
+	if data == "[DONE]" {
+		return append(events, c.done()...), nil
+	}
+
+	response := sdkm.ChatCompletionResponse{}
+	if err := gjson.Unmarshal([]byte(data), &response); err != nil {
+		logger.Error(c.ctx, err)
+		return nil, err
+	}
+
+	if response.Model != "" {
+		c.res.Model = response.Model
+	}
+
+	if response.Usage != nil {
+		c.usage = response.Usage
+	}
+
+	if len(response.Choices) == 0 || response.Choices[0].Index != 0 {
+		return events, nil
+	}
+
+	choice := response.Choices[0]
+
+	if choice.FinishReason != "" {
+		c.finishReason = string(choice.FinishReason)
+	}
+
+	if choice.Delta == nil {
+		return events, nil
+	}
+
+	if choice.Delta.Content != "" {
+
+		if c.message == nil {
+
+			c.message = &model.ResponsesOutputItem{
+				Type:    "message",
+				Id:      consts.RESPONSE_MESSAGE_ID + util.GenerateId(),
+				Status:  "in_progress",
+				Role:    consts.ROLE_ASSISTANT,
+				Content: make([]*model.ResponsesOutputContent, 0),
+			}
+			c.res.Output = append(c.res.Output, c.message)
+
+			events = append(events, c.event("response.output_item.added", g.Map{
+				"output_index": c.outputIndex(c.message),
+				"item":         c.message,
+			}))
+
+			part := &model.ResponsesOutputContent{
+				Type:        "output_text",
+				Annotations: []interface{}{},
+			}
+			c.message.Content = append(c.message.Content, part)
+
+			events = append(events, c.event("response.content_part.added", g.Map{
+				"item_id":       c.message.Id,
+				"output_index":  c.outputIndex(c.message),
+				"content_index": 0,
+				"part":          part,
+			}))
+		}
+
+		c.message.Content[0].Text += choice.Delta.Content
+
+		events = append(events, c.event("response.output_text.delta", g.Map{
+			"item_id":       c.message.Id,
+			"output_index":  c.outputIndex(c.message),
+			"content_index": 0,
+			"delta":         choice.Delta.Content,
+		}))
+	}
+
+	for _, toolCall := range choice.Delta.ToolCalls {
+
+		index := 0
+		if toolCall.Index != nil {
+			index = *toolCall.Index
+		}
+
+		item, ok := c.toolCalls[index]
+		if !ok {
+
+			item = &model.ResponsesOutputItem{
+				Type:   "function_call",
+				Id:     consts.RESPONSE_FUNCTION_ID + util.GenerateId(),
+				Status: "in_progress",
+				CallId: toolCall.ID,
+				Name:   toolCall.Function.Name,
+			}
+			c.toolCalls[index] = item
+			c.res.Output = append(c.res.Output, item)
+
+			events = append(events, c.event("response.output_item.added", g.Map{
+				"output_index": c.outputIndex(item),
+				"item":         item,
+			}))
+		}
+
+		if toolCall.Function.Arguments != "" {
+
+			item.Arguments += toolCall.Function.Arguments
+
+			events = append(events, c.event("response.function_call_arguments.delta", g.Map{
+				"item_id":      item.Id,
+				"output_index": c.outputIndex(item),
+				"delta":        toolCall.Function.Arguments,
+			}))
+		}
+	}
+
+	return events, nil
+}
+
+// 结束输出项并完成响应
+func (c *streamConverter) done() []*util.SSEEvent {
+
+	c.isDone = true
+
+	events := make([]*util.SSEEvent, 0)
+
+	for _, item := range c.res.Output {
+
+		item.Status = "completed"
+
+		if item.Type == "message" {
+
+			events = append(events, c.event("response.output_text.done", g.Map{
+				"item_id":       item.Id,
+				"output_index":  c.outputIndex(item),
+				"content_index": 0,
+				"text":          item.Content[0].Text,
+			}))
+
+			events = append(events, c.event("response.content_part.done", g.Map{
+				"item_id":       item.Id,
+				"output_index":  c.outputIndex(item),
+				"content_index": 0,
+				"part":          item.Content[0],
+			}))
+
+		} else {
+			events = append(events, c.event("response.function_call_arguments.done", g.Map{
+				"item_id":      item.Id,
+				"output_index": c.outputIndex(item),
+				"arguments":    item.Arguments,
+			}))
+		}
+
+		events = append(events, c.event("response.output_item.done", g.Map{
+			"output_index": c.outputIndex(item),
+			"item":         item,
+		}))
+	}
+
+	setStatus(c.res, c.finishReason)
+	c.res.Usage = convToResponsesUsage(c.usage)
+
+	if c.res.Status == "incomplete" {
+		return append(events, c.event("response.incomplete", g.Map{"response": c.res}))
+	}
+
+	return append(events, c.event("response.completed", g.Map{"response": c.res}))
+}
+
+// 输出失败事件
+func (c *streamConverter) fail(err error) {
+
+	if c.isDone {
+		return
+	}
+
+	c.isDone = true
+
+	fastApiError := errors.Error(c.ctx, err)
+
+	c.res.Status = "failed"
+	c.res.Error = &model.ResponsesError{
+		Code:    gconv.String(fastApiError.ErrCode()),
+		Message: fastApiError.ErrMessage(),
+	}
+	c.res.Usage = convToResponsesUsage(c.usage)
+
+	event := c.event("response.failed", g.Map{"response": c.res})
+	if err := util.SSEEventServer(c.ctx, event.Event, event.Data); err != nil {
+		logger.Error(c.ctx, err)
+	}
+}
+
+// 生成事件, 附带递增的序号
+func (c *streamConverter) event(typ string, data g.Map) *util.SSEEvent {
+
+	data["type"] = typ
+	data["sequence_number"] = c.sequenceNumber
+	c.sequenceNumber++
+
+	return &util.SSEEvent{
+		Event: typ,
+		Data:  gjson.MustEncodeString(data),
+	}
+}
+
+// 输出项下标
+func (c *streamConverter) outputIndex(item *model.ResponsesOutputItem) int {
+
+	for i, output := range c.res.Output {
+		if output == item {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -6,8 +6,11 @@ import (
 	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
 	"github.com/iimeta/fastapi/internal/service"
 	"github.com/iimeta/fastapi/utility/logger"
+	"slices"
+	"sync/atomic"
 )
 
 type sSession struct{}
@@ -37,6 +40,7 @@ func (s *sSession) Save(ctx context.Context, secretKey string) error {
 		r.SetCtxVar(consts.USER_ID_KEY, userId)
 		r.SetCtxVar(consts.APP_ID_KEY, appId)
 		r.SetCtxVar(consts.SECRET_KEY, secretKey)
+		r.SetCtxVar(consts.SESSION_BILLING_SEQ, new(atomic.Int64))
 	}
 
 	return nil
@@ -185,7 +189,7 @@ func (s *sSession) GetErrorModelAgents(ctx context.Context) []string {
 // 记录错误密钥ID到会话中
 func (s *sSession) RecordErrorKey(ctx context.Context, id string) {
 	if r := g.RequestFromCtx(ctx); r != nil {
-		r.SetCtxVar(consts.SESSION_ERROR_KEYS, append(s.GetErrorModelAgents(ctx), id))
+		r.SetCtxVar(consts.SESSION_ERROR_KEYS, append(s.GetErrorKeys(ctx), id))
 	}
 }
 
@@ -199,3 +203,174 @@ func (s *sSession) GetErrorKeys(ctx context.Context) []string {
 
 	return keys.([]string)
 }
+
+// 记录后备步骤到会话中
+func (s *sSession) RecordFallback(ctx context.Context, step *common.FallbackStep) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_FALLBACKS, append(s.GetFallbacks(ctx), step))
+	}
+}
+
+// 获取会话中的后备路径, 从请求中读取以获取最新的会话
+func (s *sSession) GetFallbacks(ctx context.Context) []*common.FallbackStep {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return []*common.FallbackStep{}
+	}
+
+	fallbacks := r.GetCtxVar(consts.SESSION_FALLBACKS).Val()
+	if fallbacks == nil {
+		return []*common.FallbackStep{}
+	}
+
+	return fallbacks.([]*common.FallbackStep)
+}
+
+// 记录并发租约到会话中
+func (s *sSession) RecordConcurrencyLease(ctx context.Context, lease *model.ConcurrencyLease) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_CONCURRENCY_LEASES, append(s.GetConcurrencyLeases(ctx), lease))
+	}
+}
+
+// 移除会话中的并发租约
+func (s *sSession) RemoveConcurrencyLease(ctx context.Context, typ, id string) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_CONCURRENCY_LEASES, slices.DeleteFunc(slices.Clone(s.GetConcurrencyLeases(ctx)), func(lease *model.ConcurrencyLease) bool {
+			return lease.Type == typ && lease.Id == id
+		}))
+	}
+}
+
+// 获取会话中的并发租约, 从请求中读取以获取最新的会话
+func (s *sSession) GetConcurrencyLeases(ctx context.Context) []*model.ConcurrencyLease {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return []*model.ConcurrencyLease{}
+	}
+
+	leases := r.GetCtxVar(consts.SESSION_CONCURRENCY_LEASES).Val()
+	if leases == nil {
+		return []*model.ConcurrencyLease{}
+	}
+
+	return leases.([]*model.ConcurrencyLease)
+}
+
+// 保存额度预占到会话中
+func (s *sSession) SaveQuotaReservation(ctx context.Context, reservation *model.QuotaReservation) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_QUOTA_RESERVATION, reservation)
+	}
+}
+
+// 获取会话中的额度预占, 从请求中读取以获取最新的会话
+func (s *sSession) GetQuotaReservation(ctx context.Context) *model.QuotaReservation {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return nil
+	}
+
+	reservation := r.GetCtxVar(consts.SESSION_QUOTA_RESERVATION).Val()
+	if reservation == nil {
+		return nil
+	}
+
+	return reservation.(*model.QuotaReservation)
+}
+
+// 保存已校验速率限制到会话中
+func (s *sSession) SaveIsRateLimitChecked(ctx context.Context) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_IS_RATE_LIMIT_CHECKED, true)
+	}
+}
+
+// 获取会话中是否已校验速率限制, 从请求中读取以获取最新的会话
+func (s *sSession) GetIsRateLimitChecked(ctx context.Context) bool {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return false
+	}
+
+	return r.GetCtxVar(consts.SESSION_IS_RATE_LIMIT_CHECKED).Bool()
+}
+
+// 累加流式续写前已输出的补全令牌数到会话中
+func (s *sSession) AddResumeTokens(ctx context.Context, tokens int) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_RESUME_TOKENS, s.GetResumeTokens(ctx)+tokens)
+	}
+}
+
+// 获取会话中流式续写前已输出的补全令牌数, 从请求中读取以获取最新的会话
+func (s *sSession) GetResumeTokens(ctx context.Context) int {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return 0
+	}
+
+	return r.GetCtxVar(consts.SESSION_RESUME_TOKENS).Int()
+}
+
+// 获取会话中的下一个计费序号, 同一请求多次计费时递增
+func (s *sSession) NextBillingSeq(ctx context.Context) int64 {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return 1
+	}
+
+	seq := r.GetCtxVar(consts.SESSION_BILLING_SEQ).Val()
+	if seq == nil {
+		return 1
+	}
+
+	return seq.(*atomic.Int64).Add(1)
+}
+
+// 保存超过的软限制到会话中
+func (s *sSession) SaveSoftLimit(ctx context.Context, softLimit *common.SoftLimit) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_SOFT_LIMIT, softLimit)
+	}
+}
+
+// 获取会话中超过的软限制, 从请求中读取以获取最新的会话
+func (s *sSession) GetSoftLimit(ctx context.Context) *common.SoftLimit {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return nil
+	}
+
+	softLimit := r.GetCtxVar(consts.SESSION_SOFT_LIMIT).Val()
+	if softLimit == nil {
+		return nil
+	}
+
+	return softLimit.(*common.SoftLimit)
+}
+
+// 保存模型额度上限的已用额度字段到会话中
+func (s *sSession) SaveModelQuotaFields(ctx context.Context, fields []string) {
+	if r := g.RequestFromCtx(ctx); r != nil {
+		r.SetCtxVar(consts.SESSION_MODEL_QUOTA_FIELDS, fields)
+	}
+}
+
+// 获取会话中模型额度上限的已用额度字段, 从请求中读取以获取最新的会话
+func (s *sSession) GetModelQuotaFields(ctx context.Context) []string {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return nil
+	}
+
+	return r.GetCtxVar(consts.SESSION_MODEL_QUOTA_FIELDS).Strings()
+}
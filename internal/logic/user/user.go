@@ -57,6 +57,8 @@ func (s *sUser) GetUser(ctx context.Context, userId int) (*model.User, error) {
 		Quota:          user.Quota,
 		UsedQuota:      user.UsedQuota,
 		QuotaExpiresAt: user.QuotaExpiresAt,
+		SoftLimit:      user.SoftLimit,
+		RateLimit:      user.RateLimit,
 		Models:         user.Models,
 		Status:         user.Status,
 	}, nil
@@ -90,6 +92,8 @@ func (s *sUser) List(ctx context.Context) ([]*model.User, error) {
 			Quota:          result.Quota,
 			UsedQuota:      result.UsedQuota,
 			QuotaExpiresAt: result.QuotaExpiresAt,
+			SoftLimit:      result.SoftLimit,
+			RateLimit:      result.RateLimit,
 			Models:         result.Models,
 			Status:         result.Status,
 		})
@@ -217,6 +221,8 @@ func (s *sUser) UpdateCacheUser(ctx context.Context, user *entity.User) {
 		Quota:          user.Quota,
 		UsedQuota:      user.UsedQuota,
 		QuotaExpiresAt: user.QuotaExpiresAt,
+		SoftLimit:      user.SoftLimit,
+		RateLimit:      user.RateLimit,
 		Models:         user.Models,
 		Status:         user.Status,
 	}); err != nil {
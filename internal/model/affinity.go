@@ -0,0 +1,6 @@
+package model
+
+type Affinity struct {
+	Key string `json:"key,omitempty"` // 亲和键, 消息前缀或用户标识的摘要
+	Ttl int64  `json:"ttl,omitempty"` // 绑定有效期(秒)
+}
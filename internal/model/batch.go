@@ -0,0 +1,82 @@
+package model
+
+import "github.com/iimeta/fastapi/internal/model/common"
+
+// 创建批处理接口请求参数
+type BatchCreateReq struct {
+	InputFileId      string            `json:"input_file_id" v:"required"`
+	Endpoint         string            `json:"endpoint" v:"required"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// 批处理列表接口请求参数
+type BatchListReq struct {
+	After string `json:"after"`
+	Limit int    `json:"limit"`
+}
+
+// 批处理对象
+type BatchRes struct {
+	Id               string                     `json:"id"`
+	Object           string                     `json:"object"`
+	Endpoint         string                     `json:"endpoint"`
+	Errors           *BatchErrors               `json:"errors"`
+	InputFileId      string                     `json:"input_file_id"`
+	CompletionWindow string                     `json:"completion_window"`
+	Status           string                     `json:"status"`
+	OutputFileId     string                     `json:"output_file_id,omitempty"`
+	ErrorFileId      string                     `json:"error_file_id,omitempty"`
+	CreatedAt        int64                      `json:"created_at"`
+	InProgressAt     int64                      `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64                      `json:"expires_at,omitempty"`
+	FinalizingAt     int64                      `json:"finalizing_at,omitempty"`
+	CompletedAt      int64                      `json:"completed_at,omitempty"`
+	FailedAt         int64                      `json:"failed_at,omitempty"`
+	ExpiredAt        int64                      `json:"expired_at,omitempty"`
+	CancellingAt     int64                      `json:"cancelling_at,omitempty"`
+	CancelledAt      int64                      `json:"cancelled_at,omitempty"`
+	RequestCounts    *common.BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string          `json:"metadata,omitempty"`
+}
+
+type BatchErrors struct {
+	Object string               `json:"object"`
+	Data   []*common.BatchError `json:"data"`
+}
+
+// 批处理列表
+type BatchListRes struct {
+	Object  string      `json:"object"`
+	Data    []*BatchRes `json:"data"`
+	FirstId string      `json:"first_id,omitempty"`
+	LastId  string      `json:"last_id,omitempty"`
+	HasMore bool        `json:"has_more"`
+}
+
+// 批处理输入文件的单行请求
+type BatchRequestInput struct {
+	CustomId string                 `json:"custom_id"`
+	Method   string                 `json:"method"`
+	Url      string                 `json:"url"`
+	Body     map[string]interface{} `json:"body"`
+}
+
+// 批处理输出文件和错误文件的单行结果
+type BatchRequestOutput struct {
+	Id       string              `json:"id"`
+	CustomId string              `json:"custom_id"`
+	Response *BatchResponse      `json:"response"`
+	Error    *BatchResponseError `json:"error"`
+}
+
+type BatchResponse struct {
+	StatusCode int    `json:"status_code"`
+	RequestId  string `json:"request_id"`
+	Body       any    `json:"body"`
+}
+
+type BatchResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
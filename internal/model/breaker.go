@@ -0,0 +1,9 @@
+package model
+
+type Breaker struct {
+	Type      string `json:"type,omitempty"`       // 类型[model_key:模型密钥, model_agent:模型代理, model_agent_key:模型代理密钥]
+	Id        string `json:"id,omitempty"`         // 模型密钥ID/模型代理ID
+	FromState string `json:"from_state,omitempty"` // 原状态[closed:关闭, open:打开, half_open:半开]
+	State     string `json:"state,omitempty"`      // 当前状态[closed:关闭, open:打开, half_open:半开]
+	OpenedAt  int64  `json:"opened_at,omitempty"`  // 状态变更时间
+}
@@ -22,4 +22,5 @@ type CompletionsRes struct {
 	TotalTime    int64      `json:"-"`
 	InternalTime int64      `json:"-"`
 	EnterTime    int64      `json:"-"`
+	IsHedge      bool       `json:"-"`
 }
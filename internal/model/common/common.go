@@ -8,25 +8,48 @@ type PresetConfig struct {
 }
 
 type TextQuota struct {
-	BillingMethod   int     `bson:"billing_method,omitempty"   json:"billing_method,omitempty"`         // 计费方式[1:倍率, 2:固定额度]
-	PromptRatio     float64 `bson:"prompt_ratio,omitempty"     json:"prompt_ratio,omitempty"     d:"1"` // 提示倍率(提问倍率)
-	CompletionRatio float64 `bson:"completion_ratio,omitempty" json:"completion_ratio,omitempty" d:"1"` // 补全倍率(回答倍率)
-	FixedQuota      int     `bson:"fixed_quota,omitempty"      json:"fixed_quota,omitempty"`            // 固定额度
+	BillingMethod   int             `bson:"billing_method,omitempty"    json:"billing_method,omitempty"`          // 计费方式[1:倍率, 2:固定额度]
+	PromptRatio     float64         `bson:"prompt_ratio,omitempty"      json:"prompt_ratio,omitempty"      d:"1"` // 提示倍率(提问倍率)
+	CompletionRatio float64         `bson:"completion_ratio,omitempty"  json:"completion_ratio,omitempty"  d:"1"` // 补全倍率(回答倍率)
+	CacheWriteRatio float64         `bson:"cache_write_ratio,omitempty" json:"cache_write_ratio,omitempty"`       // 缓存写入倍率, 为0时按提示倍率的1.25倍计算
+	CacheReadRatio  float64         `bson:"cache_read_ratio,omitempty"  json:"cache_read_ratio,omitempty"`        // 缓存读取倍率, 为0时按提示倍率的0.1倍计算
+	ReasoningRatio  float64         `bson:"reasoning_ratio,omitempty"   json:"reasoning_ratio,omitempty"`         // 推理倍率, 为0时按补全倍率计算
+	PriceTiers      []*PriceTier    `bson:"price_tiers,omitempty"       json:"price_tiers,omitempty"`             // 阶梯价格, 按提示令牌数选择倍率
+	RequestQuota    int             `bson:"request_quota,omitempty"     json:"request_quota,omitempty"`           // 每次请求附加额度
+	TimeDiscounts   []*TimeDiscount `bson:"time_discounts,omitempty"    json:"time_discounts,omitempty"`          // 分时折扣
+	FixedQuota      int             `bson:"fixed_quota,omitempty"       json:"fixed_quota,omitempty"`             // 固定额度
+}
+
+type PriceTier struct {
+	Threshold       int     `bson:"threshold,omitempty"         json:"threshold,omitempty"`         // 提示令牌数阈值, 超过时按该档位倍率计费
+	PromptRatio     float64 `bson:"prompt_ratio,omitempty"      json:"prompt_ratio,omitempty"`      // 提示倍率, 为0时沿用基础倍率
+	CompletionRatio float64 `bson:"completion_ratio,omitempty"  json:"completion_ratio,omitempty"`  // 补全倍率, 为0时沿用基础倍率
+	CacheWriteRatio float64 `bson:"cache_write_ratio,omitempty" json:"cache_write_ratio,omitempty"` // 缓存写入倍率, 为0时沿用基础倍率
+	CacheReadRatio  float64 `bson:"cache_read_ratio,omitempty"  json:"cache_read_ratio,omitempty"`  // 缓存读取倍率, 为0时沿用基础倍率
+}
+
+type TimeDiscount struct {
+	StartTime string  `bson:"start_time,omitempty" json:"start_time,omitempty"` // 开始时间, 格式HH:mm
+	EndTime   string  `bson:"end_time,omitempty"   json:"end_time,omitempty"`   // 结束时间, 格式HH:mm, 早于开始时间时表示跨天
+	TimeZone  string  `bson:"time_zone,omitempty"  json:"time_zone,omitempty"`  // 时区, 为空时使用服务器时区
+	Discount  float64 `bson:"discount,omitempty"   json:"discount,omitempty"`   // 折扣, 如0.5表示按五折计费
 }
 
 type ImageQuota struct {
-	Width      int    `bson:"width,omitempty"       json:"width,omitempty"`       // 宽度
-	Height     int    `bson:"height,omitempty"      json:"height,omitempty"`      // 高度
-	Mode       string `bson:"mode,omitempty"        json:"mode,omitempty"`        // 模式[low, high, auto]
-	FixedQuota int    `bson:"fixed_quota,omitempty" json:"fixed_quota,omitempty"` // 固定额度
-	IsDefault  bool   `bson:"is_default,omitempty"  json:"is_default,omitempty"`  // 是否默认选项
+	Width         int             `bson:"width,omitempty"          json:"width,omitempty"`          // 宽度
+	Height        int             `bson:"height,omitempty"         json:"height,omitempty"`         // 高度
+	Mode          string          `bson:"mode,omitempty"           json:"mode,omitempty"`           // 模式[low, high, auto]
+	FixedQuota    int             `bson:"fixed_quota,omitempty"    json:"fixed_quota,omitempty"`    // 固定额度
+	IsDefault     bool            `bson:"is_default,omitempty"     json:"is_default,omitempty"`     // 是否默认选项
+	TimeDiscounts []*TimeDiscount `bson:"time_discounts,omitempty" json:"time_discounts,omitempty"` // 分时折扣
 }
 
 type AudioQuota struct {
-	BillingMethod   int     `bson:"billing_method,omitempty"   json:"billing_method,omitempty"`         // 计费方式[1:倍率, 2:固定额度]
-	PromptRatio     float64 `bson:"prompt_ratio,omitempty"     json:"prompt_ratio,omitempty"     d:"1"` // 提示倍率(提问倍率)
-	CompletionRatio float64 `bson:"completion_ratio,omitempty" json:"completion_ratio,omitempty" d:"1"` // 补全倍率(回答倍率)
-	FixedQuota      int     `bson:"fixed_quota,omitempty"      json:"fixed_quota,omitempty"`            // 固定额度
+	BillingMethod   int             `bson:"billing_method,omitempty"   json:"billing_method,omitempty"`         // 计费方式[1:倍率, 2:固定额度]
+	PromptRatio     float64         `bson:"prompt_ratio,omitempty"     json:"prompt_ratio,omitempty"     d:"1"` // 提示倍率(提问倍率)
+	CompletionRatio float64         `bson:"completion_ratio,omitempty" json:"completion_ratio,omitempty" d:"1"` // 补全倍率(回答倍率)
+	FixedQuota      int             `bson:"fixed_quota,omitempty"      json:"fixed_quota,omitempty"`            // 固定额度
+	TimeDiscounts   []*TimeDiscount `bson:"time_discounts,omitempty"   json:"time_discounts,omitempty"`         // 分时折扣
 }
 
 type MultimodalQuota struct {
@@ -49,10 +72,29 @@ type MultimodalAudioQuota struct {
 }
 
 type MidjourneyQuota struct {
-	Name       string `bson:"name,omitempty"        json:"name,omitempty"`        // 名称
-	Action     string `bson:"action,omitempty"      json:"action,omitempty"`      // 动作[IMAGINE, UPSCALE, VARIATION, ZOOM, PAN, DESCRIBE, BLEND, SHORTEN, SWAP_FACE]
-	Path       string `bson:"path,omitempty"        json:"path,omitempty"`        // 路径
-	FixedQuota int    `bson:"fixed_quota,omitempty" json:"fixed_quota,omitempty"` // 固定额度
+	Name          string          `bson:"name,omitempty"           json:"name,omitempty"`           // 名称
+	Action        string          `bson:"action,omitempty"         json:"action,omitempty"`         // 动作[IMAGINE, UPSCALE, VARIATION, ZOOM, PAN, DESCRIBE, BLEND, SHORTEN, SWAP_FACE]
+	Path          string          `bson:"path,omitempty"           json:"path,omitempty"`           // 路径
+	FixedQuota    int             `bson:"fixed_quota,omitempty"    json:"fixed_quota,omitempty"`    // 固定额度
+	TimeDiscounts []*TimeDiscount `bson:"time_discounts,omitempty" json:"time_discounts,omitempty"` // 分时折扣
+}
+
+type SoftLimit struct {
+	Quota       int    `bson:"quota,omitempty"        json:"quota,omitempty"`        // 软限制额度, 剩余额度低于该值时仍放行请求, 但返回警告并通知
+	TargetModel string `bson:"target_model,omitempty" json:"target_model,omitempty"` // 降级目标模型ID, 超过软限制时转发到该模型, 为空时不降级
+}
+
+type ModelQuota struct {
+	Period   int                `bson:"period,omitempty"    json:"period,omitempty"`    // 重置周期[1:每天, 2:每周, 3:每月], 为空时不重置
+	TimeZone string             `bson:"time_zone,omitempty" json:"time_zone,omitempty"` // 时区, 为空时使用服务器时区
+	ResetAt  int64              `bson:"reset_at,omitempty"  json:"reset_at,omitempty"`  // 本周期开始时间
+	Limits   []*ModelQuotaLimit `bson:"limits,omitempty"    json:"limits,omitempty"`    // 额度上限, 未配置的模型不限制
+}
+
+type ModelQuotaLimit struct {
+	Models []string `bson:"models,omitempty" json:"models,omitempty"` // 模型ID, 多个模型共用额度上限
+	Type   int      `bson:"type,omitempty"   json:"type,omitempty"`   // 模型类型, 未配置模型时按模型类型限制
+	Quota  int      `bson:"quota,omitempty"  json:"quota,omitempty"`  // 每周期额度上限
 }
 
 type ForwardConfig struct {
@@ -65,11 +107,31 @@ type ForwardConfig struct {
 	ContentLength int      `bson:"content_length,omitempty" json:"content_length,omitempty"` // 转发规则为3时的内容长度
 }
 
+type HedgeConfig struct {
+	Delay int64 `bson:"delay,omitempty" json:"delay,omitempty"` // 对冲延迟(毫秒), 为0时取最近延迟的P95
+}
+
+type AffinityConfig struct {
+	PrefixLength int   `bson:"prefix_length,omitempty" json:"prefix_length,omitempty"` // 消息前缀长度(字符), 为0时取1024
+	Ttl          int64 `bson:"ttl,omitempty"           json:"ttl,omitempty"`           // 绑定有效期(秒), 为0时取300
+}
+
 type FallbackConfig struct {
-	ModelAgent     string `bson:"model_agent,omitempty"      json:"model_agent,omitempty"`      // 后备模型代理
-	ModelAgentName string `bson:"model_agent_name,omitempty" json:"model_agent_name,omitempty"` // 后备模型代理名称
-	Model          string `bson:"model,omitempty"            json:"model,omitempty"`            // 后备模型
-	ModelName      string `bson:"model_name,omitempty"       json:"model_name,omitempty"`       // 后备模型名称
+	ModelAgent     string          `bson:"model_agent,omitempty"      json:"model_agent,omitempty"`      // 后备模型代理
+	ModelAgentName string          `bson:"model_agent_name,omitempty" json:"model_agent_name,omitempty"` // 后备模型代理名称
+	Model          string          `bson:"model,omitempty"            json:"model,omitempty"`            // 后备模型
+	ModelName      string          `bson:"model_name,omitempty"       json:"model_name,omitempty"`       // 后备模型名称
+	Chain          []*FallbackStep `bson:"chain,omitempty"            json:"chain,omitempty"`            // 后备链, 按顺序依次尝试, 未配置时由后备模型代理和后备模型组成
+	Path           []*FallbackStep `bson:"path,omitempty"             json:"path,omitempty"`             // 后备路径, 仅日志记录
+}
+
+type FallbackStep struct {
+	ModelAgent     string   `bson:"model_agent,omitempty"      json:"model_agent,omitempty"`      // 后备模型代理
+	ModelAgentName string   `bson:"model_agent_name,omitempty" json:"model_agent_name,omitempty"` // 后备模型代理名称
+	Model          string   `bson:"model,omitempty"            json:"model,omitempty"`            // 后备模型
+	ModelName      string   `bson:"model_name,omitempty"       json:"model_name,omitempty"`       // 后备模型名称
+	Conditions     []string `bson:"conditions,omitempty"       json:"conditions,omitempty"`       // 触发条件[timeout:超时, 5xx:服务端错误, content_filter:内容过滤, rate_limit:限流], 为空时任意错误均触发
+	ErrMsg         string   `bson:"err_msg,omitempty"          json:"err_msg,omitempty"`          // 触发错误, 仅日志记录
 }
 
 type Message struct {
@@ -88,3 +150,37 @@ type ImageData struct {
 	B64JSON       string `bson:"b64_json,omitempty"`
 	RevisedPrompt string `bson:"revised_prompt,omitempty"`
 }
+
+type RateLimit struct {
+	Rpm         int               `bson:"rpm,omitempty"         json:"rpm,omitempty"`         // 每分钟请求数, 0为不限制
+	Tpm         int               `bson:"tpm,omitempty"         json:"tpm,omitempty"`         // 每分钟令牌数, 0为不限制
+	Concurrency int               `bson:"concurrency,omitempty" json:"concurrency,omitempty"` // 最大并发请求数, 0为不限制
+	Models      []*ModelRateLimit `bson:"models,omitempty"      json:"models,omitempty"`      // 按模型限制
+}
+
+type ModelRateLimit struct {
+	Model       string `bson:"model,omitempty"       json:"model,omitempty"`       // 模型ID
+	Rpm         int    `bson:"rpm,omitempty"         json:"rpm,omitempty"`         // 每分钟请求数, 0为不限制
+	Tpm         int    `bson:"tpm,omitempty"         json:"tpm,omitempty"`         // 每分钟令牌数, 0为不限制
+	Concurrency int    `bson:"concurrency,omitempty" json:"concurrency,omitempty"` // 最大并发请求数, 0为不限制
+}
+
+type QuotaBudget struct {
+	Period         int    `bson:"period,omitempty"           json:"period,omitempty"`           // 重置周期[1:每天, 2:每周, 3:每月]
+	Allowance      int    `bson:"allowance,omitempty"        json:"allowance,omitempty"`        // 每周期额度
+	TimeZone       string `bson:"time_zone,omitempty"        json:"time_zone,omitempty"`        // 时区, 为空时使用服务器时区
+	ResetAt        int64  `bson:"reset_at,omitempty"         json:"reset_at,omitempty"`         // 本周期开始时间
+	ResetUsedQuota int    `bson:"reset_used_quota,omitempty" json:"reset_used_quota,omitempty"` // 本周期开始时的已用额度
+}
+
+type BatchError struct {
+	Code    string `bson:"code,omitempty"    json:"code"`           // 错误码
+	Message string `bson:"message,omitempty" json:"message"`        // 错误信息
+	Line    int    `bson:"line,omitempty"    json:"line,omitempty"` // 输入文件行号
+}
+
+type BatchRequestCounts struct {
+	Total     int `bson:"total"     json:"total"`     // 总请求数
+	Completed int `bson:"completed" json:"completed"` // 成功请求数
+	Failed    int `bson:"failed"    json:"failed"`    // 失败请求数
+}
@@ -36,6 +36,65 @@ type Base struct {
 	ModelAgentKeyErrDisable int64 `bson:"model_agent_key_err_disable" json:"model_agent_key_err_disable"` // 模型代理密钥禁用次数
 }
 
+type CircuitBreaker struct {
+	Open             bool  `bson:"open"               json:"open"`               // 开关
+	FailureThreshold int64 `bson:"failure_threshold"  json:"failure_threshold"`  // 连续失败熔断次数
+	CoolDown         int64 `bson:"cool_down"          json:"cool_down"`          // 熔断冷却时长(秒)
+	HalfOpenRequests int64 `bson:"half_open_requests" json:"half_open_requests"` // 半开状态并发探测数
+	SuccessThreshold int64 `bson:"success_threshold"  json:"success_threshold"`  // 半开状态恢复所需成功次数
+}
+
+type HealthProbe struct {
+	Open        bool   `bson:"open"         json:"open"`         // 开关
+	Model       string `bson:"model"        json:"model"`        // 探测模型
+	Interval    int64  `bson:"interval"     json:"interval"`     // 探测间隔(秒)
+	MaxAttempts int64  `bson:"max_attempts" json:"max_attempts"` // 最大探测次数, 0为不限制
+}
+
+type RateLimitCooldown struct {
+	Open        bool  `bson:"open"      json:"open"`              // 开关
+	CoolDown    int64 `bson:"cool_down" json:"cool_down"`         // 默认冷却时长(秒), 上游未返回重试时间时使用
+	MaxCoolDown int64 `bson:"max_cool_down" json:"max_cool_down"` // 最大冷却时长(秒)
+}
+
+type ConcurrencyLimit struct {
+	QueueSize    int64 `bson:"queue_size"    json:"queue_size"`    // 排队队列长度, 0为不排队
+	QueueTimeout int64 `bson:"queue_timeout" json:"queue_timeout"` // 排队超时时间(秒)
+	LeaseTime    int64 `bson:"lease_time"    json:"lease_time"`    // 租约时长(秒), 兜底进程异常退出时未释放的并发数
+}
+
+type QuotaReservation struct {
+	Open             bool `bson:"open"               json:"open"`               // 开关
+	DefaultMaxTokens int  `bson:"default_max_tokens" json:"default_max_tokens"` // 默认最大输出令牌数, 请求未指定时用于估算预占额度
+}
+
+type QuotaNotice struct {
+	Open          bool   `bson:"open"           json:"open"`           // 开关
+	Thresholds    []int  `bson:"thresholds"     json:"thresholds"`     // 剩余额度百分比阈值, 额度耗尽时始终通知
+	ExpireWarning int64  `bson:"expire_warning" json:"expire_warning"` // 额度过期提前通知时长(秒), 0为不通知
+	Period        int64  `bson:"period"         json:"period"`         // 通知去重周期(秒), 同一阈值在周期内只通知一次, 有额度预算时按预算周期
+	EmailOpen     bool   `bson:"email_open"     json:"email_open"`     // 邮件通知开关, 通过邮箱配置发送到用户邮箱
+	Webhook       string `bson:"webhook"        json:"webhook"`        // Webhook地址
+}
+
+type QuotaCurrency struct {
+	Unit         float64 `bson:"unit"          json:"unit"`          // 额度单位, 1美元对应的额度, 默认500000
+	Currency     string  `bson:"currency"      json:"currency"`      // 显示货币, 默认USD
+	ExchangeRate float64 `bson:"exchange_rate" json:"exchange_rate"` // 汇率, 1美元对应的显示货币金额, 默认1
+}
+
+type Batch struct {
+	Open          bool    `bson:"open"           json:"open"`           // 开关
+	DiscountRatio float64 `bson:"discount_ratio" json:"discount_ratio"` // 计费折扣率, 如0.5为按五折计费, 0为不打折
+	Workers       int     `bson:"workers"        json:"workers"`        // 单实例同时执行的批处理任务数, 默认1
+	Concurrency   int     `bson:"concurrency"    json:"concurrency"`    // 单个批处理任务每轮并发请求数, 默认5
+	Interval      int64   `bson:"interval"       json:"interval"`       // 每轮请求间隔(毫秒), 用于限制批处理占用的吞吐, 避免影响实时请求
+	BackoffTime   int64   `bson:"backoff_time"   json:"backoff_time"`   // 触发限流时的退避时长(秒), 默认30
+	MaxRequests   int     `bson:"max_requests"   json:"max_requests"`   // 单个批处理任务最大请求数, 默认50000
+	MaxFileSize   int64   `bson:"max_file_size"  json:"max_file_size"`  // 上传文件最大字节数, 默认100MB
+	FileDir       string  `bson:"file_dir"       json:"file_dir"`       // 文件存储目录, 多实例部署时需为共享存储, 默认./resource/batch/
+}
+
 type Midjourney struct {
 	Open            bool   `bson:"open"              json:"open"` // 开关
 	CdnUrl          string `bson:"cdn_url"           json:"cdn_url"`
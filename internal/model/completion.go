@@ -0,0 +1,23 @@
+package model
+
+type TextCompletionRes struct {
+	Id      string                  `json:"id"`
+	Object  string                  `json:"object"`
+	Created int64                   `json:"created"`
+	Model   string                  `json:"model"`
+	Choices []*TextCompletionChoice `json:"choices"`
+	Usage   *TextCompletionUsage    `json:"usage,omitempty"`
+}
+
+type TextCompletionChoice struct {
+	Text         string `json:"text"`
+	Index        int    `json:"index"`
+	LogProbs     any    `json:"logprobs"`
+	FinishReason string `json:"finish_reason"`
+}
+
+type TextCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
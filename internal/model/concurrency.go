@@ -0,0 +1,6 @@
+package model
+
+type ConcurrencyLease struct {
+	Type string `json:"type"` // 类型
+	Id   string `json:"id"`   // ID
+}
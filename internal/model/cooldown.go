@@ -0,0 +1,6 @@
+package model
+
+type Cooldown struct {
+	Id    string `json:"id,omitempty"`    // 密钥ID
+	Until int64  `json:"until,omitempty"` // 冷却截止时间(毫秒)
+}
@@ -12,10 +12,54 @@ type DashboardSubscriptionRes struct {
 	AccessUntil        int64   `json:"access_until"`
 }
 
+// Usage接口请求参数
+type DashboardUsageReq struct {
+	StartDate string `json:"start_date"` // 开始日期, 格式: 2006-01-02
+	EndDate   string `json:"end_date"`   // 结束日期(不包含), 格式: 2006-01-02
+	IsFastAPI bool   `json:"is_fastapi"` // 是否返回详细用量
+}
+
 // Usage接口响应参数
 type DashboardUsageRes struct {
-	Object     string  `json:"object"`
-	TotalUsage float64 `json:"total_usage"`
+	Object     string                 `json:"object"`
+	DailyCosts []*DashboardDailyCost  `json:"daily_costs,omitempty"`
+	TotalUsage float64                `json:"total_usage"`
+	FastAPI    *DashboardUsageFastAPI `json:"fastapi,omitempty"`
+}
+
+type DashboardDailyCost struct {
+	Timestamp float64              `json:"timestamp"`
+	LineItems []*DashboardLineItem `json:"line_items"`
+}
+
+type DashboardLineItem struct {
+	Name string  `json:"name"`
+	Cost float64 `json:"cost"`
+}
+
+type DashboardUsageFastAPI struct {
+	Currency  string                 `json:"currency"`
+	StartDate string                 `json:"start_date"`
+	EndDate   string                 `json:"end_date"`
+	Total     *DashboardUsageItem    `json:"total"`
+	Daily     []*DashboardUsageDaily `json:"daily"`
+}
+
+type DashboardUsageDaily struct {
+	Date   string                `json:"date"`
+	Total  *DashboardUsageItem   `json:"total"`
+	Models []*DashboardUsageItem `json:"models"`
+}
+
+type DashboardUsageItem struct {
+	Model            string  `json:"model,omitempty"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	CacheHitTokens   int     `json:"cache_hit_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
 }
 
 // Models接口响应参数
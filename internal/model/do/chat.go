@@ -31,6 +31,7 @@ type Chat struct {
 	IsSmartMatch         bool                        `bson:"is_smart_match,omitempty"`          // 是否智能匹配
 	IsEnableFallback     bool                        `bson:"is_enable_fallback,omitempty"`      // 是否启用后备
 	FallbackConfig       *common.FallbackConfig      `bson:"fallback_config,omitempty"`         // 后备配置
+	IsHedge              bool                        `bson:"is_hedge,omitempty"`                // 是否对冲请求
 	RealModelId          string                      `bson:"real_model_id,omitempty"`           // 真实模型ID
 	RealModelName        string                      `bson:"real_model_name,omitempty"`         // 真实模型名称
 	RealModel            string                      `bson:"real_model,omitempty"`              // 真实模型
@@ -48,6 +49,7 @@ type Chat struct {
 	CacheWriteTokens     int                         `bson:"cache_write_tokens,omitempty"`      // 缓存写入令牌数
 	CacheHitTokens       int                         `bson:"cache_hit_tokens,omitempty"`        // 缓存命中令牌数
 	TotalTokens          int                         `bson:"total_tokens,omitempty"`            // 总令牌数
+	QuotaCurrency        *common.QuotaCurrency       `bson:"quota_currency,omitempty"`          // 额度货币, 记录时的额度单位和汇率
 	ConnTime             int64                       `bson:"conn_time,omitempty"`               // 连接时间
 	Duration             int64                       `bson:"duration,omitempty"`                // 持续时间
 	TotalTime            int64                       `bson:"total_time,omitempty"`              // 总时间
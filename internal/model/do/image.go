@@ -43,6 +43,7 @@ type Image struct {
 	ImageData            []common.ImageData     `bson:"image_data,omitempty"`              // 生成图像数据
 	ImageQuotas          []common.ImageQuota    `bson:"image_quotas,omitempty"`            // 图像额度
 	TotalTokens          int                    `bson:"total_tokens,omitempty"`            // 总令牌数
+	QuotaCurrency        *common.QuotaCurrency  `bson:"quota_currency,omitempty"`          // 额度货币, 记录时的额度单位和汇率
 	TotalTime            int64                  `bson:"total_time,omitempty"`              // 总时间
 	InternalTime         int64                  `bson:"internal_time,omitempty"`           // 内耗时间
 	ReqTime              int64                  `bson:"req_time,omitempty"`                // 请求时间
@@ -44,6 +44,7 @@ type Midjourney struct {
 	Response             interface{}              `bson:"response,omitempty"`                // 响应结果
 	MidjourneyQuotas     []common.MidjourneyQuota `bson:"midjourney_quotas,omitempty"`       // Midjourney额度
 	TotalTokens          int                      `bson:"total_tokens,omitempty"`            // 总令牌数
+	QuotaCurrency        *common.QuotaCurrency    `bson:"quota_currency,omitempty"`          // 额度货币, 记录时的额度单位和汇率
 	ConnTime             int64                    `bson:"conn_time,omitempty"`               // 连接时间
 	Duration             int64                    `bson:"duration,omitempty"`                // 持续时间
 	TotalTime            int64                    `bson:"total_time,omitempty"`              // 总时间
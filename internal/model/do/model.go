@@ -29,12 +29,18 @@ type Model struct {
 	DataFormat           int                         `bson:"data_format,omitempty"`             // 数据格式[1:统一格式, 2:官方格式]
 	IsPublic             bool                        `bson:"is_public,omitempty"`               // 是否公开
 	IsEnableModelAgent   bool                        `bson:"is_enable_model_agent,omitempty"`   // 是否启用模型代理
-	LbStrategy           int                         `bson:"lb_strategy,omitempty"`             // 代理负载均衡策略[1:轮询, 2:权重]
+	LbStrategy           int                         `bson:"lb_strategy,omitempty"`             // 代理负载均衡策略[1:轮询, 2:权重, 3:最快响应, 4:最低成本]
 	ModelAgents          []string                    `bson:"model_agents,omitempty"`            // 模型代理
 	IsEnableForward      bool                        `bson:"is_enable_forward,omitempty"`       // 是否启用模型转发
 	ForwardConfig        *common.ForwardConfig       `bson:"forward_config,omitempty"`          // 模型转发配置
 	IsEnableFallback     bool                        `bson:"is_enable_fallback,omitempty"`      // 是否启用后备
 	FallbackConfig       *common.FallbackConfig      `bson:"fallback_config,omitempty"`         // 后备配置
+	IsEnableHedge        bool                        `bson:"is_enable_hedge,omitempty"`         // 是否启用对冲请求
+	HedgeConfig          *common.HedgeConfig         `bson:"hedge_config,omitempty"`            // 对冲请求配置
+	IsEnableAffinity     bool                        `bson:"is_enable_affinity,omitempty"`      // 是否启用亲和路由
+	AffinityConfig       *common.AffinityConfig      `bson:"affinity_config,omitempty"`         // 亲和路由配置
+	IsEnableStreamResume bool                        `bson:"is_enable_stream_resume,omitempty"` // 是否启用流式续写
+	IsSupportCompletions bool                        `bson:"is_support_completions,omitempty"`  // 是否支持原生文本补全接口
 	Remark               string                      `bson:"remark,omitempty"`                  // 备注
 	Status               int                         `bson:"status,omitempty"`                  // 状态[1:正常, 2:禁用, -1:删除]
 	Creator              string                      `bson:"creator,omitempty"`                 // 创建人
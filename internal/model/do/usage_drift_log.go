@@ -0,0 +1,20 @@
+package do
+
+import "github.com/gogf/gf/v2/util/gmeta"
+
+const (
+	USAGE_DRIFT_LOG_COLLECTION = "usage_drift_log"
+)
+
+type UsageDriftLog struct {
+	gmeta.Meta     `collection:"usage_drift_log" bson:"-"`
+	Type           string `bson:"type,omitempty"`       // 类型[user:用户, app:应用, app_key:应用密钥]
+	UserId         int    `bson:"user_id,omitempty"`    // 用户ID
+	AppId          int    `bson:"app_id,omitempty"`     // 应用ID
+	Key            string `bson:"key,omitempty"`        // 密钥
+	RedisQuota     int    `bson:"redis_quota"`          // Redis剩余额度
+	MongoQuota     int    `bson:"mongo_quota"`          // Mongo剩余额度
+	MongoUsedQuota int    `bson:"mongo_used_quota"`     // Mongo已用额度
+	Drift          int    `bson:"drift"`                // 差额, Redis剩余额度减Mongo剩余额度
+	CreatedAt      int64  `bson:"created_at,omitempty"` // 创建时间
+}
@@ -35,6 +35,7 @@ type Audio struct {
 	AudioQuota           common.AudioQuota      `bson:"audio_quota,omitempty"`             // 音频额度
 	FilePath             string                 `bson:"file_path,omitempty"`               // 文件路径
 	TotalTokens          int                    `bson:"total_tokens,omitempty"`            // 总令牌数
+	QuotaCurrency        *common.QuotaCurrency  `bson:"quota_currency,omitempty"`          // 额度货币, 记录时的额度单位和汇率
 	TotalTime            int64                  `bson:"total_time,omitempty"`              // 总时间
 	InternalTime         int64                  `bson:"internal_time,omitempty"`           // 内耗时间
 	ReqTime              int64                  `bson:"req_time,omitempty"`                // 请求时间
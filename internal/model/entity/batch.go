@@ -0,0 +1,35 @@
+package entity
+
+import "github.com/iimeta/fastapi/internal/model/common"
+
+type Batch struct {
+	Id               string                     `bson:"_id,omitempty"`               // ID
+	BatchId          string                     `bson:"batch_id,omitempty"`          // 批处理ID
+	TraceId          string                     `bson:"trace_id,omitempty"`          // 日志ID
+	UserId           int                        `bson:"user_id,omitempty"`           // 用户ID
+	AppId            int                        `bson:"app_id,omitempty"`            // 应用ID
+	SecretKey        string                     `bson:"secret_key,omitempty"`        // 提交批处理的密钥, 执行时以该密钥的身份请求
+	ClientIp         string                     `bson:"client_ip,omitempty"`         // 提交批处理的客户端IP, 执行时沿用以满足IP白名单
+	Endpoint         string                     `bson:"endpoint,omitempty"`          // 请求接口
+	InputFileId      string                     `bson:"input_file_id,omitempty"`     // 输入文件ID
+	OutputFileId     string                     `bson:"output_file_id,omitempty"`    // 输出文件ID
+	ErrorFileId      string                     `bson:"error_file_id,omitempty"`     // 错误文件ID
+	CompletionWindow string                     `bson:"completion_window,omitempty"` // 完成时间窗口
+	Status           string                     `bson:"status,omitempty"`            // 状态[validating:校验中, failed:失败, in_progress:执行中, finalizing:生成结果中, completed:已完成, expired:已过期, cancelling:取消中, cancelled:已取消]
+	Errors           []*common.BatchError       `bson:"errors,omitempty"`            // 校验错误
+	RequestCounts    *common.BatchRequestCounts `bson:"request_counts,omitempty"`    // 请求数统计
+	Offset           int                        `bson:"offset,omitempty"`            // 已执行的输入文件行数, 用于中断后续接执行
+	Metadata         map[string]string          `bson:"metadata,omitempty"`          // 元数据
+	InProgressAt     int64                      `bson:"in_progress_at,omitempty"`    // 开始执行时间
+	ExpiresAt        int64                      `bson:"expires_at,omitempty"`        // 过期时间
+	FinalizingAt     int64                      `bson:"finalizing_at,omitempty"`     // 开始生成结果时间
+	CompletedAt      int64                      `bson:"completed_at,omitempty"`      // 完成时间
+	FailedAt         int64                      `bson:"failed_at,omitempty"`         // 失败时间
+	ExpiredAt        int64                      `bson:"expired_at,omitempty"`        // 过期处理时间
+	CancellingAt     int64                      `bson:"cancelling_at,omitempty"`     // 开始取消时间
+	CancelledAt      int64                      `bson:"cancelled_at,omitempty"`      // 取消时间
+	Creator          string                     `bson:"creator,omitempty"`           // 创建人
+	Updater          string                     `bson:"updater,omitempty"`           // 更新人
+	CreatedAt        int64                      `bson:"created_at,omitempty"`        // 创建时间
+	UpdatedAt        int64                      `bson:"updated_at,omitempty"`        // 更新时间
+}
@@ -0,0 +1,11 @@
+package entity
+
+type BreakerLog struct {
+	Id        string `bson:"_id,omitempty"`        // ID
+	Type      string `bson:"type,omitempty"`       // 类型[model_key:模型密钥, model_agent:模型代理, model_agent_key:模型代理密钥]
+	TargetId  string `bson:"target_id,omitempty"`  // 模型密钥ID/模型代理ID
+	FromState string `bson:"from_state,omitempty"` // 原状态[closed:关闭, open:打开, half_open:半开]
+	ToState   string `bson:"to_state,omitempty"`   // 新状态[closed:关闭, open:打开, half_open:半开]
+	Host      string `bson:"host,omitempty"`       // 主机
+	CreatedAt int64  `bson:"created_at,omitempty"` // 创建时间
+}
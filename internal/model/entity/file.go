@@ -0,0 +1,18 @@
+package entity
+
+type File struct {
+	Id        string `bson:"_id,omitempty"`        // ID
+	FileId    string `bson:"file_id,omitempty"`    // 文件ID
+	TraceId   string `bson:"trace_id,omitempty"`   // 日志ID
+	UserId    int    `bson:"user_id,omitempty"`    // 用户ID
+	AppId     int    `bson:"app_id,omitempty"`     // 应用ID
+	Purpose   string `bson:"purpose,omitempty"`    // 用途[batch:批处理输入, batch_output:批处理输出]
+	Filename  string `bson:"filename,omitempty"`   // 文件名
+	Bytes     int64  `bson:"bytes,omitempty"`      // 文件大小
+	FilePath  string `bson:"file_path,omitempty"`  // 文件存储路径
+	Status    string `bson:"status,omitempty"`     // 状态[processed:已处理]
+	Creator   string `bson:"creator,omitempty"`    // 创建人
+	Updater   string `bson:"updater,omitempty"`    // 更新人
+	CreatedAt int64  `bson:"created_at,omitempty"` // 创建时间
+	UpdatedAt int64  `bson:"updated_at,omitempty"` // 更新时间
+}
@@ -0,0 +1,16 @@
+package entity
+
+type QuotaBudgetLog struct {
+	Id          string `bson:"_id,omitempty"`          // ID
+	Type        string `bson:"type,omitempty"`         // 类型[app:应用, app_key:应用密钥]
+	UserId      int    `bson:"user_id,omitempty"`      // 用户ID
+	AppId       int    `bson:"app_id,omitempty"`       // 应用ID
+	Key         string `bson:"key,omitempty"`          // 密钥
+	Period      int    `bson:"period,omitempty"`       // 重置周期[1:每天, 2:每周, 3:每月]
+	Allowance   int    `bson:"allowance,omitempty"`    // 每周期额度
+	UsedQuota   int    `bson:"used_quota,omitempty"`   // 本周期已用额度
+	RemainQuota int    `bson:"remain_quota,omitempty"` // 本周期剩余额度
+	StartAt     int64  `bson:"start_at,omitempty"`     // 周期开始时间
+	EndAt       int64  `bson:"end_at,omitempty"`       // 周期结束时间
+	CreatedAt   int64  `bson:"created_at,omitempty"`   // 创建时间
+}
@@ -0,0 +1,18 @@
+package entity
+
+type Response struct {
+	Id                 string `bson:"_id,omitempty"`                  // ID
+	ResponseId         string `bson:"response_id,omitempty"`          // 响应ID
+	PreviousResponseId string `bson:"previous_response_id,omitempty"` // 上一个响应ID
+	TraceId            string `bson:"trace_id,omitempty"`             // 日志ID
+	UserId             int    `bson:"user_id,omitempty"`              // 用户ID
+	AppId              int    `bson:"app_id,omitempty"`               // 应用ID
+	Model              string `bson:"model,omitempty"`                // 模型
+	TurnMessages       string `bson:"turn_messages,omitempty"`        // 本轮对话消息, 用于previous_response_id续接
+	Response           string `bson:"response,omitempty"`             // 响应对象
+	Status             string `bson:"status,omitempty"`               // 状态[completed:已完成, incomplete:未完成, failed:失败]
+	Creator            string `bson:"creator,omitempty"`              // 创建人
+	Updater            string `bson:"updater,omitempty"`              // 更新人
+	CreatedAt          int64  `bson:"created_at,omitempty"`           // 创建时间
+	UpdatedAt          int64  `bson:"updated_at,omitempty"`           // 更新时间
+}
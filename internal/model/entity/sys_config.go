@@ -11,6 +11,14 @@ type SysConfig struct {
 	Email             *common.Email             `bson:"email,omitempty"`               // 邮箱
 	Statistics        *common.Statistics        `bson:"statistics,omitempty"`          // 统计
 	Base              *common.Base              `bson:"base,omitempty"`                // 基础
+	CircuitBreaker    *common.CircuitBreaker    `bson:"circuit_breaker,omitempty"`     // 熔断器
+	HealthProbe       *common.HealthProbe       `bson:"health_probe,omitempty"`        // 健康探测
+	RateLimitCooldown *common.RateLimitCooldown `bson:"rate_limit_cooldown,omitempty"` // 限流冷却
+	ConcurrencyLimit  *common.ConcurrencyLimit  `bson:"concurrency_limit,omitempty"`   // 并发限制
+	QuotaReservation  *common.QuotaReservation  `bson:"quota_reservation,omitempty"`   // 额度预占
+	QuotaNotice       *common.QuotaNotice       `bson:"quota_notice,omitempty"`        // 额度通知
+	QuotaCurrency     *common.QuotaCurrency     `bson:"quota_currency,omitempty"`      // 额度货币
+	Batch             *common.Batch             `bson:"batch,omitempty"`               // 批处理
 	Midjourney        *common.Midjourney        `bson:"midjourney,omitempty"`          // Midjourney
 	Log               *common.Log               `bson:"log,omitempty"`                 // 日志
 	UserShieldError   *common.UserShieldError   `bson:"user_shield_error,omitempty"`   // 用户屏蔽错误
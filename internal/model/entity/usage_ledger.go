@@ -0,0 +1,21 @@
+package entity
+
+type UsageLedger struct {
+	Id              string   `bson:"_id,omitempty"`                // ID
+	TraceId         string   `bson:"trace_id,omitempty"`           // 日志ID, 同一请求多次计费时追加序号
+	UserId          int      `bson:"user_id,omitempty"`            // 用户ID
+	AppId           int      `bson:"app_id,omitempty"`             // 应用ID
+	AppKey          string   `bson:"app_key,omitempty"`            // 应用密钥
+	Key             string   `bson:"key,omitempty"`                // 模型密钥
+	SpendQuota      int      `bson:"spend_quota,omitempty"`        // 花费额度
+	ReservedQuota   int      `bson:"reserved_quota,omitempty"`     // 预占额度, 随各额度字段的花费一并释放
+	AppIsLimitQuota bool     `bson:"app_is_limit_quota,omitempty"` // 应用是否限制额度
+	KeyIsLimitQuota bool     `bson:"key_is_limit_quota,omitempty"` // 应用密钥是否限制额度
+	ModelFields     []string `bson:"model_fields,omitempty"`       // 模型额度上限的已用额度字段
+	Steps           []string `bson:"steps,omitempty"`              // 已执行步骤
+	Status          int      `bson:"status,omitempty"`             // 状态[1:已入账, 2:待入账]
+	Creator         string   `bson:"creator,omitempty"`            // 创建人
+	Updater         string   `bson:"updater,omitempty"`            // 更新人
+	CreatedAt       int64    `bson:"created_at,omitempty"`         // 创建时间
+	UpdatedAt       int64    `bson:"updated_at,omitempty"`         // 更新时间
+}
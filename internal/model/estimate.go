@@ -0,0 +1,17 @@
+package model
+
+type EstimateRes struct {
+	Object       string  `json:"object"`                  // 对象类型
+	Model        string  `json:"model"`                   // 请求模型, 软限制降级时为降级后的模型
+	RealModel    string  `json:"real_model"`              // 实际调用模型, 已按模型转发和后备规则解析
+	ModelAgent   string  `json:"model_agent,omitempty"`   // 模型代理名称
+	PromptTokens int     `json:"prompt_tokens"`           // 预估提示令牌数
+	ImageTokens  int     `json:"image_tokens,omitempty"`  // 预估图像令牌数, 已包含在提示令牌数中
+	MaxTokens    int     `json:"max_tokens,omitempty"`    // 最大输出令牌数, 已按预设配置调整
+	MinQuota     int     `json:"min_quota"`               // 最少花费额度
+	MaxQuota     int     `json:"max_quota"`               // 最多花费额度
+	Currency     string  `json:"currency,omitempty"`      // 显示货币
+	MinAmount    float64 `json:"min_amount"`              // 最少花费金额
+	MaxAmount    float64 `json:"max_amount"`              // 最多花费金额
+	IsSoftLimit  bool    `json:"is_soft_limit,omitempty"` // 是否已超过软限制
+}
@@ -6,8 +6,19 @@ import (
 
 // Files接口请求参数
 type FileFilesReq struct {
-	Model    string            `json:"model" v:"required"`
+	Model    string            `json:"model" v:"required-unless:purpose,batch"`
 	File     *ghttp.UploadFile `json:"file" type:"file" v:"required"`
 	Purpose  string            `json:"purpose"`
 	FilePath string            `json:"-"`
 }
+
+// 文件对象
+type FileRes struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
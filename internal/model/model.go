@@ -22,7 +22,7 @@ type Model struct {
 	DataFormat           int                         `json:"data_format,omitempty"`             // 数据格式[1:统一格式, 2:官方格式]
 	IsPublic             bool                        `json:"is_public,omitempty"`               // 是否公开
 	IsEnableModelAgent   bool                        `json:"is_enable_model_agent,omitempty"`   // 是否启用模型代理
-	LbStrategy           int                         `json:"lb_strategy,omitempty"`             // 代理负载均衡策略[1:轮询, 2:权重]
+	LbStrategy           int                         `json:"lb_strategy,omitempty"`             // 代理负载均衡策略[1:轮询, 2:权重, 3:最快响应, 4:最低成本]
 	ModelAgents          []string                    `json:"model_agents,omitempty"`            // 模型代理
 	ModelAgentNames      []string                    `json:"model_agent_names,omitempty"`       // 模型代理名称
 	ModelAgent           *ModelAgent                 `json:"model_agent,omitempty"`             // 模型代理信息
@@ -30,6 +30,12 @@ type Model struct {
 	ForwardConfig        *common.ForwardConfig       `json:"forward_config,omitempty"`          // 模型转发配置
 	IsEnableFallback     bool                        `json:"is_enable_fallback,omitempty"`      // 是否启用后备
 	FallbackConfig       *common.FallbackConfig      `json:"fallback_config,omitempty"`         // 后备配置
+	IsEnableHedge        bool                        `json:"is_enable_hedge,omitempty"`         // 是否启用对冲请求
+	HedgeConfig          *common.HedgeConfig         `json:"hedge_config,omitempty"`            // 对冲请求配置
+	IsEnableAffinity     bool                        `json:"is_enable_affinity,omitempty"`      // 是否启用亲和路由
+	AffinityConfig       *common.AffinityConfig      `json:"affinity_config,omitempty"`         // 亲和路由配置
+	IsEnableStreamResume bool                        `json:"is_enable_stream_resume,omitempty"` // 是否启用流式续写
+	IsSupportCompletions bool                        `json:"is_support_completions,omitempty"`  // 是否支持原生文本补全接口
 	Remark               string                      `json:"remark,omitempty"`                  // 备注
 	Status               int                         `json:"status,omitempty"`                  // 状态[1:正常, 2:禁用, -1:删除]
 	Creator              string                      `json:"creator,omitempty"`                 // 创建人
@@ -7,8 +7,10 @@ type ModelAgent struct {
 	BaseUrl            string   `json:"base_url,omitempty"`             // 模型代理地址
 	Path               string   `json:"path,omitempty"`                 // 模型代理地址路径
 	Weight             int      `json:"weight,omitempty"`               // 权重
+	Cost               float64  `json:"cost,omitempty"`                 // 成本系数
+	MaxConcurrency     int      `json:"max_concurrency,omitempty"`      // 最大并发数[0:不限制]
 	CurrentWeight      int      `json:"current_weight,omitempty"`       // 当前权重
-	LbStrategy         int      `json:"lb_strategy,omitempty"`          // 密钥负载均衡策略[1:轮询, 2:权重]
+	LbStrategy         int      `json:"lb_strategy,omitempty"`          // 密钥负载均衡策略[1:轮询, 2:权重, 3:最快响应]
 	Models             []string `json:"models,omitempty"`               // 绑定模型
 	ModelNames         []string `json:"model_names,omitempty"`          // 模型名称
 	Key                string   `json:"key,omitempty"`                  // 密钥
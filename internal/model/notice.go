@@ -0,0 +1,16 @@
+package model
+
+type QuotaNotice struct {
+	Type           string `json:"type"`                       // 类型[user:用户, app:应用, app_key:应用密钥]
+	Event          string `json:"event"`                      // 事件[quota_low:额度不足, quota_exhausted:额度耗尽, quota_expiring:额度即将过期, soft_limit:超过软限制]
+	UserId         int    `json:"user_id"`                    // 用户ID
+	AppId          int    `json:"app_id,omitempty"`           // 应用ID
+	Key            string `json:"key,omitempty"`              // 应用密钥, 已脱敏
+	Quota          int    `json:"quota"`                      // 剩余额度
+	TotalQuota     int    `json:"total_quota,omitempty"`      // 总额度, 有额度预算时为周期额度
+	Threshold      int    `json:"threshold,omitempty"`        // 触发的剩余额度百分比阈值
+	SoftLimit      int    `json:"soft_limit,omitempty"`       // 软限制额度
+	TargetModel    string `json:"target_model,omitempty"`     // 降级目标模型
+	QuotaExpiresAt int64  `json:"quota_expires_at,omitempty"` // 额度过期时间
+	CreatedAt      int64  `json:"created_at"`                 // 通知时间
+}
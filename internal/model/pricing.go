@@ -0,0 +1,14 @@
+package model
+
+type PricingUsage struct {
+	PromptTokens          int  `json:"prompt_tokens,omitempty"`           // 提示令牌数
+	CompletionTokens      int  `json:"completion_tokens,omitempty"`       // 补全令牌数
+	AudioPromptTokens     int  `json:"audio_prompt_tokens,omitempty"`     // 音频提示令牌数, 已包含在提示令牌数中
+	AudioCompletionTokens int  `json:"audio_completion_tokens,omitempty"` // 音频补全令牌数, 已包含在补全令牌数中
+	ReasoningTokens       int  `json:"reasoning_tokens,omitempty"`        // 推理令牌数, 已包含在补全令牌数中
+	CacheWriteTokens      int  `json:"cache_write_tokens,omitempty"`      // 缓存写入令牌数, 不包含在提示令牌数中
+	CacheReadTokens       int  `json:"cache_read_tokens,omitempty"`       // 缓存读取令牌数, 不包含在提示令牌数中
+	CachedTokens          int  `json:"cached_tokens,omitempty"`           // 缓存命中令牌数, 已包含在提示令牌数中
+	ImageQuota            int  `json:"image_quota,omitempty"`             // 图像额度, 已按图像额度配置计算
+	IsSearch              bool `json:"is_search,omitempty"`               // 是否使用搜索
+}
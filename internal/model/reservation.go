@@ -0,0 +1,11 @@
+package model
+
+import "sync/atomic"
+
+type QuotaReservation struct {
+	UserId     int         `json:"user_id"` // 用户ID
+	Amount     int         `json:"amount"`  // 预占额度
+	Fields     []string    `json:"fields"`  // 额度字段
+	IsReleased atomic.Bool `json:"-"`       // 是否已释放
+	IsSettled  atomic.Bool `json:"-"`       // 是否由记录使用额度结算
+}
@@ -0,0 +1,110 @@
+package model
+
+type ResponsesReq struct {
+	Model              string                   `json:"model"`
+	Input              any                      `json:"input"`
+	Instructions       string                   `json:"instructions,omitempty"`
+	PreviousResponseId string                   `json:"previous_response_id,omitempty"`
+	MaxOutputTokens    int                      `json:"max_output_tokens,omitempty"`
+	Temperature        float32                  `json:"temperature,omitempty"`
+	TopP               float32                  `json:"top_p,omitempty"`
+	Tools              []map[string]interface{} `json:"tools,omitempty"`
+	ToolChoice         any                      `json:"tool_choice,omitempty"`
+	ParallelToolCalls  any                      `json:"parallel_tool_calls,omitempty"`
+	Text               *ResponsesText           `json:"text,omitempty"`
+	Reasoning          *ResponsesReasoning      `json:"reasoning,omitempty"`
+	Stream             bool                     `json:"stream,omitempty"`
+	Store              *bool                    `json:"store,omitempty"`
+	User               string                   `json:"user,omitempty"`
+	Metadata           map[string]string        `json:"metadata,omitempty"`
+}
+
+type ResponsesText struct {
+	Format *ResponsesTextFormat `json:"format,omitempty"`
+}
+
+type ResponsesTextFormat struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Schema      any    `json:"schema,omitempty"`
+	Strict      bool   `json:"strict,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type ResponsesRes struct {
+	Id                 string                      `json:"id"`
+	Object             string                      `json:"object"`
+	CreatedAt          int64                       `json:"created_at"`
+	Status             string                      `json:"status"`
+	Error              *ResponsesError             `json:"error"`
+	IncompleteDetails  *ResponsesIncompleteDetails `json:"incomplete_details"`
+	Instructions       string                      `json:"instructions,omitempty"`
+	MaxOutputTokens    int                         `json:"max_output_tokens,omitempty"`
+	Model              string                      `json:"model"`
+	Output             []*ResponsesOutputItem      `json:"output"`
+	ParallelToolCalls  any                         `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseId string                      `json:"previous_response_id,omitempty"`
+	Reasoning          *ResponsesReasoning         `json:"reasoning,omitempty"`
+	Store              bool                        `json:"store"`
+	Temperature        float32                     `json:"temperature,omitempty"`
+	Text               *ResponsesText              `json:"text,omitempty"`
+	ToolChoice         any                         `json:"tool_choice,omitempty"`
+	Tools              []map[string]interface{}    `json:"tools"`
+	TopP               float32                     `json:"top_p,omitempty"`
+	Usage              *ResponsesUsage             `json:"usage,omitempty"`
+	User               string                      `json:"user,omitempty"`
+	Metadata           map[string]string           `json:"metadata,omitempty"`
+}
+
+type ResponsesOutputItem struct {
+	Type      string                    `json:"type"`
+	Id        string                    `json:"id"`
+	Status    string                    `json:"status,omitempty"`
+	Role      string                    `json:"role,omitempty"`
+	Content   []*ResponsesOutputContent `json:"content,omitempty"`
+	CallId    string                    `json:"call_id,omitempty"`
+	Name      string                    `json:"name,omitempty"`
+	Arguments string                    `json:"arguments,omitempty"`
+}
+
+type ResponsesOutputContent struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+type ResponsesUsage struct {
+	InputTokens         int                          `json:"input_tokens"`
+	InputTokensDetails  ResponsesInputTokensDetails  `json:"input_tokens_details"`
+	OutputTokens        int                          `json:"output_tokens"`
+	OutputTokensDetails ResponsesOutputTokensDetails `json:"output_tokens_details"`
+	TotalTokens         int                          `json:"total_tokens"`
+}
+
+type ResponsesInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type ResponsesOutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+type ResponsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResponsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponsesDeleteRes struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
@@ -7,6 +7,8 @@ package service
 
 import (
 	"context"
+
+	"github.com/iimeta/fastapi/internal/model"
 )
 
 type (
@@ -15,6 +17,8 @@ type (
 		Authenticator(ctx context.Context, secretKey string) error
 		// 核验密钥
 		VerifySecretKey(ctx context.Context, secretKey string) error
+		// 核验模型额度上限, 模型确定后检查应用和应用密钥在该模型上的已用额度
+		VerifyModelQuota(ctx context.Context, m *model.Model) error
 	}
 )
 
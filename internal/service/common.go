@@ -16,9 +16,21 @@ type (
 		// 解析密钥
 		ParseSecretKey(ctx context.Context, secretKey string) (int, int, error)
 		// 记录错误次数和禁用
-		RecordError(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent)
+		RecordError(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent, err error)
+		// 记录成功, 请求成功时显式调用, 熔断器据此关闭半开状态和重置失败计数
+		RecordSuccess(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent)
+		// 记录延迟, 流式和非流式请求均记录总耗时, 同一延迟统计的口径一致
+		RecordLatency(ctx context.Context, model *model.Model, key *model.Key, modelAgent *model.ModelAgent, latency int64)
 		// 记录使用额度
 		RecordUsage(ctx context.Context, totalTokens int, key string) error
+		// 预占额度, 额度不足时拒绝, 同一请求只预占一次
+		ReserveQuota(ctx context.Context, amount int) error
+		// 释放预占额度, 仅用于未进入记录使用额度的请求(出错或无花费), 已进入结算的预占额度由记录使用额度随实际花费一并释放
+		ReleaseQuota(ctx context.Context)
+		// 结算预占额度, 在异步记录使用额度前调用, 之后请求结束时不再直接释放预占额度
+		SettleQuota(ctx context.Context)
+		// 额度对账, 重放未完成入账的账本, 并记录Redis与Mongo之间的额度差异
+		ReconcileUsage(ctx context.Context) error
 		GetUserTotalTokens(ctx context.Context) (int, error)
 		GetAppTotalTokens(ctx context.Context) (int, error)
 		GetKeyTotalTokens(ctx context.Context) (int, error)
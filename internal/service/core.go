@@ -13,6 +13,12 @@ type (
 	ICore interface {
 		// 刷新缓存
 		Refresh(ctx context.Context) error
+		// 健康探测, 恢复自动禁用的模型密钥和模型代理
+		HealthProbe(ctx context.Context) error
+		// 额度预算重置, 每个周期开始时将应用和应用密钥的额度重置为周期额度, 并记录上一周期的使用情况
+		ResetQuotaBudget(ctx context.Context) error
+		// 模型额度上限重置, 每个周期开始时清零应用和应用密钥在各模型上的已用额度
+		ResetModelQuota(ctx context.Context) error
 	}
 )
 
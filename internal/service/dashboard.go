@@ -16,7 +16,7 @@ type (
 		// Subscription
 		Subscription(ctx context.Context) (*model.DashboardSubscriptionRes, error)
 		// Usage
-		Usage(ctx context.Context) (*model.DashboardUsageRes, error)
+		Usage(ctx context.Context, params model.DashboardUsageReq) (*model.DashboardUsageRes, error)
 	}
 )
 
@@ -15,6 +15,12 @@ type (
 	IFile interface {
 		// Files
 		Files(ctx context.Context, params model.FileFilesReq) ([]byte, error)
+		// 上传文件, 存储到本地用于批处理
+		Upload(ctx context.Context, params model.FileFilesReq) (*model.FileRes, error)
+		// 获取文件
+		Retrieve(ctx context.Context, fileId string) (*model.FileRes, error)
+		// 获取文件内容
+		Content(ctx context.Context, fileId string) ([]byte, error)
 	}
 )
 
@@ -21,11 +21,15 @@ type (
 		// 密钥列表
 		List(ctx context.Context, typ int) ([]*model.Key, error)
 		// 挑选模型密钥
-		PickModelKey(ctx context.Context, m *model.Model) (int, *model.Key, error)
+		PickModelKey(ctx context.Context, m *model.Model, affinity *model.Affinity, retry ...int) (total int, key *model.Key, err error)
+		// 只读挑选模型密钥, 不占用并发数、不排队等待、不发起熔断探测, 跳过排除的密钥
+		PeekModelKey(ctx context.Context, m *model.Model, excludeIds ...string) (total int, key *model.Key, err error)
 		// 移除模型密钥
 		RemoveModelKey(ctx context.Context, m *model.Model, key *model.Key)
 		// 记录错误模型密钥
 		RecordErrorModelKey(ctx context.Context, m *model.Model, key *model.Key)
+		// 记录模型密钥延迟
+		RecordLatencyModelKey(ctx context.Context, m *model.Model, key *model.Key, latency int64)
 		// 禁用模型密钥
 		DisabledModelKey(ctx context.Context, key *model.Key, disabledReason string)
 		// 保存模型密钥列表到缓存
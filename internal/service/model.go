@@ -44,7 +44,7 @@ type (
 		// 获取目标模型
 		GetTargetModel(ctx context.Context, model *model.Model, messages []sdkm.ChatCompletionMessage) (targetModel *model.Model, err error)
 		// 获取后备模型
-		GetFallbackModel(ctx context.Context, model *model.Model) (fallbackModel *model.Model, err error)
+		GetFallbackModel(ctx context.Context, id string) (fallbackModel *model.Model, err error)
 		// 变更订阅
 		Subscribe(ctx context.Context, msg string) error
 	}
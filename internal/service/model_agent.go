@@ -23,19 +23,27 @@ type (
 		// 根据模型代理ID获取密钥列表
 		GetModelAgentKeys(ctx context.Context, id string) ([]*model.Key, error)
 		// 挑选模型代理
-		PickModelAgent(ctx context.Context, m *model.Model) (int, *model.ModelAgent, error)
+		PickModelAgent(ctx context.Context, m *model.Model, affinity *model.Affinity, retry ...int) (total int, modelAgent *model.ModelAgent, err error)
+		// 只读挑选模型代理, 不占用并发数、不排队等待、不发起熔断探测, 用于费用预估等不实际请求上游的场景
+		PeekModelAgent(ctx context.Context, m *model.Model, excludeIds ...string) (total int, modelAgent *model.ModelAgent, err error)
 		// 移除模型代理
 		RemoveModelAgent(ctx context.Context, m *model.Model, modelAgent *model.ModelAgent)
 		// 记录错误模型代理
 		RecordErrorModelAgent(ctx context.Context, m *model.Model, modelAgent *model.ModelAgent)
+		// 记录模型代理延迟
+		RecordLatencyModelAgent(ctx context.Context, m *model.Model, modelAgent *model.ModelAgent, latency int64)
 		// 禁用模型代理
 		DisabledModelAgent(ctx context.Context, modelAgent *model.ModelAgent, disabledReason string)
 		// 挑选模型代理密钥
-		PickModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent) (int, *model.Key, error)
+		PickModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, affinity *model.Affinity, retry ...int) (total int, key *model.Key, err error)
+		// 只读挑选模型代理密钥, 不占用并发数、不排队等待、不发起熔断探测, 跳过排除的密钥
+		PeekModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, excludeIds ...string) (total int, key *model.Key, err error)
 		// 移除模型代理密钥
 		RemoveModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, key *model.Key)
 		// 记录错误模型代理密钥
 		RecordErrorModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, key *model.Key)
+		// 记录模型代理密钥延迟
+		RecordLatencyModelAgentKey(ctx context.Context, modelAgent *model.ModelAgent, key *model.Key, latency int64)
 		// 禁用模型代理密钥
 		DisabledModelAgentKey(ctx context.Context, key *model.Key, disabledReason string)
 		// 保存模型代理列表到缓存
@@ -65,7 +73,7 @@ type (
 		// 保存模型代理到缓存
 		SaveCache(ctx context.Context, modelAgent *model.ModelAgent) error
 		// 获取后备模型代理
-		GetFallbackModelAgent(ctx context.Context, model *model.Model) (fallbackModelAgent *model.ModelAgent, err error)
+		GetFallbackModelAgent(ctx context.Context, id string) (fallbackModelAgent *model.ModelAgent, err error)
 		// 变更订阅
 		Subscribe(ctx context.Context, msg string) error
 	}
@@ -9,6 +9,7 @@ import (
 	"context"
 
 	"github.com/iimeta/fastapi/internal/model"
+	"github.com/iimeta/fastapi/internal/model/common"
 )
 
 type (
@@ -47,6 +48,38 @@ type (
 		RecordErrorKey(ctx context.Context, id string)
 		// 获取会话中的错误密钥Ids
 		GetErrorKeys(ctx context.Context) []string
+		// 记录后备步骤到会话中
+		RecordFallback(ctx context.Context, step *common.FallbackStep)
+		// 获取会话中的后备路径
+		GetFallbacks(ctx context.Context) []*common.FallbackStep
+		// 记录并发租约到会话中
+		RecordConcurrencyLease(ctx context.Context, lease *model.ConcurrencyLease)
+		// 移除会话中的并发租约
+		RemoveConcurrencyLease(ctx context.Context, typ, id string)
+		// 获取会话中的并发租约, 从请求中读取以获取最新的会话
+		GetConcurrencyLeases(ctx context.Context) []*model.ConcurrencyLease
+		// 保存额度预占到会话中
+		SaveQuotaReservation(ctx context.Context, reservation *model.QuotaReservation)
+		// 获取会话中的额度预占, 从请求中读取以获取最新的会话
+		GetQuotaReservation(ctx context.Context) *model.QuotaReservation
+		// 保存已校验速率限制到会话中
+		SaveIsRateLimitChecked(ctx context.Context)
+		// 获取会话中是否已校验速率限制, 从请求中读取以获取最新的会话
+		GetIsRateLimitChecked(ctx context.Context) bool
+		// 累加流式续写前已输出的补全令牌数到会话中
+		AddResumeTokens(ctx context.Context, tokens int)
+		// 获取会话中流式续写前已输出的补全令牌数, 从请求中读取以获取最新的会话
+		GetResumeTokens(ctx context.Context) int
+		// 获取会话中的下一个计费序号, 同一请求多次计费时递增
+		NextBillingSeq(ctx context.Context) int64
+		// 保存超过的软限制到会话中
+		SaveSoftLimit(ctx context.Context, softLimit *common.SoftLimit)
+		// 获取会话中超过的软限制, 从请求中读取以获取最新的会话
+		GetSoftLimit(ctx context.Context) *common.SoftLimit
+		// 保存模型额度上限的已用额度字段到会话中
+		SaveModelQuotaFields(ctx context.Context, fields []string)
+		// 获取会话中模型额度上限的已用额度字段, 从请求中读取以获取最新的会话
+		GetModelQuotaFields(ctx context.Context) []string
 	}
 )
 
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -169,6 +170,19 @@ func (m *MongoDB) EstimatedDocumentCount(ctx context.Context) (int64, error) {
 	return client.Database(m.Database).Collection(m.Collection).EstimatedDocumentCount(ctx)
 }
 
+func (m *MongoDB) CreateIndex(ctx context.Context, keys interface{}, opts ...*options.IndexOptions) (string, error) {
+
+	indexModel := mongo.IndexModel{
+		Keys: keys,
+	}
+
+	if len(opts) > 0 {
+		indexModel.Options = opts[0]
+	}
+
+	return client.Database(m.Database).Collection(m.Collection).Indexes().CreateOne(ctx, indexModel)
+}
+
 func (m *MongoDB) Aggregate(ctx context.Context, result interface{}, opts ...*options.AggregateOptions) error {
 
 	cursor, err := client.Database(m.Database).Collection(m.Collection).Aggregate(ctx, m.Pipeline, opts...)
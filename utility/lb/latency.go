@@ -0,0 +1,139 @@
+package lb
+
+import (
+	"github.com/iimeta/fastapi/internal/model"
+	"math/rand/v2"
+	"sync"
+)
+
+const (
+	latencyAlpha   = 0.3  // 延迟衰减系数
+	errorRateAlpha = 0.2  // 错误率衰减系数
+	errorPenalty   = 10.0 // 错误率惩罚倍数
+)
+
+type Latency struct {
+	stats map[string]*Stat
+	mutex sync.RWMutex
+}
+
+type Stat struct {
+	Latency   float64 // 延迟(毫秒)指数加权移动平均值
+	ErrorRate float64 // 错误率指数加权移动平均值
+	Total     int64   // 统计次数
+}
+
+func NewLatency() *Latency {
+	return &Latency{
+		stats: make(map[string]*Stat),
+	}
+}
+
+// 记录成功调用的延迟, 调用方流式和非流式请求均传入总耗时
+func (l *Latency) Record(id string, latency int64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stat := l.stats[id]
+	if stat == nil {
+		l.stats[id] = &Stat{
+			Latency: float64(latency),
+			Total:   1,
+		}
+		return
+	}
+
+	if stat.Latency == 0 {
+		stat.Latency = float64(latency)
+	} else {
+		stat.Latency = latencyAlpha*float64(latency) + (1-latencyAlpha)*stat.Latency
+	}
+
+	stat.ErrorRate = (1 - errorRateAlpha) * stat.ErrorRate
+	stat.Total++
+}
+
+// 记录失败调用
+func (l *Latency) RecordError(id string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stat := l.stats[id]
+	if stat == nil {
+		stat = new(Stat)
+		l.stats[id] = stat
+	}
+
+	stat.ErrorRate = errorRateAlpha + (1-errorRateAlpha)*stat.ErrorRate
+	stat.Total++
+}
+
+func (l *Latency) Stat(id string) Stat {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if stat := l.stats[id]; stat != nil {
+		return *stat
+	}
+
+	return Stat{}
+}
+
+// 得分越低越优先, 未统计过的优先探测
+func (l *Latency) score(id string) float64 {
+
+	stat := l.Stat(id)
+	if stat.Total == 0 {
+		return 0
+	}
+
+	return (stat.Latency + 1) * (1 + errorPenalty*stat.ErrorRate)
+}
+
+// 二选一(Power of Two Choices), 随机抽取两个取得分较低者
+func (l *Latency) Index(ids []string) int {
+
+	if len(ids) <= 1 {
+		return 0
+	}
+
+	i := rand.IntN(len(ids))
+	j := rand.IntN(len(ids) - 1)
+	if j >= i {
+		j++
+	}
+
+	if l.score(ids[j]) < l.score(ids[i]) {
+		return j
+	}
+
+	return i
+}
+
+func (l *Latency) PickKey(keys []*model.Key) *model.Key {
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.Id)
+	}
+
+	return keys[l.Index(ids)]
+}
+
+func (l *Latency) PickModelAgent(modelAgents []*model.ModelAgent) *model.ModelAgent {
+
+	if len(modelAgents) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(modelAgents))
+	for _, modelAgent := range modelAgents {
+		ids = append(ids, modelAgent.Id)
+	}
+
+	return modelAgents[l.Index(ids)]
+}
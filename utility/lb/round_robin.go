@@ -26,6 +26,18 @@ func (r *RoundRobin) Index(lens int) (index int) {
 	return
 }
 
+// 当前下标, 不推进
+func (r *RoundRobin) Current(lens int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.currentIndex >= lens {
+		return 0
+	}
+
+	return r.currentIndex
+}
+
 func (r *RoundRobin) Pick(values []string) string {
 	return values[r.Index(len(values))]
 }
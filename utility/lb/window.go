@@ -0,0 +1,71 @@
+package lb
+
+import (
+	"math"
+	"slices"
+	"sync"
+)
+
+// 滑动窗口, 保留最近size次的延迟用于计算分位数
+type Window struct {
+	samples []int64
+	index   int
+	full    bool
+	mutex   sync.Mutex
+}
+
+func NewWindow(size int) *Window {
+	return &Window{
+		samples: make([]int64, size),
+	}
+}
+
+// 记录延迟
+func (w *Window) Record(latency int64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.samples[w.index] = latency
+	w.index = (w.index + 1) % len(w.samples)
+
+	if w.index == 0 {
+		w.full = true
+	}
+}
+
+// 样本数量
+func (w *Window) Len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.full {
+		return len(w.samples)
+	}
+
+	return w.index
+}
+
+// 分位数, p取值范围(0, 1]
+func (w *Window) Percentile(p float64) int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	n := w.index
+	if w.full {
+		n = len(w.samples)
+	}
+
+	if n == 0 {
+		return 0
+	}
+
+	samples := slices.Clone(w.samples[:n])
+	slices.Sort(samples)
+
+	i := int(math.Ceil(p*float64(n))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return samples[min(i, n-1)]
+}
@@ -151,6 +151,10 @@ func HMGet(ctx context.Context, key string, fields ...string) (gvar.Vars, error)
 	return slave.HMGet(ctx, key, fields...)
 }
 
+func HGetAll(ctx context.Context, key string) (*gvar.Var, error) {
+	return slave.HGetAll(ctx, key)
+}
+
 func HVals(ctx context.Context, key string) (gvar.Vars, error) {
 	return slave.HVals(ctx, key)
 }
@@ -254,3 +258,11 @@ func LRange(ctx context.Context, key string, start, stop int64) (gvar.Vars, erro
 func TTL(ctx context.Context, key string) (int64, error) {
 	return slave.TTL(ctx, key)
 }
+
+func ZRem(ctx context.Context, key string, member interface{}, members ...interface{}) (int64, error) {
+	return master.ZRem(ctx, key, member, members...)
+}
+
+func Eval(ctx context.Context, script string, numKeys int64, keys []string, args []interface{}) (*gvar.Var, error) {
+	return master.Eval(ctx, script, numKeys, keys, args)
+}
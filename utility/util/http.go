@@ -8,6 +8,7 @@ import (
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/os/gctx"
 	"github.com/iimeta/fastapi/internal/config"
+	"github.com/iimeta/fastapi/internal/consts"
 	"github.com/iimeta/fastapi/internal/errors"
 	"github.com/iimeta/fastapi/utility/logger"
 	"net/http"
@@ -55,9 +56,36 @@ func HttpPost(ctx context.Context, url string, header map[string]string, data, r
 	return nil
 }
 
+// SSE事件, Event为空时仅输出数据
+type SSEEvent struct {
+	Event string
+	Data  string
+}
+
+// SSE数据转换器, 将数据转换成其它协议格式的事件后输出
+type SSEConverter func(data string) ([]*SSEEvent, error)
+
 func SSEServer(ctx context.Context, data string) error {
 
 	r := g.RequestFromCtx(ctx)
+
+	if converter, ok := r.GetCtxVar(consts.SESSION_SSE_CONVERTER).Val().(SSEConverter); ok {
+
+		events, err := converter(data)
+		if err != nil {
+			logger.Errorf(ctx, "SSEServer data: %s, error: %v", data, err)
+			return err
+		}
+
+		for _, event := range events {
+			if err = SSEEventServer(ctx, event.Event, event.Data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
 	rw := r.Response.RawWriter()
 	flusher, ok := rw.(http.Flusher)
 	if !ok {
@@ -79,3 +107,50 @@ func SSEServer(ctx context.Context, data string) error {
 
 	return nil
 }
+
+// 输出带事件名的SSE数据
+func SSEEventServer(ctx context.Context, event, data string) error {
+
+	r := g.RequestFromCtx(ctx)
+	rw := r.Response.RawWriter()
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "Streaming unsupported", http.StatusInternalServerError)
+		return gerror.New("Streaming unsupported")
+	}
+
+	r.Response.Header().Set("Trace-Id", gctx.CtxId(ctx))
+	r.Response.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	r.Response.Header().Set("Cache-Control", "no-cache")
+	r.Response.Header().Set("Connection", "keep-alive")
+
+	// 未指定事件名时仅输出数据
+	if event == "" {
+		if _, err := fmt.Fprintf(rw, "data: %s\n\n", data); err != nil {
+			logger.Errorf(ctx, "SSEEventServer data: %s, error: %v", data, err)
+			return err
+		}
+	} else if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		logger.Errorf(ctx, "SSEEventServer event: %s, data: %s, error: %v", event, data, err)
+		return err
+	}
+
+	flusher.Flush()
+
+	return nil
+}
+
+// 是否已向客户端输出SSE数据
+func IsSSEFlushed(ctx context.Context) bool {
+
+	r := g.RequestFromCtx(ctx)
+	if r == nil {
+		return false
+	}
+
+	if rw, ok := r.Response.RawWriter().(interface{ BytesWritten() int64 }); ok {
+		return rw.BytesWritten() > 0
+	}
+
+	return false
+}